@@ -0,0 +1,55 @@
+package envsubst
+
+import "time"
+
+// AuditRecord describes a lookup recorded by Audit. It never holds the
+// value of the variable.
+type AuditRecord struct {
+	// Key is the name of the variable.
+	Key string
+	// Found reports whether the variable is defined.
+	Found bool
+	// Source names the origin of the value, if the variable is defined.
+	Source string
+	// Time is when the lookup started.
+	Time time.Time
+	// Err is the error of the lookup, if any.
+	Err error
+}
+
+// sourcer is implemented by providers that record where each of their
+// variables comes from, such as DotenvFiles.
+type sourcer interface {
+	Source(key string) (string, bool)
+}
+
+// Audit returns a provider recording every lookup in p to sink, e.g. to
+// keep a record of the secrets read by each render. The source of the
+// records is the one reported by p if it has a Source method like
+// DotenvFiles, and source otherwise. Sink is called synchronously and
+// must be safe for concurrent use if the provider is.
+func Audit(p Provider, source string, sink func(AuditRecord)) Provider {
+	return auditProvider{provider: p, source: source, sink: sink}
+}
+
+type auditProvider struct {
+	provider Provider
+	source   string
+	sink     func(AuditRecord)
+}
+
+func (a auditProvider) Lookup(key string) (string, bool, error) {
+	r := AuditRecord{Key: key, Time: time.Now()}
+	v, ok, err := a.provider.Lookup(key)
+	r.Found, r.Err = ok, err
+	if ok {
+		r.Source = a.source
+		if s, isSourcer := a.provider.(sourcer); isSourcer {
+			if name, found := s.Source(key); found {
+				r.Source = name
+			}
+		}
+	}
+	a.sink(r)
+	return v, ok, err
+}
@@ -0,0 +1,61 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	sink := func(r AuditRecord) {
+		records = append(records, r)
+	}
+	p := Chain(
+		Audit(mapProvider{"USER": "admin"}, "defaults", sink),
+		Audit(ProviderFunc(func(key string) (string, bool, error) {
+			return "", false, errors.New("denied")
+		}), "vault", sink),
+	)
+	if _, err := EvalProvider("${USER} ${PASSWORD}", p); err == nil {
+		t.Errorf("Want lookup error")
+	}
+	if len(records) != 3 {
+		t.Fatalf("Want 3 records, got %v", records)
+	}
+	if r := records[0]; r.Key != "USER" || !r.Found || r.Source != "defaults" || r.Time.IsZero() || r.Err != nil {
+		t.Errorf("Want hit from defaults, got %+v", r)
+	}
+	if r := records[1]; r.Key != "PASSWORD" || r.Found || r.Source != "" {
+		t.Errorf("Want miss, got %+v", r)
+	}
+	if r := records[2]; r.Key != "PASSWORD" || r.Found || r.Err == nil {
+		t.Errorf("Want error, got %+v", r)
+	}
+}
+
+func TestAuditSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(name, []byte("USER=admin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := LoadDotenvFiles([]string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []AuditRecord
+	p := Audit(files, "dotenv", func(r AuditRecord) { records = append(records, r) })
+	if _, err := EvalProvider("${USER}", p); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Source != name {
+		t.Errorf("Want the file as source, got %+v", records)
+	}
+}
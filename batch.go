@@ -0,0 +1,83 @@
+package envsubst
+
+import (
+	"fmt"
+	"sync"
+)
+
+// InputError records the failure to evaluate a single input of a batch.
+type InputError struct {
+	Index int
+	Err   error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("input %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying evaluation error.
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned when one or more inputs of a batch fail to
+// evaluate. The errors are ordered by input index.
+type BatchError []*InputError
+
+func (e BatchError) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// EvalAll replaces ${var} in each of the inputs based on the mapping
+// function. Inputs are parsed and executed concurrently by a bounded
+// pool of workers, see Workers. The mapping function must be safe for
+// concurrent use.
+//
+// The returned slice has the same length as inputs. If any input fails
+// to evaluate, the slice still holds the results of the inputs that
+// succeeded and the error is a BatchError.
+func EvalAll(inputs []string, mapping func(string) string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	outputs := make([]string, len(inputs))
+	errs := make([]error, len(inputs))
+
+	workers := o.workers
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outputs[i], errs[i] = Eval(inputs[i], mapping, opts...)
+			}
+		}()
+	}
+	for i := range inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var batch BatchError
+	for i, err := range errs {
+		if err != nil {
+			outputs[i] = ""
+			batch = append(batch, &InputError{Index: i, Err: err})
+		}
+	}
+	if len(batch) != 0 {
+		return outputs, batch
+	}
+	return outputs, nil
+}
@@ -0,0 +1,44 @@
+package envsubst
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvalAll(t *testing.T) {
+	params := map[string]string{"var01": "abcdEFGH28ij"}
+	mapping := func(s string) string {
+		return params[s]
+	}
+
+	var inputs, want []string
+	for i := 0; i < 100; i++ {
+		inputs = append(inputs, fmt.Sprintf("%d ${var01^^}", i))
+		want = append(want, fmt.Sprintf("%d ABCDEFGH28IJ", i))
+	}
+
+	got, err := EvalAll(inputs, mapping, Workers(4))
+	if err != nil {
+		t.Fatalf("Expected outputs but got error %v", err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Want input %d expanded to %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestEvalAllErrors(t *testing.T) {
+	inputs := []string{"${var01", "ok", "${var01%"}
+	got, err := EvalAll(inputs, func(string) string { return "" })
+	batch, ok := err.(BatchError)
+	if !ok {
+		t.Fatalf("Expected BatchError, got %v", err)
+	}
+	if len(batch) != 2 || batch[0].Index != 0 || batch[1].Index != 2 {
+		t.Errorf("Expected errors for inputs 0 and 2, got %v", batch)
+	}
+	if got[1] != "ok" {
+		t.Errorf("Expected successful input to be returned, got %q", got[1])
+	}
+}
@@ -0,0 +1,58 @@
+package envsubst
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is the length of the start of a file checked for binary
+// data by startsBinary.
+const sniffLen = 8000
+
+// escapeBinary escapes the $ and \ characters of the lines of s that
+// hold binary data, so that they are copied to the output verbatim.
+func escapeBinary(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		end := strings.IndexByte(s[i:], '\n') + 1
+		if end == 0 {
+			end = len(s)
+		} else {
+			end += i
+		}
+		line := s[i:end]
+		if isBinary(line) && strings.ContainsAny(line, `$\`) {
+			if b.Len() == 0 {
+				b.Grow(len(s) + len(s)/8)
+				b.WriteString(s[:i])
+			}
+			for j := 0; j < len(line); j++ {
+				if line[j] == '$' || line[j] == '\\' {
+					b.WriteByte(line[j])
+				}
+				b.WriteByte(line[j])
+			}
+		} else if b.Len() != 0 {
+			b.WriteString(line)
+		}
+		i = end
+	}
+	if b.Len() == 0 {
+		return s
+	}
+	return b.String()
+}
+
+// isBinary reports whether the text holds a NUL byte or invalid UTF-8.
+func isBinary(s string) bool {
+	return strings.IndexByte(s, 0) >= 0 || !utf8.ValidString(s)
+}
+
+// startsBinary reports whether the first sniffLen bytes buffered by r
+// hold a NUL byte.
+func startsBinary(r *bufio.Reader) bool {
+	b, _ := r.Peek(sniffLen)
+	return bytes.IndexByte(b, 0) >= 0
+}
@@ -0,0 +1,52 @@
+package envsubst
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBinaryPassThrough(t *testing.T) {
+	mapping := func(s string) string { return "V" }
+	var tests = []struct {
+		input, output string
+	}{
+		{"a\x00b", "a\x00b"},
+		{"\x00${x}\x00", "\x00V\x00"},
+		{"a\xffb${x}\xfe\x80", "a\xffbV\xfe\x80"},
+		{"\xc3${x}\xa9", "\xc3V\xa9"},
+	}
+	for _, test := range tests {
+		got, err := Eval(test.input, mapping)
+		if err != nil || got != test.output {
+			t.Errorf("Want %q evaluated to %q, got %q, %v", test.input, test.output, got, err)
+		}
+		b, err := ioutil.ReadAll(NewReader(strings.NewReader(test.input), mapping))
+		if err != nil || string(b) != test.output {
+			t.Errorf("Want %q read as %q, got %q, %v", test.input, test.output, b, err)
+		}
+	}
+}
+
+func TestSkipBinary(t *testing.T) {
+	mapping := func(s string) string { return "V" }
+	binary := "\x89PNG\x00${x} $$ \\\\ ${bad\xff\n"
+	input := "a: ${x} $$\n" + binary + "b: ${x}"
+	want := "a: V $\n" + binary + "b: V"
+
+	if _, err := Eval(input, mapping); err == nil {
+		t.Errorf("Want binary line to fail to parse without SkipBinary")
+	}
+	got, err := Eval(input, mapping, SkipBinary())
+	if err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	b, err := ioutil.ReadAll(NewReader(strings.NewReader(input), mapping, SkipBinary()))
+	if err != nil || !bytes.Equal(b, []byte(want)) {
+		t.Errorf("Want %q read, got %q, %v", want, b, err)
+	}
+	if s := "plain ${x}\n"; escapeBinary(s) != s {
+		t.Errorf("Want text lines unchanged")
+	}
+}
@@ -0,0 +1,188 @@
+package envsubst
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// Cache memoizes parsed templates keyed by their source and the options
+// they are parsed with, evicting the least recently used template when
+// full. It is safe for concurrent use.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	opts  []Option
+	ll    *list.List
+	items map[cacheKey]*list.Element
+}
+
+// cacheKey identifies a cached template by its source and the options
+// that affect its parsing.
+type cacheKey struct {
+	source      string
+	mode        parse.Mode
+	limits      parse.Limits
+	disabled    bool
+	stripBOM    bool
+	skipBinary  bool
+	frontmatter bool
+}
+
+// newCacheKey returns the key of the template parsed from s with the
+// options o.
+func newCacheKey(s string, o *options) cacheKey {
+	return cacheKey{
+		source:      s,
+		mode:        o.mode,
+		limits:      o.limits,
+		disabled:    o.disabled,
+		stripBOM:    o.stripBOM,
+		skipBinary:  o.skipBinary,
+		frontmatter: o.frontmatter,
+	}
+}
+
+// cacheEntry is the value of the cache list elements.
+type cacheEntry struct {
+	key      cacheKey
+	template *Template
+}
+
+// NewCache returns a cache holding up to size templates, parsed with the
+// given options. A size less than one means no limit.
+func NewCache(size int, opts ...Option) *Cache {
+	return &Cache{
+		size:  size,
+		opts:  opts,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Parse returns the template parsed from string s, parsing it only if
+// it is not already in the cache. Templates that fail to parse are not
+// cached.
+func (c *Cache) Parse(s string) (*Template, error) {
+	return c.parse(s, newOptions(c.opts))
+}
+
+// parse returns the template parsed from string s with the options o,
+// which hold those of the cache, parsing it only if it is not already
+// in the cache.
+func (c *Cache) parse(s string, o *options) (*Template, error) {
+	key := newCacheKey(s, o)
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		t := e.Value.(*cacheEntry).template
+		c.mu.Unlock()
+		return t, nil
+	}
+	c.mu.Unlock()
+
+	t, err := parseTemplate(s, o)
+	if err != nil {
+		return nil, err
+	}
+	t.opts = c.opts
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		// parsed concurrently by another caller.
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).template, nil
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, template: t})
+	if c.size > 0 && c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+	return t, nil
+}
+
+// Eval is like the package function Eval, but uses the cached template.
+func (c *Cache) Eval(s string, mapping func(string) string, opts ...Option) (string, error) {
+	return c.EvalProvider(s, funcProvider(mapping), opts...)
+}
+
+// EvalProvider is like the package function EvalProvider, but uses the
+// cached template. The options given apply on top of those of the
+// cache, and those affecting parsing, such as Pipelines, StrictSyntax or
+// MaxDepth, or set by a modeline, select the cached template, so that
+// the same source parsed with other options is cached separately.
+func (c *Cache) EvalProvider(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) && frontmatterLen(s) <= 0 {
+		return s, nil
+	}
+	o := newOptions(append(c.opts[:len(c.opts):len(c.opts)], opts...))
+	if err := applyModeline(s, o); err != nil {
+		return s, err
+	}
+	t, err := c.parse(s, o)
+	if err != nil {
+		return s, err
+	}
+	return t.execute(p, o)
+}
+
+// Len returns the number of templates in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// mappingEntry is the value of the list elements of CacheMapping.
+type mappingEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// CacheMapping returns a mapping function memoizing the values returned
+// by mapping, so that expensive lookups are made once per variable. Empty
+// values, which stand for undefined variables, are cached as well.
+// Values expire after ttl, unless ttl is zero or less, and the least
+// recently used value is evicted when more than maxEntries are cached,
+// unless maxEntries is less than one. The returned function is safe for
+// concurrent use if mapping is.
+func CacheMapping(mapping func(string) string, ttl time.Duration, maxEntries int) func(string) string {
+	var mu sync.Mutex
+	ll := list.New()
+	items := make(map[string]*list.Element)
+	return func(key string) string {
+		mu.Lock()
+		if e, ok := items[key]; ok {
+			entry := e.Value.(*mappingEntry)
+			if ttl <= 0 || time.Now().Before(entry.expires) {
+				ll.MoveToFront(e)
+				mu.Unlock()
+				return entry.value
+			}
+			ll.Remove(e)
+			delete(items, key)
+		}
+		mu.Unlock()
+
+		v := mapping(key)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if e, ok := items[key]; ok {
+			// looked up concurrently by another caller.
+			ll.Remove(e)
+		}
+		items[key] = ll.PushFront(&mappingEntry{key: key, value: v, expires: time.Now().Add(ttl)})
+		if maxEntries > 0 && ll.Len() > maxEntries {
+			e := ll.Back()
+			ll.Remove(e)
+			delete(items, e.Value.(*mappingEntry).key)
+		}
+		return v
+	}
+}
@@ -0,0 +1,130 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	mapping := func(s string) string {
+		return "value"
+	}
+
+	a, err := c.Parse("${a}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := c.Parse("${a}"); a != b {
+		t.Errorf("Expect cached template to be reused")
+	}
+	c.Parse("${b}")
+	c.Parse("${a}") // mark as recently used
+	c.Parse("${c}") // evicts ${b}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Expect cache length 2, got %d", n)
+	}
+	if b, _ := c.Parse("${a}"); a != b {
+		t.Errorf("Expect recently used template to remain cached")
+	}
+
+	if _, err := c.Parse("${bad"); err == nil {
+		t.Errorf("Expect parse error")
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Expect parse errors not cached, got length %d", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := fmt.Sprintf("%d=${var}", i%3)
+			got, err := c.Eval(s, mapping)
+			if want := fmt.Sprintf("%d=value", i%3); err != nil || got != want {
+				t.Errorf("Want %q expanded to %q, got %q, %v", s, want, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCacheParseOptions(t *testing.T) {
+	c := NewCache(0)
+	mapping := func(s string) string {
+		return map[string]string{"a": "x"}[s]
+	}
+	if _, err := c.Eval("${a:-${b}", mapping); err == nil {
+		t.Errorf("Want parse error")
+	}
+	if _, err := c.Eval("${a:-${b}}", mapping, MaxDepth(1)); err == nil {
+		t.Errorf("Want the per-call limit applied")
+	}
+	if got, err := c.Eval("${a:-${b}}", mapping); err != nil || got != "x" {
+		t.Errorf("Want the template parsed without the limit, got %q, %v", got, err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Want the template cached once, got length %d", c.Len())
+	}
+
+	input := "# envsubst: no-unset\n${a}${b}"
+	if _, err := c.Eval(input, mapping, Modelines()); !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want the modeline applied, got %v", err)
+	}
+	if got, err := c.Eval(input, mapping); err != nil || got != "# envsubst: no-unset\nx" {
+		t.Errorf("Want the modeline ignored without the option, got %q, %v", got, err)
+	}
+
+	input = "---\nvars:\n  b:\n    default: y\n---\n${a}${b}"
+	if got, err := c.Eval(input, mapping, Frontmatter()); err != nil || got != "xy" {
+		t.Errorf("Want the frontmatter applied, got %q, %v", got, err)
+	}
+	if got, err := c.Eval(input, mapping); err != nil || got != "---\nvars:\n  b:\n    default: y\n---\nx" {
+		t.Errorf("Want the frontmatter kept without the option, got %q, %v", got, err)
+	}
+}
+
+func TestCacheMapping(t *testing.T) {
+	calls := map[string]int{}
+	mapping := CacheMapping(func(key string) string {
+		calls[key]++
+		if key == "missing" {
+			return ""
+		}
+		return "value of " + key
+	}, time.Hour, 2)
+
+	for i := 0; i < 3; i++ {
+		if v := mapping("a"); v != "value of a" {
+			t.Errorf("Expect value of a, got %q", v)
+		}
+		if v := mapping("missing"); v != "" {
+			t.Errorf("Expect empty value, got %q", v)
+		}
+	}
+	if calls["a"] != 1 || calls["missing"] != 1 {
+		t.Errorf("Expect values and undefined variables looked up once, got %v", calls)
+	}
+	mapping("b") // evicts a
+	mapping("missing")
+	mapping("a")
+	if calls["a"] != 2 || calls["missing"] != 1 {
+		t.Errorf("Expect least recently used value evicted, got %v", calls)
+	}
+
+	expiring := CacheMapping(func(key string) string {
+		calls[key]++
+		return key
+	}, time.Millisecond, 0)
+	expiring("c")
+	expiring("c")
+	time.Sleep(5 * time.Millisecond)
+	expiring("c")
+	if calls["c"] != 2 {
+		t.Errorf("Expect value looked up again after expiry, got %d lookups", calls["c"])
+	}
+}
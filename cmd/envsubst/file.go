@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gomodules.xyz/envsubst"
+)
+
+// render returns the content of the named file with the environment
+// variables it references expanded, and the number of substitutions.
+func render(name string) ([]byte, int, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return expand(data)
+}
+
+// expand returns data with the environment variables it references
+// expanded, and the number of substitutions.
+func expand(data []byte) ([]byte, int, error) {
+	var b bytes.Buffer
+	_, summary, err := envsubst.EvalCopy(&b, bytes.NewReader(data), os.Getenv)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.Bytes(), summary.Substitutions, nil
+}
+
+// editFile expands the named file in place and returns the number of
+// substitutions, saving the original content as replaceFile does.
+// Symbolic links are followed, so that the file they point to is
+// edited.
+func editFile(name, suffix string) (int, error) {
+	name, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return 0, err
+	}
+	out, n, err := render(name)
+	if err != nil {
+		return 0, err
+	}
+	return n, replaceFile(name, out, suffix)
+}
+
+// replaceFile replaces the content of the named file with data. The
+// original content is first saved to the file named with suffix
+// appended, unless suffix is empty.
+func replaceFile(name string, data []byte, suffix string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if suffix != "" {
+		orig, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(name+suffix, orig, info.Mode(), info); err != nil {
+			return err
+		}
+	}
+	return writeFile(name, data, info.Mode(), info)
+}
+
+// mirrorFile writes the named file expanded to dst, with the same
+// permissions but owned by the current user, creating the directory of
+// dst if needed.
+func mirrorFile(name, dst string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	out, _, err := render(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return writeFile(dst, out, info.Mode(), nil)
+}
+
+// mirrorPath returns the path under outDir that the named file is
+// mirrored to: the same relative path, or the base name of the file if
+// its path is absolute or leads out of the current directory.
+func mirrorPath(outDir, name string) string {
+	rel := filepath.Clean(name)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(rel)
+	}
+	return filepath.Join(outDir, rel)
+}
+
+// writeFile atomically replaces the named file with data, with the
+// permissions of mode and, where possible, the ownership described by
+// owner unless it is nil: the
+// data is written to a temporary file of the same directory, synced to
+// disk and renamed over the file, so that readers see either the old or
+// the new content.
+func writeFile(name string, data []byte, mode os.FileMode, owner os.FileInfo) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(mode.Perm())
+	}
+	if err == nil && owner != nil {
+		chown(f, owner)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
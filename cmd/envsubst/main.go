@@ -2,14 +2,109 @@ package main
 
 import (
 	"bufio"
-	"os"
-	"log"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+
+	"gomodules.xyz/envsubst"
+)
 
-	"github.com/drone/envsubst"
+var (
+	// inPlace is the -i flag, given alone or with a backup suffix.
+	inPlace suffixFlag
+	// recursive mode and its file selection.
+	recursive        bool
+	include, exclude stringsFlag
+	// outDir receives the rendered files instead of the sources.
+	outDir string
 )
 
 func main() {
+	flag.Var(&inPlace, "i", "edit the files in place, keeping backups named with the suffix of -iSUFFIX")
+	flag.BoolVar(&recursive, "r", false, "edit the files under the directories in place, skipping binary files")
+	flag.Var(&include, "include", "render only the files matching the `glob`, with -r")
+	flag.Var(&exclude, "exclude", "leave the files matching the `glob` unchanged, with -r, dir/** matching every file under dir")
+	flag.StringVar(&outDir, "output-dir", "", "write the rendered files to the same paths under `dir` rather than in place")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  envsubst < input > output\n  envsubst [-i[SUFFIX] | --output-dir dir] file...\n  envsubst -r [-i[SUFFIX] | --output-dir dir] [--include glob] [--exclude glob] dir...\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(suffixArgs(os.Args[1:]))
+	for _, pattern := range append(include[:len(include):len(include)], exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Fatalf("Error: invalid glob %q: %v", pattern, err)
+		}
+	}
+
+	if !recursive && len(include)+len(exclude) != 0 {
+		log.Fatalf("Error: --include and --exclude require -r")
+	}
+	if inPlace.set && outDir != "" {
+		log.Fatalf("Error: -i and --output-dir are exclusive")
+	}
+	if flag.NArg() == 0 {
+		if inPlace.set || recursive || outDir != "" {
+			log.Fatalf("Error: -i, -r and --output-dir require files to render")
+		}
+		filter()
+		return
+	}
+	if recursive {
+		var st stats
+		opts := []envsubst.Option{envsubst.Include(include...), envsubst.Exclude(exclude...)}
+		for _, dir := range flag.Args() {
+			if err := renderTree(dir, outDir, opts, inPlace.suffix, &st); err != nil {
+				log.Fatalf("Error while rendering %s: %v", dir, err)
+			}
+		}
+		if outDir != "" {
+			fmt.Fprintf(os.Stderr, "envsubst: rendered %d files with %d substitutions, copied %d files unchanged to %s\n", st.files, st.substitutions, st.copied, outDir)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "envsubst: rendered %d files with %d substitutions, left %d files unchanged\n", st.files, st.substitutions, st.copied)
+		return
+	}
+	if outDir != "" {
+		// fail before writing anything if two files share a destination
+		mirrored := make(map[string]string)
+		for _, name := range flag.Args() {
+			dst := mirrorPath(outDir, name)
+			if prev, ok := mirrored[dst]; ok {
+				log.Fatalf("Error: %s and %s would both be written to %s", prev, name, dst)
+			}
+			mirrored[dst] = name
+		}
+	}
+	for _, name := range flag.Args() {
+		if inPlace.set {
+			if _, err := editFile(name, inPlace.suffix); err != nil {
+				log.Fatalf("Error while editing %s: %v", name, err)
+			}
+			continue
+		}
+		if outDir != "" {
+			if err := mirrorFile(name, mirrorPath(outDir, name)); err != nil {
+				log.Fatalf("Error while rendering %s: %v", name, err)
+			}
+			continue
+		}
+		out, _, err := render(name)
+		if err != nil {
+			log.Fatalf("Error while envsubst: %v", err)
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			log.Fatalf("Error while writing to stdout: %v", err)
+		}
+	}
+}
+
+// filter expands the lines of the standard input to the standard
+// output.
+func filter() {
 	stdin := bufio.NewScanner(os.Stdin)
 	stdout := bufio.NewWriter(os.Stdout)
 
@@ -26,3 +121,49 @@ func main() {
 	}
 }
 
+// suffixFlag is a boolean flag that may also be given a value, as in
+// -i.bak.
+type suffixFlag struct {
+	set    bool
+	suffix string
+}
+
+func (f *suffixFlag) String() string { return f.suffix }
+
+func (f *suffixFlag) Set(s string) error {
+	f.set = true
+	if s != "true" {
+		f.suffix = s
+	}
+	return nil
+}
+
+func (f *suffixFlag) IsBoolFlag() bool { return true }
+
+// suffixArgs rewrites -iSUFFIX as -i=SUFFIX for the flag package, for
+// suffixes that do not start with a letter, so that flags such as
+// -include keep their meaning.
+func suffixArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			copy(out[i:], args[i:])
+			break
+		}
+		if strings.HasPrefix(arg, "-i") && len(arg) > 2 && arg[2] != '=' && !unicode.IsLetter(rune(arg[2])) {
+			arg = "-i=" + arg[2:]
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// stringsFlag is a flag that may be given several times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEditFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envsubst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("ENVSUBST_TEST_HOST", "db")
+	defer os.Unsetenv("ENVSUBST_TEST_HOST")
+
+	name := filepath.Join(dir, "app.conf")
+	orig := "host=${ENVSUBST_TEST_HOST}\nport=${ENVSUBST_TEST_PORT:-5432}\n"
+	if err := ioutil.WriteFile(name, []byte(orig), 0640); err != nil {
+		t.Fatal(err)
+	}
+	n, err := editFile(name, ".bak")
+	if err != nil || n != 2 {
+		t.Fatalf("Want 2 substitutions, got %d, %v", n, err)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "host=db\nport=5432\n" {
+		t.Errorf("Want the file expanded, got %q", b)
+	}
+	if b, _ := ioutil.ReadFile(name + ".bak"); string(b) != orig {
+		t.Errorf("Want the backup to hold the original, got %q", b)
+	}
+	for _, name := range []string{name, name + ".bak"} {
+		if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0640 {
+			t.Errorf("Want %s to keep its permissions, got %v, %v", name, info.Mode(), err)
+		}
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Want no temporary file left, got %d entries", len(entries))
+	}
+
+	link := filepath.Join(dir, "link.conf")
+	if err := os.Symlink(name, link); err == nil {
+		ioutil.WriteFile(name, []byte(orig), 0640)
+		if _, err := editFile(link, ""); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Want the link kept, got %v, %v", info, err)
+		}
+		if b, _ := ioutil.ReadFile(name); string(b) != "host=db\nport=5432\n" {
+			t.Errorf("Want the link target expanded, got %q", b)
+		}
+	}
+}
+
+func TestSuffixArgs(t *testing.T) {
+	got := suffixArgs([]string{"-i.bak", "-i", "-i~", "-include", "--", "-i.orig"})
+	want := []string{"-i=.bak", "-i", "-i=~", "-include", "--", "-i.orig"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+}
+
+func TestMirrorPath(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"app.conf", filepath.Join("out", "app.conf")},
+		{filepath.Join("a", "app.conf"), filepath.Join("out", "a", "app.conf")},
+		{filepath.Join("b", ".", "app.conf"), filepath.Join("out", "b", "app.conf")},
+		{filepath.Join("..", "app.conf"), filepath.Join("out", "app.conf")},
+	}
+	if abs, err := filepath.Abs("app.conf"); err == nil {
+		tests = append(tests, struct{ name, want string }{abs, filepath.Join("out", "app.conf")})
+	}
+	for _, test := range tests {
+		if got := mirrorPath("out", test.name); got != test.want {
+			t.Errorf("Want %s mirrored to %s, got %s", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gomodules.xyz/envsubst"
+)
+
+// stats counts the files processed in recursive mode.
+type stats struct {
+	files, substitutions, copied int
+}
+
+// add counts the results of envsubst.RenderDir.
+func (st *stats) add(results []envsubst.FileResult) {
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+		case r.Copied:
+			st.copied++
+		default:
+			st.files++
+			st.substitutions += r.Substitutions
+		}
+	}
+}
+
+// renderTree renders the regular files under root with
+// envsubst.RenderDir, selecting them with the Include and Exclude
+// options of opts and skipping binary files. If outDir is empty, the
+// files rendered are replaced in place, saving the original files with
+// suffix appended unless it is empty, once the whole tree has been
+// rendered. Otherwise the tree is mirrored to the same paths under
+// outDir, the files not rendered being copied unchanged.
+func renderTree(root, outDir string, opts []envsubst.Option, suffix string, st *stats) error {
+	opts = append(opts[:len(opts):len(opts)], envsubst.SkipBinary())
+	if outDir != "" {
+		if within(outDir, root) {
+			return errors.New("the output directory is inside the source tree")
+		}
+		results, err := envsubst.RenderDir(context.Background(), os.DirFS(root), outDir, os.Getenv, opts...)
+		st.add(results)
+		return err
+	}
+
+	tmp, err := ioutil.TempDir("", "envsubst")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	results, err := envsubst.RenderDir(context.Background(), os.DirFS(root), tmp, os.Getenv, opts...)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Copied {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(tmp, filepath.FromSlash(r.Path)))
+		if err != nil {
+			return err
+		}
+		if err := replaceFile(filepath.Join(root, filepath.FromSlash(r.Path)), data, suffix); err != nil {
+			return err
+		}
+	}
+	st.add(results)
+	return nil
+}
+
+// within reports whether name is the directory dir or is under it.
+func within(name, dir string) bool {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,20 @@
+//go:build !go1.16
+// +build !go1.16
+
+package main
+
+import (
+	"errors"
+
+	"gomodules.xyz/envsubst"
+)
+
+// stats counts the files processed in recursive mode.
+type stats struct {
+	files, substitutions, copied int
+}
+
+// renderTree fails before Go 1.16, which envsubst.RenderDir requires.
+func renderTree(root, outDir string, opts []envsubst.Option, suffix string, st *stats) error {
+	return errors.New("-r requires Go 1.16 or later")
+}
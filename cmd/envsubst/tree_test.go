@@ -0,0 +1,106 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gomodules.xyz/envsubst"
+)
+
+func TestEditTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envsubst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("ENVSUBST_TEST_HOST", "db")
+	defer os.Unsetenv("ENVSUBST_TEST_HOST")
+
+	files := map[string]string{
+		"app.yaml":            "host: ${ENVSUBST_TEST_HOST}\n",
+		"conf/db.yaml":        "url: ${ENVSUBST_TEST_HOST}/${ENVSUBST_TEST_HOST}\n",
+		"conf/logo.yaml":      "\x00${ENVSUBST_TEST_HOST}",
+		"conf/readme.txt":     "${ENVSUBST_TEST_HOST}",
+		"vendor/lib/x.yaml":   "${ENVSUBST_TEST_HOST}",
+		"vendor/lib/y/z.yaml": "${ENVSUBST_TEST_HOST}",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var st stats
+	opts := []envsubst.Option{envsubst.Include("*.yaml"), envsubst.Exclude("vendor/**")}
+	if err := renderTree(dir, "", opts, ".bak", &st); err != nil {
+		t.Fatal(err)
+	}
+	if want := (stats{files: 2, substitutions: 3, copied: 4}); st != want {
+		t.Errorf("Want %+v, got %+v", want, st)
+	}
+	want := map[string]string{
+		"app.yaml":            "host: db\n",
+		"conf/db.yaml":        "url: db/db\n",
+		"conf/logo.yaml":      files["conf/logo.yaml"],
+		"conf/readme.txt":     files["conf/readme.txt"],
+		"vendor/lib/x.yaml":   files["vendor/lib/x.yaml"],
+		"vendor/lib/y/z.yaml": files["vendor/lib/y/z.yaml"],
+	}
+	for name, content := range want {
+		if b, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); string(b) != content {
+			t.Errorf("Want %q for %s, got %q", content, name, b)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "conf", "db.yaml.bak")); string(b) != files["conf/db.yaml"] {
+		t.Errorf("Want the backup to hold the original, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf", "readme.txt.bak")); !os.IsNotExist(err) {
+		t.Errorf("Want no backup of the files left unchanged, got %v", err)
+	}
+}
+
+func TestRenderTreeOutputDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envsubst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("ENVSUBST_TEST_HOST", "db")
+	defer os.Unsetenv("ENVSUBST_TEST_HOST")
+
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "conf", "db.yaml"), []byte("host: ${ENVSUBST_TEST_HOST}\n"), 0600)
+	ioutil.WriteFile(filepath.Join(src, "run.sh"), []byte("echo ${ENVSUBST_TEST_HOST}\n"), 0755)
+	opts := []envsubst.Option{envsubst.Include("*.yaml")}
+	var st stats
+	if err := renderTree(src, filepath.Join(src, "out"), opts, "", &st); err == nil {
+		t.Errorf("Want an error for an output directory inside the source tree")
+	}
+	out := filepath.Join(dir, "out")
+	if err := renderTree(src, out, opts, "", &st); err != nil {
+		t.Fatal(err)
+	}
+	if want := (stats{files: 1, substitutions: 1, copied: 1}); st != want {
+		t.Errorf("Want %+v, got %+v", want, st)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(out, "conf", "db.yaml")); string(b) != "host: db\n" {
+		t.Errorf("Want the file rendered, got %q", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(src, "conf", "db.yaml")); string(b) != "host: ${ENVSUBST_TEST_HOST}\n" {
+		t.Errorf("Want the source unchanged, got %q", b)
+	}
+	info, err := os.Stat(filepath.Join(out, "run.sh"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Want the script copied with its permissions, got %v, %v", info, err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(out, "run.sh")); string(b) != "echo ${ENVSUBST_TEST_HOST}\n" {
+		t.Errorf("Want the script copied unchanged, got %q", b)
+	}
+}
@@ -0,0 +1,77 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RenderCompose reads the Docker Compose file at path and returns it
+// with variables substituted as docker compose config does:
+//
+//   - $VAR and ${VAR} are replaced by the value of VAR, or by the empty
+//     string if it is undefined.
+//   - ${VAR:-default} and ${VAR:?message} are supported, the latter
+//     failing with a RequiredVarError if VAR is undefined or empty.
+//   - $$ is a literal $.
+//
+// Variables are resolved from the providers in order, or from the
+// environment if none are given, and then from the .env file in the
+// directory of the compose file, if there is one. As in docker compose,
+// the env_file entries of services only define the environment of their
+// containers and are not used for substitution. Values are escaped for
+// the YAML context they land in, as EvalYAML does.
+func RenderCompose(path string, providers ...Provider) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if len(providers) == 0 {
+		providers = []Provider{Env()}
+	}
+	dotenv, err := LoadDotenv(filepath.Join(filepath.Dir(path), ".env"))
+	switch {
+	case err == nil:
+		providers = append(providers[:len(providers):len(providers)], dotenv)
+	case !os.IsNotExist(err):
+		return "", err
+	}
+	return EvalYAML(braceNames(string(b)), Chain(providers...))
+}
+
+// braceNames rewrites the $VAR references of the string as ${VAR}.
+func braceNames(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			j := skipReference(s, i)
+			b.WriteString(s[i:j])
+			i = j
+		case strings.HasPrefix(s[i:], "$$"):
+			b.WriteString("$$")
+			i += 2
+		case s[i] == '$' && i+1 < len(s) && isNameByte(s[i+1], true):
+			j := i + 2
+			for j < len(s) && isNameByte(s[j], false) {
+				j++
+			}
+			b.WriteString("${" + s[i+1:j] + "}")
+			i = j
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// isNameByte reports whether c may appear in a $VAR name, at its start
+// if first is set.
+func isNameByte(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !first && c >= '0' && c <= '9'
+}
@@ -0,0 +1,66 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderCompose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	compose := `services:
+  web:
+    image: "nginx:${TAG:-latest}"
+    env_file: web.env
+    command: echo $$HOME $NAME-$PORT
+    ports:
+      - "${PORT}:80"
+    environment:
+      MSG: ${MSG}
+`
+	name := filepath.Join(dir, "compose.yaml")
+	if err := ioutil.WriteFile(name, []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("PORT=8080\nNAME=dotenv\nTAG=1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "web.env"), []byte("MSG=ignored\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RenderCompose(name, mapProvider{"NAME": "web", "MSG": "a: b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+  web:
+    image: "nginx:1.0"
+    env_file: web.env
+    command: echo $HOME web-8080
+    ports:
+      - "8080:80"
+    environment:
+      MSG: "a: b"
+`
+	if got != want {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+
+	compose = "services:\n  db:\n    image: ${IMAGE:?set IMAGE}\n"
+	if err := ioutil.WriteFile(name, []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = RenderCompose(name, mapProvider{})
+	var rerr *RequiredVarError
+	if !errors.As(err, &rerr) || rerr.Name != "IMAGE" || rerr.Message != "set IMAGE" {
+		t.Errorf("Want RequiredVarError for IMAGE, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package envsubst
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineEndingsAndBOM(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"name": "gopher", "crlf": "a\r\nb"}[s]
+	}
+	var tests = []struct {
+		input   string
+		output  string
+		options []Option
+	}{
+		{input: "a: ${name}\r\nb: ${missing:-x}\r\n", output: "a: gopher\r\nb: x\r\n"},
+		{input: "${crlf}\r\n$$\r\n\r\n", output: "a\r\nb\r\n$\r\n\r\n"},
+		{input: "$\r\n${name}\r", output: "$\r\ngopher\r"},
+		{input: bom + "a: ${name}\r\n", output: bom + "a: gopher\r\n"},
+		{input: bom + "a: ${name}\r\n", output: "a: gopher\r\n", options: []Option{StripBOM()}},
+		{input: "a" + bom + "${name}", output: "a" + bom + "gopher", options: []Option{StripBOM()}},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.input, mapping, test.options...)
+		if err != nil || got != test.output {
+			t.Errorf("Want %q evaluated to %q, got %q, %v", test.input, test.output, got, err)
+		}
+
+		r := NewReader(iotest.OneByteReader(strings.NewReader(test.input)), mapping, test.options...)
+		b, err := ioutil.ReadAll(r)
+		if err != nil || string(b) != test.output {
+			t.Errorf("Want %q read as %q, got %q, %v", test.input, test.output, b, err)
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf, mapping, test.options...)
+		for i := 0; i < len(test.input); i++ {
+			io.WriteString(w, test.input[i:i+1])
+		}
+		if err := w.Close(); err != nil || buf.String() != test.output {
+			t.Errorf("Want %q written as %q, got %q, %v", test.input, test.output, buf.String(), err)
+		}
+	}
+
+	var lines []string
+	input := bom + "${name}\r\n" + bom + "\r\n"
+	EvalLines(strings.NewReader(input), mapping, func(_ int, _, out string) error {
+		lines = append(lines, out)
+		return nil
+	}, StripBOM())
+	if len(lines) != 2 || lines[0] != "gopher" || lines[1] != bom {
+		t.Errorf("Want only the leading BOM stripped from lines, got %q", lines)
+	}
+}
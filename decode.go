@@ -0,0 +1,125 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// DecodeYAML unmarshals the YAML document data into the value pointed
+// to by v with the unmarshal function, such as yaml.Unmarshal, and
+// replaces ${var} in the strings of the result based on the mapping
+// function, as ExpandStruct does. Values of other types, such as numbers
+// and booleans, are decoded as written, and expanded values are never
+// reinterpreted: a string field holding "${PORT}" is expanded, while an
+// int field cannot hold it. A nil unmarshal decodes JSON, which YAML
+// includes.
+func DecodeYAML(data []byte, v interface{}, unmarshal func([]byte, interface{}) error, mapping func(string) string, opts ...Option) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("envsubst: DecodeYAML requires a non-nil pointer")
+	}
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	if err := unmarshal(data, v); err != nil {
+		return err
+	}
+	return newStructExpander(mapping, newOptions(opts)).expand(rv)
+}
+
+// JSONDecoder reads a stream of JSON tokens with a json.Decoder,
+// replacing ${var} in the strings as they are read, so that large
+// documents can be expanded without holding them in memory.
+type JSONDecoder struct {
+	dec     *json.Decoder
+	mapping func(string) string
+	options *options
+
+	// the open objects and arrays.
+	stack []jsonFrame
+}
+
+// jsonFrame is an object or array open in the stream.
+type jsonFrame struct {
+	object bool // an object rather than an array
+	key    bool // the object expects a key next
+}
+
+// NewJSONDecoder returns a decoder reading from r and replacing ${var}
+// in the strings based on the mapping function. Object keys are left
+// unchanged unless the ExpandKeys option is given.
+func NewJSONDecoder(r io.Reader, mapping func(string) string, opts ...Option) *JSONDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &JSONDecoder{dec: dec, mapping: mapping, options: newOptions(opts)}
+}
+
+// Token returns the next token of the stream, as json.Decoder.Token
+// does, with ${var} replaced in strings. Numbers are returned as
+// json.Number.
+func (d *JSONDecoder) Token() (json.Token, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{', '[':
+			d.stack = append(d.stack, jsonFrame{object: tok == '{', key: tok == '{'})
+		case '}', ']':
+			d.stack = d.stack[:len(d.stack)-1]
+			d.value()
+		}
+		return tok, nil
+	case string:
+		if d.key() {
+			d.stack[len(d.stack)-1].key = false
+			if !d.options.keys {
+				return tok, nil
+			}
+		} else {
+			d.value()
+		}
+		return evalWith(tok, funcProvider(d.mapping), d.options)
+	}
+	d.value()
+	return tok, nil
+}
+
+// More reports whether there is another element in the current array or
+// object being parsed.
+func (d *JSONDecoder) More() bool {
+	return d.dec.More()
+}
+
+// Decode reads the next JSON value into the value pointed to by v, as
+// json.Decoder.Decode does, and replaces ${var} in its strings as
+// ExpandStruct does. It may be mixed with calls to Token, for instance
+// to decode the elements of a large array one at a time.
+func (d *JSONDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("envsubst: Decode requires a non-nil pointer")
+	}
+	if err := d.dec.Decode(v); err != nil {
+		return err
+	}
+	d.value()
+	return newStructExpander(d.mapping, d.options).expand(rv)
+}
+
+// key reports whether the next token is the key of an object member.
+func (d *JSONDecoder) key() bool {
+	return len(d.stack) != 0 && d.stack[len(d.stack)-1].key
+}
+
+// value records that a value was read, so that the enclosing object, if
+// any, expects a key next.
+func (d *JSONDecoder) value() {
+	if n := len(d.stack); n != 0 && d.stack[n-1].object {
+		d.stack[n-1].key = true
+	}
+}
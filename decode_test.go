@@ -0,0 +1,97 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	type config struct {
+		Host   string
+		Port   int
+		Debug  bool
+		Tags   []string
+		Extra  map[string]interface{}
+		Secret string `envsubst:"-"`
+	}
+	mapping := func(s string) string {
+		return map[string]string{"HOST": "db.local", "ENV": "prod"}[s]
+	}
+	data := []byte(`{
+		"Host": "${HOST}",
+		"Port": 5432,
+		"Debug": true,
+		"Tags": ["${ENV}", "db"],
+		"Extra": {"timeout": 30, "name": "${ENV}-db"},
+		"Secret": "${HOST}"
+	}`)
+	var got config
+	if err := DecodeYAML(data, &got, nil, mapping); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Host:   "db.local",
+		Port:   5432,
+		Debug:  true,
+		Tags:   []string{"prod", "db"},
+		Extra:  map[string]interface{}{"timeout": float64(30), "name": "prod-db"},
+		Secret: "${HOST}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %+v, got %+v", want, got)
+	}
+
+	if err := DecodeYAML(data, got, nil, mapping); err == nil {
+		t.Errorf("Want error for a non-pointer")
+	}
+}
+
+func TestJSONDecoder(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"HOST": "db.local", "KEY": "name"}[s]
+	}
+	input := `{"${KEY}": "${HOST}", "port": 5432, "tags": ["${HOST}", true, null], "nested": {"a": "${KEY}"}, "items": [{"h": "${HOST}"}]}`
+	var got []interface{}
+	dec := NewJSONDecoder(strings.NewReader(input), mapping)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+		if tok == "items" {
+			// decode the elements of the array one at a time.
+			if _, err := dec.Token(); err != nil {
+				t.Fatal(err)
+			}
+			for dec.More() {
+				var item map[string]string
+				if err := dec.Decode(&item); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, item["h"])
+			}
+		}
+	}
+	want := []interface{}{
+		json.Delim('{'), "${KEY}", "db.local", "port", json.Number("5432"),
+		"tags", json.Delim('['), "db.local", true, nil, json.Delim(']'),
+		"nested", json.Delim('{'), "a", "name", json.Delim('}'),
+		"items", "db.local", json.Delim(']'), json.Delim('}'),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %v, got %v", want, got)
+	}
+
+	dec = NewJSONDecoder(strings.NewReader(`{"${KEY}": 1}`), mapping, ExpandKeys())
+	dec.Token()
+	if tok, _ := dec.Token(); tok != "name" {
+		t.Errorf("Want expanded key, got %v", tok)
+	}
+}
@@ -0,0 +1,185 @@
+package envsubst
+
+import (
+	"errors"
+	"sort"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity string
+
+const (
+	// SeverityError marks a problem that fails execution.
+	SeverityError Severity = "error"
+	// SeverityWarning marks a suspicious construct that does not fail
+	// execution.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes identify the kind of a Diagnostic, in addition to
+// the Warning codes.
+const (
+	DiagBadSubstitution = "bad-substitution"
+	DiagUnterminated    = "unterminated"
+	DiagSyntax          = "syntax"
+	DiagLimit           = "limit"
+	DiagUndefined       = "undefined"
+	DiagUnexpanded      = "unexpanded"
+	DiagError           = "error"
+)
+
+// Position is a location in the input.
+type Position struct {
+	// Offset is the byte offset in the input.
+	Offset int `json:"offset"`
+	// Line and Column are 1-based, the column counted in characters.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func newPosition(s string, offset int) Position {
+	line, col, _ := position(s, offset)
+	return Position{Offset: offset, Line: line, Column: col}
+}
+
+// Range is a span of the input, End being exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is a problem found in a template, suitable for reporting
+// by tools such as editors and CI annotations.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	// Range locates the problem in the input. It is nil for problems
+	// that cannot be located, such as references left in the output.
+	Range *Range `json:"range,omitempty"`
+}
+
+// Diagnostics is a list of diagnostics, ordered by position in the
+// input, those that cannot be located last.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether any of the diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint parses and dry runs the template with the options, and returns
+// the problems found. Options decide how strict the check is: for
+// example references to undefined variables are only errors with
+// NoUnset, empty substitutions are warnings unless NoEmpty is given,
+// and suspicious syntax is only an error with StrictSyntax.
+func Lint(s string, p Provider, opts ...Option) Diagnostics {
+	t, err := Parse(s, opts...)
+	if err != nil {
+		return Diagnostics{parseDiagnostic(s, err)}
+	}
+
+	var diags Diagnostics
+	o := newOptions(opts)
+	collect := Warnings(func(w Warning) {
+		if o.warn != nil {
+			o.warn(w)
+		}
+		diag := Diagnostic{
+			Severity: SeverityWarning,
+			Code:     w.Code,
+			Message:  w.Message,
+			Range:    &Range{Start: newPosition(s, w.Pos), End: newPosition(s, w.End)},
+		}
+		if w.Code == WarnEmptyValue && o.noEmpty || o.promotes(w.Code) {
+			diag.Severity = SeverityError
+		}
+		diags = append(diags, diag)
+	})
+	_, err = t.DryRun(p, collect)
+
+	var merr *MissingVarError
+	var uerr *UnexpandedError
+	var werr *WarningError
+	switch {
+	case err == nil, o.noEmpty && errors.Is(err, ErrEmptyValue), errors.As(err, &werr):
+		// reported by the warnings
+	case errors.As(err, &merr):
+		for _, ref := range merr.Refs {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Code:     DiagUndefined,
+				Message:  newMissingVarError([]VarRef{ref}).Error(),
+				Range: &Range{
+					Start: newPosition(s, ref.Offset),
+					End:   newPosition(s, refEnd(t.tree.Root, ref.Offset)),
+				},
+			})
+		}
+	case errors.As(err, &uerr):
+		diags = append(diags, Diagnostic{Severity: SeverityError, Code: DiagUnexpanded, Message: err.Error()})
+	default:
+		diags = append(diags, Diagnostic{Severity: SeverityError, Code: DiagError, Message: err.Error()})
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Range, diags[j].Range
+		return a != nil && (b == nil || a.Start.Offset < b.Start.Offset)
+	})
+	return diags
+}
+
+// refEnd returns the end of the ${...} expression of the tree starting
+// at offset, or offset if there is none.
+func refEnd(node parse.Node, offset int) int {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, n := range node.Nodes {
+			if end := refEnd(n, offset); end != offset {
+				return end
+			}
+		}
+	case *parse.FuncNode:
+		if int(node.Pos) == offset {
+			return int(node.End)
+		}
+		for _, n := range node.Args {
+			if end := refEnd(n, offset); end != offset {
+				return end
+			}
+		}
+	}
+	return offset
+}
+
+// parseDiagnostic returns the diagnostic for an error returned by
+// Parse.
+func parseDiagnostic(s string, err error) Diagnostic {
+	diag := Diagnostic{Severity: SeverityError, Code: DiagError, Message: err.Error()}
+	offset := -1
+	switch err := err.(type) {
+	case *ParseError:
+		offset = err.Offset
+		diag.Code = DiagBadSubstitution
+		switch err.Err.(type) {
+		case *parse.UnterminatedError:
+			diag.Code = DiagUnterminated
+		case *parse.SyntaxError:
+			diag.Code = DiagSyntax
+		}
+	case *LimitError:
+		offset = int(err.Pos)
+		diag.Code = DiagLimit
+	}
+	if offset >= 0 {
+		pos := newPosition(s, offset)
+		diag.Range = &Range{Start: pos, End: pos}
+	}
+	return diag
+}
@@ -0,0 +1,67 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	params := mapProvider{"host": "db", "empty": ""}
+
+	var tests = []struct {
+		input   string
+		options []Option
+		codes   []string
+		errors  bool
+	}{
+		{input: "${host}"},
+		{input: "${host", codes: []string{DiagUnterminated}, errors: true},
+		{input: "${host,,,}", codes: []string{DiagBadSubstitution}, errors: true},
+		{input: "cost $ ${host}", options: []Option{StrictSyntax()}, codes: []string{DiagSyntax}, errors: true},
+		{input: "${a}${b}", options: []Option{MaxExpressions(1)}, codes: []string{DiagLimit}, errors: true},
+		{input: "${empty} $HOME", codes: []string{WarnEmptyValue, WarnBareDollar}},
+		{input: "${empty}", options: []Option{NoEmpty()}, codes: []string{WarnEmptyValue}, errors: true},
+		{input: "${a} ${b}", options: []Option{NoUnset()}, codes: []string{DiagUndefined, DiagUndefined}, errors: true},
+		{input: "${a}", options: []Option{KeepUnresolved(), NoUnexpanded()}, codes: []string{DiagUnexpanded}, errors: true},
+	}
+
+	for _, test := range tests {
+		diags := Lint(test.input, params, test.options...)
+		var codes []string
+		for _, diag := range diags {
+			codes = append(codes, diag.Code)
+		}
+		if len(codes) != len(test.codes) {
+			t.Errorf("Want codes %q for %q, got %q", test.codes, test.input, codes)
+			continue
+		}
+		for i := range codes {
+			if codes[i] != test.codes[i] {
+				t.Errorf("Want codes %q for %q, got %q", test.codes, test.input, codes)
+				break
+			}
+		}
+		if diags.HasErrors() != test.errors {
+			t.Errorf("Want HasErrors %v for %q", test.errors, test.input)
+		}
+	}
+}
+
+func TestDiagnosticsJSON(t *testing.T) {
+	diags := Lint("a: ${a}\nb: ${b}", mapProvider{"a": "1"}, NoUnset())
+	b, err := json.Marshal(diags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"severity":"error","code":"undefined","message":"input/default value not found for key b at line 2, column 4 near \"a: ${a}\\nb: ${b}\"",` +
+		`"range":{"start":{"offset":11,"line":2,"column":4},"end":{"offset":15,"line":2,"column":8}}}]`
+	if string(b) != want {
+		t.Errorf("Want JSON\n%s\ngot\n%s", want, b)
+	}
+
+	for _, diag := range Lint("x=${x:-${b}}", mapProvider{}, NoUnset()) {
+		if diag.Code == DiagUndefined && (diag.Range.Start.Offset != 7 || diag.Range.End.Offset != 11) {
+			t.Errorf("Want the nested reference underlined, got %+v", *diag.Range)
+		}
+	}
+}
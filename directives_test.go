@@ -0,0 +1,74 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDirectives(t *testing.T) {
+	input := `name: ${NAME}
+script: |
+  # envsubst:off
+  for f in ${FILES}; do echo "$${f}" \; done
+  # envsubst:on
+port: ${PORT}
+`
+	want := `name: web
+script: |
+  # envsubst:off
+  for f in ${FILES}; do echo "$${f}" \; done
+  # envsubst:on
+port: 8080
+`
+	values := map[string]string{"NAME": "web", "PORT": "8080", "FILES": "oops"}
+	mapping := func(s string) string { return values[s] }
+
+	got, err := Eval(input, mapping, Directives())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping, Directives()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("Want %q streamed, got %q", want, b)
+	}
+
+	var lines []string
+	err = EvalLines(strings.NewReader(input), mapping, func(_ int, _, out string) error {
+		lines = append(lines, out+"\n")
+		return nil
+	}, Directives())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines, ""); got != want {
+		t.Errorf("Want %q by line, got %q", want, got)
+	}
+
+	if got, _ := Eval(input, mapping); got == want {
+		t.Errorf("Want directives ignored without the option")
+	}
+}
+
+func TestDirectivesStreamMultiline(t *testing.T) {
+	mapping := func(s string) string { return map[string]string{"b": "value"}[s] }
+	for _, input := range []string{
+		"x: ${a:-one\ntwo} y: z\n",
+		"${b# envsubst:off\n} ${a:-\n# envsubst:off\n}\nend",
+		"# envsubst:off\n${a:-\n}\n# envsubst:on\n${a:-x\ny}",
+	} {
+		want, werr := Eval(input, mapping, Directives())
+		b, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping, Directives()))
+		if (err == nil) != (werr == nil) || werr == nil && string(b) != want {
+			t.Errorf("Want %q, %v streamed from %q like Eval, got %q, %v", want, werr, input, b, err)
+		}
+	}
+}
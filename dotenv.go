@@ -0,0 +1,345 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// DotenvError reports a malformed entry of a .env file.
+type DotenvError struct {
+	// File is the name of the file, if known.
+	File string
+	// Line is the line of the entry, starting at 1.
+	Line int
+	Err  error
+}
+
+func (e *DotenvError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DotenvError) Unwrap() error {
+	return e.Err
+}
+
+// ReadDotenv parses the variables of a .env file from r. Each entry is a
+// KEY=value line, optionally preceded by export. Blank lines and lines
+// starting with # are ignored. Values may be:
+//
+//   - unquoted: surrounding blanks and any comment starting with a blank
+//     followed by # are removed.
+//   - single-quoted: taken literally and may span several lines.
+//   - double-quoted: the escapes \n, \r, \t, \", \\ and \$ are replaced
+//     and they may span several lines.
+//
+// References to ${var} in unquoted and double-quoted values are
+// replaced by the values of the entries before them, according to the
+// options.
+func ReadDotenv(r io.Reader, opts ...Option) (map[string]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make(mapProvider)
+	if _, err := parseDotenv(string(b), values, nil, newOptions(opts)); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// LoadDotenv reads the named .env file, see ReadDotenv, and returns a
+// provider serving its variables.
+func LoadDotenv(name string, opts ...Option) (Provider, error) {
+	values := make(mapProvider)
+	if _, err := loadDotenv(name, values, newOptions(opts)); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DotenvFiles serves the variables of several .env files, the files
+// loaded later taking precedence. It records which file supplied each
+// variable.
+type DotenvFiles struct {
+	values  mapProvider
+	sources map[string]string
+}
+
+// LoadDotenvFiles reads the named .env files in order, see ReadDotenv.
+// A variable defined by several files takes its value from the last
+// one, so that files are listed from the most general to the most
+// specific, e.g. .env, .env.production, .env.local. References in a
+// file are replaced by the values of the entries before them, in the
+// same file or an earlier one. Files that do not exist are skipped.
+func LoadDotenvFiles(names []string, opts ...Option) (*DotenvFiles, error) {
+	o := newOptions(opts)
+	f := &DotenvFiles{values: make(mapProvider), sources: make(map[string]string)}
+	for _, name := range names {
+		entries, err := loadDotenv(name, f.values, o)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			f.sources[e.key] = name
+		}
+	}
+	return f, nil
+}
+
+// Lookup retrieves the value of the named variable from the last file
+// defining it.
+func (f *DotenvFiles) Lookup(key string) (string, bool, error) {
+	return f.values.Lookup(key)
+}
+
+// Keys returns the sorted names of the variables defined by the files.
+func (f *DotenvFiles) Keys() []string {
+	return f.values.Keys()
+}
+
+// Source returns the name of the file that supplied the value of the
+// named variable. The boolean reports whether the variable is defined.
+func (f *DotenvFiles) Source(key string) (string, bool) {
+	name, ok := f.sources[key]
+	return name, ok
+}
+
+// loadDotenv reads the named .env file into values, see parseDotenv.
+func loadDotenv(name string, values mapProvider, o *options) ([]dotenvEntry, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseDotenv(string(b), values, nil, o)
+	if derr, ok := err.(*DotenvError); ok {
+		derr.File = name
+	}
+	return entries, err
+}
+
+// dotenvEntry is a variable defined by a .env file.
+type dotenvEntry struct {
+	key   string
+	value string
+	line  int
+}
+
+// dotenvParser parses the entries of a .env file.
+type dotenvParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+// parseDotenv returns the entries of the .env file s in order, with
+// their values expanded according to the options, and sets them in
+// values. References are resolved from values, then from fallback if
+// it is not nil.
+func parseDotenv(s string, values mapProvider, fallback Provider, o *options) ([]dotenvEntry, error) {
+	var lookup Provider = values
+	if fallback != nil {
+		lookup = chain{values, fallback}
+	}
+	p := &dotenvParser{s: s, line: 1}
+	var entries []dotenvEntry
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return entries, nil
+		}
+		line := p.line
+		if p.s[p.pos] == '#' {
+			p.skipLine()
+			continue
+		}
+		key, tmpl, err := p.entry()
+		if err != nil {
+			return nil, &DotenvError{Line: line, Err: err}
+		}
+		v, err := evalWith(tmpl, lookup, o)
+		if err != nil {
+			return nil, &DotenvError{Line: line, Err: err}
+		}
+		values[key] = v
+		entries = append(entries, dotenvEntry{key: key, value: v, line: line})
+	}
+}
+
+// entry parses a KEY=value entry, returning the key and the value as a
+// template.
+func (p *dotenvParser) entry() (key, tmpl string, err error) {
+	if strings.HasPrefix(p.s[p.pos:], "export") && p.pos+6 < len(p.s) && isBlank(p.s[p.pos+6]) {
+		p.pos += 6
+		p.skipBlanks()
+	}
+	start := p.pos
+	for p.pos < len(p.s) && isDotenvKey(p.s[p.pos], p.pos == start) {
+		p.pos++
+	}
+	key = p.s[start:p.pos]
+	if key == "" {
+		return "", "", fmt.Errorf("invalid variable name at %s", quote(p.rest()))
+	}
+	p.skipBlanks()
+	if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+		return "", "", fmt.Errorf("missing = after %s", key)
+	}
+	p.pos++
+	p.skipBlanks()
+
+	if p.pos < len(p.s) && (p.s[p.pos] == '\'' || p.s[p.pos] == '"') {
+		if p.s[p.pos] == '\'' {
+			tmpl, err = p.singleQuoted()
+		} else {
+			tmpl, err = p.doubleQuoted()
+		}
+		if err != nil {
+			return "", "", err
+		}
+		p.skipBlanks()
+		switch {
+		case p.pos >= len(p.s) || p.s[p.pos] == '\n' || p.s[p.pos] == '\r':
+		case p.s[p.pos] == '#':
+			p.skipLine()
+		default:
+			return "", "", fmt.Errorf("unexpected %s after quoted value of %s", quote(p.rest()), key)
+		}
+		return key, tmpl, nil
+	}
+
+	start = p.pos
+	p.skipLine()
+	v := p.s[start:p.pos]
+	for i := 1; i < len(v); i++ {
+		if v[i] == '#' && isBlank(v[i-1]) {
+			v = v[:i]
+			break
+		}
+	}
+	v = strings.TrimRight(v, " \t\r\n")
+	return key, strings.Replace(v, `\`, `\\`, -1), nil
+}
+
+// singleQuoted returns the literal value of a single-quoted string as
+// a template.
+func (p *dotenvParser) singleQuoted() (string, error) {
+	p.pos++
+	i := strings.IndexByte(p.s[p.pos:], '\'')
+	if i < 0 {
+		return "", errors.New("unterminated single-quoted value")
+	}
+	v := p.s[p.pos : p.pos+i]
+	p.line += strings.Count(v, "\n")
+	p.pos += i + 1
+	v = strings.Replace(v, `\`, `\\`, -1)
+	return strings.Replace(v, "$", "$$", -1), nil
+}
+
+// doubleQuoted returns the value of a double-quoted string, with its
+// escapes replaced, as a template.
+func (p *dotenvParser) doubleQuoted() (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\n':
+			p.line++
+		case '\\':
+			if p.pos+1 < len(p.s) {
+				p.pos++
+				switch p.s[p.pos] {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				case '"':
+					c = '"'
+				case '$':
+					b.WriteString("$$")
+					continue
+				case '\\':
+				default:
+					// not an escape, keep the backslash.
+					p.pos--
+				}
+			}
+			if c == '\\' {
+				b.WriteString(`\\`)
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", errors.New("unterminated double-quoted value")
+}
+
+// skipSpace skips blanks and line breaks.
+func (p *dotenvParser) skipSpace() {
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '\n':
+			p.line++
+		case ' ', '\t', '\r':
+		default:
+			return
+		}
+		p.pos++
+	}
+}
+
+// skipBlanks skips spaces and tabs.
+func (p *dotenvParser) skipBlanks() {
+	for p.pos < len(p.s) && isBlank(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+// skipLine skips to the end of the line, before the line break.
+func (p *dotenvParser) skipLine() {
+	if i := strings.IndexByte(p.s[p.pos:], '\n'); i >= 0 {
+		p.pos += i
+	} else {
+		p.pos = len(p.s)
+	}
+}
+
+// rest returns the rest of the line, for error messages.
+func (p *dotenvParser) rest() string {
+	end := p.pos
+	for end < len(p.s) && p.s[end] != '\n' && p.s[end] != '\r' {
+		end++
+	}
+	return p.s[p.pos:end]
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// isDotenvKey reports whether c may appear in a variable name, at its
+// start if first is set.
+func isDotenvKey(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		return true
+	case c >= '0' && c <= '9', c == '.', c == '-':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDotenv(t *testing.T) {
+	input := `# database settings
+export DB_HOST=localhost
+DB_PORT = 5432   # inline comment
+DB_URL=postgres://${DB_HOST}:${DB_PORT}/app
+PASSWORD='pa$$w#rd ${DB_HOST}'
+GREETING="hello\n\"${DB_HOST}\" \$HOME C:\\dir \d"
+MULTI="line one
+line two"
+RAW='first
+second'
+EMPTY=
+PATH_LIKE=C:\dir#not-a-comment
+CRLF=value` + "\r\n"
+
+	got, err := ReadDotenv(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DB_HOST":   "localhost",
+		"DB_PORT":   "5432",
+		"DB_URL":    "postgres://localhost:5432/app",
+		"PASSWORD":  "pa$$w#rd ${DB_HOST}",
+		"GREETING":  "hello\n\"localhost\" $HOME C:\\dir \\d",
+		"MULTI":     "line one\nline two",
+		"RAW":       "first\nsecond",
+		"EMPTY":     "",
+		"PATH_LIKE": `C:\dir#not-a-comment`,
+		"CRLF":      "value",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+}
+
+func TestReadDotenvErrors(t *testing.T) {
+	var tests = []struct {
+		input string
+		line  int
+		err   string
+	}{
+		{"A=1\n=2", 2, "line 2: invalid variable name at `=2`"},
+		{"A 1", 1, "line 1: missing = after A"},
+		{"A=1\nB='x\n\n", 2, "line 2: unterminated single-quoted value"},
+		{"A=\"x", 1, "line 1: unterminated double-quoted value"},
+		{"A='x' y", 1, "line 1: unexpected `y` after quoted value of A"},
+	}
+	for _, test := range tests {
+		_, err := ReadDotenv(strings.NewReader(test.input))
+		var derr *DotenvError
+		if !errors.As(err, &derr) || derr.Line != test.line || err.Error() != test.err {
+			t.Errorf("Want error %q for %q, got %v", test.err, test.input, err)
+		}
+	}
+
+	_, err := ReadDotenv(strings.NewReader("A=${B}"), NoUnset())
+	if !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want missing variable error, got %v", err)
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, ".env")
+	if err = ioutil.WriteFile(name, []byte("NAME=envsubst\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadDotenv(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := EvalProvider("${NAME}", p); err != nil || got != "envsubst" {
+		t.Errorf("Want envsubst, got %q, %v", got, err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("\nNAME\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDotenv(name); err == nil || err.Error() != name+":2: missing = after NAME" {
+		t.Errorf("Want error with file name, got %v", err)
+	}
+}
+
+func TestLoadDotenvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".env":            "HOST=localhost\nPORT=80\nURL=http://${HOST}:${PORT}\n",
+		".env.production": "HOST=example.com\nURL=https://${HOST}:${PORT}\n",
+		".env.local":      "PORT=8080\n",
+	}
+	var names []string
+	for _, name := range []string{".env", ".env.production", ".env.missing", ".env.local"} {
+		names = append(names, filepath.Join(dir, name))
+		if data, ok := files[name]; ok {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	f, err := LoadDotenvFiles(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		key, value, source string
+	}{
+		{"HOST", "example.com", ".env.production"},
+		{"PORT", "8080", ".env.local"},
+		{"URL", "https://example.com:80", ".env.production"},
+	}
+	for _, test := range tests {
+		v, ok, _ := f.Lookup(test.key)
+		source, _ := f.Source(test.key)
+		if !ok || v != test.value || source != filepath.Join(dir, test.source) {
+			t.Errorf("Want %s=%q from %s, got %q from %s", test.key, test.value, test.source, v, source)
+		}
+	}
+	if _, ok := f.Source("UNDEFINED"); ok {
+		t.Errorf("Want no source for undefined variable")
+	}
+	if got, want := f.Keys(), []string{"HOST", "PORT", "URL"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+}
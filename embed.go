@@ -0,0 +1,142 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"context"
+	"io/fs"
+)
+
+// RenderTemplates renders the templates of fsys, typically an embed.FS
+// holding files embedded with go:embed, and returns their content keyed
+// by slash-separated path. Only the files selected by the Include and
+// Exclude options are returned. With the NoUnset option, every template
+// is first checked with VerifyTemplates, so that no template is rendered
+// unless all of them can be.
+//
+// If any template fails, the error is a BatchError indexed by the
+// templates in lexical order of path, each wrapping an fs.PathError
+// naming the template.
+func RenderTemplates(fsys fs.FS, mapping func(string) string, opts ...Option) (map[string]string, error) {
+	o := newOptions(opts)
+	paths, err := templatePaths(fsys, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.noUnset {
+		if err := verifyTemplates(fsys, paths, mapping, opts); err != nil {
+			return nil, err
+		}
+	}
+	out := make(map[string]string, len(paths))
+	var batch BatchError
+	for i, name := range paths {
+		b, err := renderBytes(fsys, name, true, mapping, opts)
+		if err != nil {
+			batch = append(batch, &InputError{Index: i, Err: &fs.PathError{Op: "render", Path: name, Err: err}})
+			continue
+		}
+		out[name] = string(b)
+	}
+	if len(batch) != 0 {
+		return nil, batch
+	}
+	return out, nil
+}
+
+// MustRenderTemplates is like RenderTemplates but panics if a template
+// cannot be rendered. It simplifies rendering embedded templates into
+// global variables at startup.
+func MustRenderTemplates(fsys fs.FS, mapping func(string) string, opts ...Option) map[string]string {
+	out, err := RenderTemplates(fsys, mapping, opts...)
+	if err != nil {
+		panic("envsubst: RenderTemplates: " + err.Error())
+	}
+	return out
+}
+
+// RenderTemplatesTo renders the templates of fsys to the same paths
+// under dstDir, as RenderDir does. With the NoUnset option, every
+// template selected by the Include and Exclude options is first checked
+// with VerifyTemplates, so that nothing is written unless all of them
+// can be rendered.
+func RenderTemplatesTo(dstDir string, fsys fs.FS, mapping func(string) string, opts ...Option) error {
+	o := newOptions(opts)
+	if o.noUnset {
+		paths, err := templatePaths(fsys, o)
+		if err != nil {
+			return err
+		}
+		if err := verifyTemplates(fsys, paths, mapping, opts); err != nil {
+			return err
+		}
+	}
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, err := RenderDir(ctx, fsys, dstDir, mapping, opts...)
+	return err
+}
+
+// VerifyTemplates parses the templates of fsys selected by the Include
+// and Exclude options and checks that every variable they reference
+// without a default value is resolved by the mapping function, without
+// rendering them. The error is a BatchError as for RenderTemplates, each
+// wrapping the ParseError or MissingVarError of a template, which lists
+// all of its undefined variables.
+func VerifyTemplates(fsys fs.FS, mapping func(string) string, opts ...Option) error {
+	paths, err := templatePaths(fsys, newOptions(opts))
+	if err != nil {
+		return err
+	}
+	return verifyTemplates(fsys, paths, mapping, opts)
+}
+
+// verifyTemplates checks the templates at paths in fsys.
+func verifyTemplates(fsys fs.FS, paths []string, mapping func(string) string, opts []Option) error {
+	strict := append(opts[:len(opts):len(opts)], NoUnset())
+	var batch BatchError
+	for i, name := range paths {
+		err := verifyTemplate(fsys, name, mapping, strict)
+		if err != nil {
+			batch = append(batch, &InputError{Index: i, Err: &fs.PathError{Op: "verify", Path: name, Err: err}})
+		}
+	}
+	if len(batch) != 0 {
+		return batch
+	}
+	return nil
+}
+
+func verifyTemplate(fsys fs.FS, name string, mapping func(string) string, opts []Option) error {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	t, err := Parse(string(b), opts...)
+	if err != nil {
+		return err
+	}
+	defer t.Release()
+	_, err = t.DryRun(funcProvider(mapping), opts...)
+	return err
+}
+
+// templatePaths returns the paths of the regular files of fsys selected
+// by the Include and Exclude options, in lexical order as fs.WalkDir
+// visits them.
+func templatePaths(fsys fs.FS, o *options) ([]string, error) {
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && o.renders(name) {
+			paths = append(paths, name)
+		}
+		return nil
+	})
+	return paths, err
+}
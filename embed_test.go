@@ -0,0 +1,81 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	templates := fstest.MapFS{
+		"templates/app.conf":  {Data: []byte("host=${HOST}\nport=${PORT:-80}\n")},
+		"templates/db.conf":   {Data: []byte("url=${DB_URL}\n")},
+		"templates/README.md": {Data: []byte("${DOCS}")},
+	}
+	values := map[string]string{"HOST": "example.com"}
+	mapping := func(key string) string { return values[key] }
+
+	got, err := RenderTemplates(templates, mapping, Include("*.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"templates/app.conf": "host=example.com\nport=80\n",
+		"templates/db.conf":  "url=\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+
+	_, err = RenderTemplates(templates, mapping, Include("*.conf"), NoUnset())
+	var batch BatchError
+	var perr *fs.PathError
+	var merr *MissingVarError
+	if !errors.As(err, &batch) || len(batch) != 1 || !errors.As(batch[0], &perr) || perr.Path != "templates/db.conf" || !errors.As(batch[0], &merr) || merr.Name != "DB_URL" {
+		t.Errorf("Want the missing DB_URL of db.conf reported, got %v", err)
+	}
+	if err := VerifyTemplates(templates, mapping, Exclude("README.md")); !errors.As(err, &batch) || !errors.Is(batch[0], ErrMissingVar) {
+		t.Errorf("Want VerifyTemplates to report DB_URL, got %v", err)
+	}
+
+	values["DB_URL"] = "postgres://db"
+	if err := VerifyTemplates(templates, mapping, Exclude("README.md")); err != nil {
+		t.Errorf("Want all variables resolvable, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Want MustRenderTemplates to panic")
+			}
+		}()
+		MustRenderTemplates(templates, mapping, NoUnset())
+	}()
+
+	dir, err := ioutil.TempDir("", "embed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	delete(values, "DB_URL")
+	if err := RenderTemplatesTo(dir, templates, mapping, NoUnset(), Include("*.conf")); !errors.As(err, &batch) || !errors.Is(batch[0], ErrMissingVar) {
+		t.Errorf("Want RenderTemplatesTo to report DB_URL, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "templates", "app.conf")); !os.IsNotExist(err) {
+		t.Errorf("Want nothing written when verification fails, got %v", err)
+	}
+	values["DB_URL"] = "postgres://db"
+	if err := RenderTemplatesTo(dir, templates, mapping, NoUnset(), Include("*.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "templates", "db.conf")); err != nil || string(b) != "url=postgres://db\n" {
+		t.Errorf("Want db.conf rendered, got %q, %v", b, err)
+	}
+}
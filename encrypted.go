@@ -0,0 +1,69 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Decrypter decrypts the contents of an encrypted file, such as a file
+// encrypted with SOPS or age. The format is that of the plaintext,
+// dotenv, json or yaml, as some tools need it to decrypt.
+type Decrypter func(data []byte, format string) ([]byte, error)
+
+// LoadEncryptedDotenv reads the named encrypted .env file, decrypts it
+// with decrypt and returns a provider serving its variables, see
+// ReadDotenv. The plaintext is not written to disk.
+func LoadEncryptedDotenv(name string, decrypt Decrypter, opts ...Option) (Provider, error) {
+	b, err := readEncrypted(name, "dotenv", decrypt)
+	if err != nil {
+		return nil, err
+	}
+	values := make(mapProvider)
+	if _, err := parseDotenv(string(b), values, nil, newOptions(opts)); err != nil {
+		if derr, ok := err.(*DotenvError); ok {
+			derr.File = name
+		}
+		return nil, err
+	}
+	return values, nil
+}
+
+// LoadEncryptedValues reads the named encrypted values file, decrypts it
+// with decrypt and returns a provider serving its values, see Values.
+// The plaintext is decoded with unmarshal, e.g. yaml.Unmarshal, or as
+// JSON if unmarshal is nil. Files named *.yaml or *.yml are decrypted
+// as yaml and other files as json.
+func LoadEncryptedValues(name string, decrypt Decrypter, unmarshal func([]byte, interface{}) error) (Provider, error) {
+	format := "json"
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".yaml" || ext == ".yml" {
+		format = "yaml"
+	}
+	b, err := readEncrypted(name, format, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	var doc interface{}
+	if err := unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return Values(doc), nil
+}
+
+// readEncrypted reads and decrypts the named file.
+func readEncrypted(name, format string, decrypt Decrypter) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decrypt(b, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: decrypt: %v", name, err)
+	}
+	return plain, nil
+}
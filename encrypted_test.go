@@ -0,0 +1,95 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rot13 is a toy cipher standing in for SOPS or age.
+func rot13(data []byte, format string) ([]byte, error) {
+	if string(data) == "corrupt" {
+		return nil, errors.New("bad MAC")
+	}
+	out := make([]byte, len(data))
+	for i, c := range data {
+		switch {
+		case c >= 'a' && c <= 'z':
+			c = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			c = 'A' + (c-'A'+13)%26
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, plain string) string {
+		data, _ := rot13([]byte(plain), "")
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var formats []string
+	decrypt := func(data []byte, format string) ([]byte, error) {
+		formats = append(formats, format)
+		return rot13(data, format)
+	}
+
+	p, err := LoadEncryptedDotenv(write(".env.enc", "USER=admin\nURL=${USER}@db\n"), decrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EvalProvider("${URL}", p)
+	if want := "admin@db"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	p, err = LoadEncryptedValues(write("values.json", `{"db": {"user": "admin"}}`), decrypt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = EvalProvider("${db.user}", p, DottedNames())
+	if want := "admin"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	// a YAML decoder is supplied by the caller.
+	unmarshal := func(b []byte, v interface{}) error {
+		*v.(*interface{}) = map[string]interface{}{"raw": string(b)}
+		return nil
+	}
+	p, err = LoadEncryptedValues(write("values.yaml", "db: {}"), decrypt, unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := p.Lookup("raw"); !ok || v != "db: {}" {
+		t.Errorf("Want values decoded by unmarshal, got %q", v)
+	}
+	if want := []string{"dotenv", "json", "yaml"}; len(formats) != 3 || formats[0] != want[0] || formats[1] != want[1] || formats[2] != want[2] {
+		t.Errorf("Want formats %v, got %v", want, formats)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "corrupt.env"), []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEncryptedDotenv(filepath.Join(dir, "corrupt.env"), decrypt); err == nil {
+		t.Errorf("Want decryption error")
+	}
+	_, err = LoadEncryptedDotenv(write("bad.env", "USER admin\n"), decrypt)
+	if derr, ok := err.(*DotenvError); !ok || derr.File == "" || derr.Line != 1 {
+		t.Errorf("Want DotenvError with file and line, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+var (
+	// ErrBadSubstitution is matched by errors.Is for a ParseError caused
+	// by malformed ${...} syntax.
+	ErrBadSubstitution = parse.ErrBadSubstitution
+
+	// ErrMissingVar is matched by errors.Is for a MissingVarError.
+	ErrMissingVar = errors.New("variable not defined")
+
+	// ErrUnexpanded is matched by errors.Is for an UnexpandedError.
+	ErrUnexpanded = errors.New("unexpanded references in output")
+
+	// ErrEmptyValue is matched by errors.Is for the error returned when
+	// a substitution is empty under the NoEmpty option.
+	ErrEmptyValue = errors.New("substituted value empty")
+)
+
+// snippetLen is the number of bytes of input shown on each side of the
+// offset of an error.
+const snippetLen = 16
+
+// ParseError is returned when a template cannot be parsed.
+type ParseError struct {
+	// Offset is the byte offset in the input where the error was
+	// detected.
+	Offset int
+	// Line and Column are the 1-based line and column, counted in
+	// characters, corresponding to Offset.
+	Line, Column int
+	// Snippet is the input surrounding Offset.
+	Snippet string
+	// Err is the underlying error, such as ErrBadSubstitution.
+	Err error
+
+	// text of the line containing Offset, for Excerpt.
+	line string
+}
+
+func newParseError(s string, offset int, err error) *ParseError {
+	line, col, text := position(s, offset)
+	return &ParseError{
+		Offset:  offset,
+		Line:    line,
+		Column:  col,
+		Snippet: snippet(s, offset),
+		Err:     err,
+		line:    text,
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at line %d, column %d near %s", e.Err, e.Line, e.Column, quote(e.Snippet))
+}
+
+// Excerpt returns the line containing the error followed by a line
+// with a caret marking its column, for display to users.
+func (e *ParseError) Excerpt() string {
+	prefix := fmt.Sprintf("%d | ", e.Line)
+	return prefix + e.line + "\n" +
+		strings.Repeat(" ", len(prefix)-2) + "| " +
+		strings.Repeat(" ", e.Column-1) + "^"
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// VarRef locates a reference to a variable in the input.
+type VarRef struct {
+	// Name is the referenced variable.
+	Name string
+	// Offset is the byte offset of the reference in the input, or -1
+	// if unknown.
+	Offset int
+	// Line and Column are the 1-based line and column, counted in
+	// characters, corresponding to Offset.
+	Line, Column int
+	// Snippet is the input surrounding Offset.
+	Snippet string
+	// Suggestions lists the closest names defined by the provider, if
+	// it implements KeyLister.
+	Suggestions []string
+}
+
+func newVarRef(s, name string, offset int) VarRef {
+	line, col, _ := position(s, offset)
+	return VarRef{
+		Name:    name,
+		Offset:  offset,
+		Line:    line,
+		Column:  col,
+		Snippet: snippet(s, offset),
+	}
+}
+
+// addRef records the reference of the function node to its variable in
+// refs, unless the variable is already recorded at an earlier position.
+func addRef(refs []VarRef, text string, node *parse.FuncNode) []VarRef {
+	for i, ref := range refs {
+		if ref.Name == node.Param {
+			if int(node.Pos) < ref.Offset {
+				refs[i] = newVarRef(text, node.Param, int(node.Pos))
+			}
+			return refs
+		}
+	}
+	return append(refs, newVarRef(text, node.Param, int(node.Pos)))
+}
+
+// sortRefs sorts the references by position in the input, those with
+// an unknown position last.
+func sortRefs(refs []VarRef) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		a, b := refs[i].Offset, refs[j].Offset
+		return a >= 0 && (b < 0 || a < b)
+	})
+}
+
+// MissingVarError is returned when variables referenced without a
+// default value are undefined and the NoUnset option, or a policy
+// returning PolicyError, is in effect.
+type MissingVarError struct {
+	// Name is the first undefined variable.
+	Name string
+	// Names lists every undefined variable in order of reference.
+	Names []string
+	// Refs locates the first reference to each variable in Names.
+	Refs []VarRef
+}
+
+func newMissingVarError(refs []VarRef) *MissingVarError {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name
+	}
+	return &MissingVarError{Name: names[0], Names: names, Refs: refs}
+}
+
+func (e *MissingVarError) Error() string {
+	if len(e.Refs) == 1 {
+		ref := e.Refs[0]
+		msg := fmt.Sprintf("input/default value not found for key %s", ref.Name)
+		if ref.Offset >= 0 {
+			msg += fmt.Sprintf(" at line %d, column %d near %s", ref.Line, ref.Column, quote(ref.Snippet))
+		}
+		if len(ref.Suggestions) != 0 {
+			msg += "; did you mean " + strings.Join(ref.Suggestions, " or ") + "?"
+		}
+		return msg
+	}
+	if len(e.Names) <= 1 {
+		return fmt.Sprintf("input/default value not found for key %s", e.Name)
+	}
+	keys := make([]string, len(e.Names))
+	for i, name := range e.Names {
+		keys[i] = name
+		if i >= len(e.Refs) {
+			continue
+		}
+		var notes []string
+		if ref := e.Refs[i]; ref.Offset >= 0 {
+			notes = append(notes, fmt.Sprintf("line %d, column %d", ref.Line, ref.Column))
+		}
+		if ref := e.Refs[i]; len(ref.Suggestions) != 0 {
+			notes = append(notes, "did you mean "+strings.Join(ref.Suggestions, " or ")+"?")
+		}
+		if len(notes) != 0 {
+			keys[i] += " (" + strings.Join(notes, "; ") + ")"
+		}
+	}
+	return fmt.Sprintf("input/default value not found for keys %s", strings.Join(keys, ", "))
+}
+
+// Is reports whether target is ErrMissingVar.
+func (e *MissingVarError) Is(target error) bool {
+	return target == ErrMissingVar
+}
+
+// IsValueNotFoundError reports whether the error, or any error it wraps,
+// is a MissingVarError.
+func IsValueNotFoundError(v interface{}) bool {
+	err, ok := v.(error)
+	return ok && errors.Is(err, ErrMissingVar)
+}
+
+// RequiredVarError is returned when the variable of a ${var:?message}
+// reference is undefined or empty.
+type RequiredVarError struct {
+	Name string
+	// Message is the message of the reference, if any.
+	Message string
+}
+
+func (e *RequiredVarError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("required variable %s is missing a value", e.Name)
+	}
+	return fmt.Sprintf("required variable %s is missing a value: %s", e.Name, e.Message)
+}
+
+// Is reports whether target is ErrMissingVar.
+func (e *RequiredVarError) Is(target error) bool {
+	return target == ErrMissingVar
+}
+
+// UnexpandedError is returned with the NoUnexpanded option when the
+// output contains ${...} references.
+type UnexpandedError struct {
+	// Refs lists the references found in the output, in order.
+	Refs []string
+}
+
+func (e *UnexpandedError) Error() string {
+	return fmt.Sprintf("unexpanded references in output: %s", strings.Join(e.Refs, ", "))
+}
+
+// Is reports whether target is ErrUnexpanded.
+func (e *UnexpandedError) Is(target error) bool {
+	return target == ErrUnexpanded
+}
+
+type valueEmptyError struct {
+	keys []string
+}
+
+var _ error = &valueEmptyError{}
+
+func (e *valueEmptyError) Error() string {
+	if len(e.keys) == 1 {
+		return fmt.Sprintf("substituted value empty for key %s", e.keys[0])
+	}
+	return fmt.Sprintf("substituted value empty for keys %s", strings.Join(e.keys, ", "))
+}
+
+// Is reports whether target is ErrEmptyValue.
+func (e *valueEmptyError) Is(target error) bool {
+	return target == ErrEmptyValue
+}
+
+// IsValueEmptyError reports whether the error, or any error it wraps,
+// was caused by an empty substitution when evaluating with the NoEmpty
+// option.
+func IsValueEmptyError(v interface{}) bool {
+	err, ok := v.(error)
+	return ok && errors.Is(err, ErrEmptyValue)
+}
+
+// snippet returns the input surrounding the byte offset in s.
+func snippet(s string, offset int) string {
+	start, end := offset-snippetLen, offset+snippetLen
+	if start < 0 {
+		start = 0
+	}
+	if end > len(s) {
+		end = len(s)
+	}
+	for start > 0 && !utf8.RuneStart(s[start]) {
+		start--
+	}
+	for end < len(s) && !utf8.RuneStart(s[end]) {
+		end++
+	}
+	return s[start:end]
+}
+
+// position returns the 1-based line and column, counted in characters,
+// of the byte offset in s, together with the text of that line.
+func position(s string, offset int) (line, col int, text string) {
+	if offset > len(s) {
+		offset = len(s)
+	}
+	start := strings.LastIndexByte(s[:offset], '\n') + 1
+	end := strings.IndexByte(s[offset:], '\n')
+	if end < 0 {
+		end = len(s)
+	} else {
+		end += offset
+	}
+	line = strings.Count(s[:start], "\n") + 1
+	col = utf8.RuneCountInString(s[start:offset]) + 1
+	return line, col, strings.TrimSuffix(s[start:end], "\r")
+}
@@ -0,0 +1,144 @@
+package envsubst
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	var tests = []struct {
+		input        string
+		offset       int
+		line, column int
+		snippet      string
+	}{
+		{"${bad", 0, 1, 1, "${bad"},
+		{"some text before ${a,,b} and after", 23, 1, 24, "xt before ${a,,b} and after"},
+		{"a: 1\nb: ${b}\nc: ${c,,x}\n", 22, 3, 10, ": ${b}\nc: ${c,,x}\n"},
+		{"é: ${é,,x}", 11, 1, 10, "é: ${é,,x}"},
+	}
+
+	for _, test := range tests {
+		_, err := Eval(test.input, func(string) string { return "" })
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Want ParseError for %q, got %v", test.input, err)
+			continue
+		}
+		if !errors.Is(err, ErrBadSubstitution) {
+			t.Errorf("Want %v to match ErrBadSubstitution", err)
+		}
+		if perr.Offset != test.offset {
+			t.Errorf("Want offset %d for %q, got %d", test.offset, test.input, perr.Offset)
+		}
+		if perr.Line != test.line || perr.Column != test.column {
+			t.Errorf("Want line %d, column %d for %q, got %d, %d", test.line, test.column, test.input, perr.Line, perr.Column)
+		}
+		if perr.Snippet != test.snippet {
+			t.Errorf("Want snippet %q for %q, got %q", test.snippet, test.input, perr.Snippet)
+		}
+	}
+}
+
+func TestParseErrorExcerpt(t *testing.T) {
+	_, err := Parse("a: 1\nb: ${b,,x}\n")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Want ParseError, got %v", err)
+	}
+	want := "2 | b: ${b,,x}\n  |          ^"
+	if got := perr.Excerpt(); got != want {
+		t.Errorf("Want excerpt\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestParseErrorUnterminated(t *testing.T) {
+	_, err := Parse("a: ${a}\nb: ${b:-x\nc: 1\n")
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("Want ParseError, got %v", err)
+	}
+	want := "unterminated ${, missing closing } at line 2, column 4 near \"a: ${a}\\nb: ${b:-x\\nc: 1\\n\""
+	if err.Error() != want {
+		t.Errorf("Want error %q, got %q", want, err)
+	}
+	if !errors.Is(err, ErrBadSubstitution) {
+		t.Errorf("Want %v to match ErrBadSubstitution", err)
+	}
+}
+
+func TestParseErrorStrictSyntax(t *testing.T) {
+	input := "echo $ ${a}"
+	if got, err := Eval(input, func(string) string { return "x" }); err != nil || got != "echo $ x" {
+		t.Errorf("Want lone $ passed through, got %q, %v", got, err)
+	}
+	_, err := Eval(input, func(string) string { return "x" }, StrictSyntax())
+	perr, ok := err.(*ParseError)
+	if !ok || perr.Column != 6 {
+		t.Errorf("Want ParseError at column 6, got %v", err)
+	}
+}
+
+func TestMissingVarError(t *testing.T) {
+	_, err := EvalMap("${a} ${b}", map[string]string{})
+	var merr *MissingVarError
+	if !errors.As(err, &merr) {
+		t.Fatalf("Want MissingVarError, got %v", err)
+	}
+	if merr.Name != "a" || len(merr.Names) != 2 {
+		t.Errorf("Want missing a and b, got %q, %q", merr.Name, merr.Names)
+	}
+	if !errors.Is(err, ErrMissingVar) || !IsValueNotFoundError(err) {
+		t.Errorf("Want %v to match ErrMissingVar", err)
+	}
+
+	want := []VarRef{
+		{Name: "a", Offset: 0, Line: 1, Column: 1, Snippet: "${a} ${b}"},
+		{Name: "b", Offset: 5, Line: 1, Column: 6, Snippet: "${a} ${b}"},
+	}
+	if !reflect.DeepEqual(merr.Refs, want) {
+		t.Errorf("Want references %+v, got %+v", want, merr.Refs)
+	}
+
+	_, err = EvalMap("a: 1\nb: ${b}\n", map[string]string{})
+	if want := "input/default value not found for key b at line 2, column 4 near \"a: 1\\nb: ${b}\\n\""; err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+
+	wrapped := &InputError{Index: 1, Err: err}
+	if !IsValueNotFoundError(wrapped) {
+		t.Errorf("Want IsValueNotFoundError to see through wrapping")
+	}
+	if IsValueNotFoundError("not an error") {
+		t.Errorf("Want IsValueNotFoundError false for non-errors")
+	}
+
+	_, err = EvalMap("${a}", map[string]string{"a": ""}, NoEmpty())
+	if !errors.Is(err, ErrEmptyValue) || errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want %v to match ErrEmptyValue only", err)
+	}
+}
+
+func TestRequiredVarError(t *testing.T) {
+	values := mapProvider{"a": "1", "empty": "", "msg": "set b"}
+	got, err := EvalProvider("${a:?unused}", values)
+	if err != nil || got != "1" {
+		t.Errorf("Want 1, got %q, %v", got, err)
+	}
+
+	for _, input := range []string{"${b:?${msg}}", "${empty:?${msg}}"} {
+		_, err = EvalProvider(input, values)
+		var rerr *RequiredVarError
+		if !errors.As(err, &rerr) || rerr.Message != "set b" {
+			t.Errorf("Want RequiredVarError for %q, got %v", input, err)
+		}
+		if !IsValueNotFoundError(err) {
+			t.Errorf("Want %v to match ErrMissingVar", err)
+		}
+	}
+
+	_, err = EvalProvider("${b:?}", values)
+	if want := "required variable b is missing a value"; err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+}
@@ -1,50 +1,116 @@
 package envsubst
 
-import "os"
+import (
+	"strconv"
+	"strings"
+)
 
 // Eval replaces ${var} in the string based on the mapping function.
-func Eval(s string, mapping func(string) string) (string, error) {
-	t, err := Parse(s)
-	if err != nil {
+// The mapping function cannot distinguish an undefined variable from an
+// empty one, so empty values are treated as undefined.
+func Eval(s string, mapping func(string) string, opts ...Option) (string, error) {
+	return EvalProvider(s, funcProvider(mapping), opts...)
+}
+
+// EvalProvider replaces ${var} in the string, resolving variables with
+// the provider.
+func EvalProvider(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) && frontmatterLen(s) <= 0 {
+		return s, nil
+	}
+	o := newOptions(opts)
+	if err := applyModeline(s, o); err != nil {
 		return s, err
 	}
-	// convert mapping to match new mapper function
-	mapper := func(node string, key string, args []string) (string, []string, error) {
-		return mapping(key), args, nil
+	return evalWith(s, p, o)
+}
+
+// evalWith replaces ${var} in the string, resolving variables with the
+// provider according to the options.
+func evalWith(s string, p Provider, o *options) (string, error) {
+	t, err := parseTemplate(s, o)
+	if err != nil {
+		return s, err
 	}
-	return t.Execute(mapper)
+	return t.execute(p, o)
 }
 
 // EvalEnv replaces ${var} in the string according to the values of the
 // current environment variables. References to undefined variables are
 // replaced by the empty string.
-func EvalEnv(s string) (string, error) {
-	return Eval(s, os.Getenv)
+func EvalEnv(s string, opts ...Option) (string, error) {
+	return EvalProvider(s, envProvider{}, opts...)
 }
 
-func EvalMap(s string, values map[string]string) (string, error) {
-	if values == nil {
-		values = make(map[string]string)
+// EvalEnvWithOverrides is like EvalEnv but resolves variables from the
+// overrides map first, falling back to the current environment. The
+// process environment is not modified.
+func EvalEnvWithOverrides(s string, overrides map[string]string, opts ...Option) (string, error) {
+	return EvalProvider(s, Chain(mapProvider(overrides), envProvider{}), opts...)
+}
+
+// MustEval is like Eval but panics if the string cannot be evaluated.
+// It simplifies safe initialization of global variables holding
+// expanded strings.
+func MustEval(s string, mapping func(string) string, opts ...Option) string {
+	v, err := Eval(s, mapping, opts...)
+	if err != nil {
+		panic(`envsubst: Eval(` + quote(s) + `): ` + err.Error())
 	}
-	mapper := func(node string, key string, args []string) (string, []string, error) {
-		v, ok := values[key]
-		// return error if key not found and default not specified
-		if !ok && !isDefault(node) {
-			return "", nil, &valueNotFoundError{key}
-		}
-		// if key found, remove args for default
-		// so that empty value will not be replaced by default value
-		if ok && isDefault(node) {
-			return v, nil, nil
+	return v
+}
+
+// MustEvalEnv is like EvalEnv but panics if the string cannot be
+// evaluated.
+func MustEvalEnv(s string, opts ...Option) string {
+	v, err := EvalEnv(s, opts...)
+	if err != nil {
+		panic(`envsubst: EvalEnv(` + quote(s) + `): ` + err.Error())
+	}
+	return v
+}
+
+// EvalEnvStrict is like EvalEnv but returns an error listing every
+// referenced environment variable that is undefined and has no default.
+func EvalEnvStrict(s string, opts ...Option) (string, error) {
+	return EvalEnv(s, append(opts, NoUnset())...)
+}
+
+// EvalMap replaces ${var} in the string according to the values in the
+// map. References to keys missing from the map without a default value
+// result in an error. Keys present in the map keep their value, even
+// empty, whatever the default form: unlike bash, ${var:-default} is the
+// empty string when var maps to it, unless the ColonDefaults option is
+// given. A default is only evaluated when it is used.
+func EvalMap(s string, values map[string]string, opts ...Option) (string, error) {
+	opts = append(append([]Option{keepEmpty()}, opts...), NoUnset())
+	return EvalProvider(s, mapProvider(values), opts...)
+}
+
+// isPlain reports whether s holds neither references nor escapes, and
+// neither a byte order mark an option could strip, so that it evaluates
+// to itself whatever the options.
+func isPlain(s string) bool {
+	return strings.IndexByte(s, '$') < 0 && strings.IndexByte(s, '\\') < 0 &&
+		!strings.HasPrefix(s, bom)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
-		return v, args, nil
 	}
+	return false
+}
 
-	t, err := Parse(s)
-	if err != nil {
-		return s, err
+// quote returns a Go-syntax quoted string, as regexp does for its
+// Must* panics.
+func quote(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
 	}
-	return t.Execute(mapper)
+	return strconv.Quote(s)
 }
 
 func isDefault(name string) bool {
@@ -55,3 +121,9 @@ func isDefault(name string) bool {
 		return false
 	}
 }
+
+// isColon reports whether the default function also applies to
+// variables that are defined but empty.
+func isColon(name string) bool {
+	return name == ":=" || name == ":-"
+}
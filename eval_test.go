@@ -1,6 +1,13 @@
 package envsubst
 
-import "testing"
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 // test cases sourced from tldp.org
 // http://www.tldp.org/LDP/abs/html/parameter-substitution.html
@@ -266,6 +273,30 @@ func TestEvalMap(t *testing.T) {
 			output:  "",
 			isError: false,
 		},
+		// an empty value is kept by the colon forms
+		{
+			params: map[string]string{
+				"abc": "",
+			},
+			input:   "${abc:-pqr} ${abc:=pqr}",
+			output:  " ",
+			isError: false,
+		},
+		// defaults are only evaluated when used
+		{
+			params: map[string]string{
+				"abc": "xyz",
+			},
+			input:   "${abc:-${missing}}",
+			output:  "xyz",
+			isError: false,
+		},
+		{
+			params:  map[string]string{},
+			input:   "${abc:-${missing}}",
+			output:  "",
+			isError: true,
+		},
 		// none of input/default specified
 		{
 			params:  map[string]string{},
@@ -292,3 +323,617 @@ func TestEvalMap(t *testing.T) {
 		}
 	}
 }
+
+func TestMustEval(t *testing.T) {
+	got := MustEval("${var01^^}", func(s string) string {
+		return "abcdEFGH28ij"
+	})
+	if want := "ABCDEFGH28IJ"; got != want {
+		t.Errorf("Want MustEval to return %q, got %q", want, got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expect MustEval to panic on bad substitution")
+		}
+	}()
+	MustEval("${var01", func(s string) string { return "" })
+}
+
+func TestEvalEnvStrict(t *testing.T) {
+	os.Setenv("ENVSUBST_TEST_SET", "abc")
+	os.Setenv("ENVSUBST_TEST_EMPTY", "")
+	defer os.Unsetenv("ENVSUBST_TEST_SET")
+	defer os.Unsetenv("ENVSUBST_TEST_EMPTY")
+
+	output, err := EvalEnvStrict("${ENVSUBST_TEST_SET}${ENVSUBST_TEST_EMPTY}${ENVSUBST_TEST_UNSET=xyz}")
+	if err != nil {
+		t.Errorf("Expected output but got error %v", err)
+	}
+	if want := "abcxyz"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	_, err = EvalEnvStrict("${ENVSUBST_TEST_MISSING1} ${ENVSUBST_TEST_SET} ${ENVSUBST_TEST_MISSING2} ${ENVSUBST_TEST_MISSING1}")
+	if !IsValueNotFoundError(err) {
+		t.Fatalf("Expected valueNotFoundError, got %v", err)
+	}
+	want := "input/default value not found for keys ENVSUBST_TEST_MISSING1 (line 1, column 1), ENVSUBST_TEST_MISSING2 (line 1, column 48)"
+	if got := err.Error(); got != want {
+		t.Errorf("Expected error %q but got %q", want, got)
+	}
+}
+
+func TestEvalEnvWithOverrides(t *testing.T) {
+	os.Setenv("ENVSUBST_TEST_A", "env-a")
+	os.Setenv("ENVSUBST_TEST_B", "env-b")
+	defer os.Unsetenv("ENVSUBST_TEST_A")
+	defer os.Unsetenv("ENVSUBST_TEST_B")
+
+	output, err := EvalEnvWithOverrides("${ENVSUBST_TEST_A} ${ENVSUBST_TEST_B} ${ENVSUBST_TEST_C}", map[string]string{
+		"ENVSUBST_TEST_B": "override-b",
+		"ENVSUBST_TEST_C": "override-c",
+	})
+	if err != nil {
+		t.Errorf("Expected output but got error %v", err)
+	}
+	if want := "env-a override-b override-c"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+	if got := os.Getenv("ENVSUBST_TEST_B"); got != "env-b" {
+		t.Errorf("Expected environment to be unchanged, got %s", got)
+	}
+}
+
+func TestEvalMapDefaults(t *testing.T) {
+	var expressions = []struct {
+		input  string
+		output string
+	}{
+		// defined but empty values keep the value
+		{input: "${empty=pqr}", output: ""},
+		{input: "${empty:=pqr}", output: ""},
+		{input: "${empty:-pqr}", output: ""},
+		// defaults are not used for non-empty values
+		{input: "${abc:-pqr}", output: "xyz"},
+		// nested defaults are only resolved when used
+		{input: "${abc:-${missing}}", output: "xyz"},
+	}
+
+	params := map[string]string{"abc": "xyz", "empty": ""}
+	for _, expr := range expressions {
+		t.Logf(expr.input)
+		output, err := EvalMap(expr.input, params)
+		if err != nil {
+			t.Errorf("Expected output %s but got error %v", expr.output, err)
+		}
+		if output != expr.output {
+			t.Errorf("Expected output %s but got %s", expr.output, output)
+		}
+	}
+
+	// bash semantics are opt-in
+	output, err := EvalMap("${empty:-pqr} ${empty:=pqr} ${empty=pqr}", params, ColonDefaults())
+	if want := "pqr pqr "; err != nil || output != want {
+		t.Errorf("Want %q with ColonDefaults, got %q, %v", want, output, err)
+	}
+	if output, _ := EvalProvider("${empty:-pqr}", mapProvider(params)); output != "pqr" {
+		t.Errorf("Want the default for an empty value outside EvalMap, got %q", output)
+	}
+}
+
+func TestExecuteProvider(t *testing.T) {
+	tmpl, err := Parse("${greeting}, ${name:-world}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := ProviderFunc(func(key string) (string, bool, error) {
+		if key == "greeting" {
+			return "hello", true, nil
+		}
+		return "", false, nil
+	})
+	output, err := tmpl.ExecuteProvider(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello, world"; output != want {
+		t.Errorf("Want template executed to %q, got %q", want, output)
+	}
+
+	wantErr := errors.New("lookup failed")
+	_, err = tmpl.ExecuteProvider(ProviderFunc(func(key string) (string, bool, error) {
+		return "", false, wantErr
+	}))
+	if err != wantErr {
+		t.Errorf("Want provider error %v, got %v", wantErr, err)
+	}
+}
+
+func TestEvalStrictness(t *testing.T) {
+	var expressions = []struct {
+		input   string
+		output  string
+		options []Option
+		isError func(interface{}) bool
+	}{
+		{input: "${abc}${empty}", output: "xyz", options: []Option{NoUnset()}},
+		{input: "${missing}", options: []Option{NoUnset()}, isError: IsValueNotFoundError},
+		{input: "${missing:-pqr}", output: "pqr", options: []Option{NoUnset()}},
+		{input: "${missing}", output: "", options: []Option{NoEmpty()}, isError: IsValueEmptyError},
+		{input: "${empty}", options: []Option{NoEmpty()}, isError: IsValueEmptyError},
+		{input: "${empty:-pqr}", output: "pqr", options: []Option{NoEmpty()}},
+		{input: "${empty:-}", options: []Option{NoEmpty()}, isError: IsValueEmptyError},
+		{input: "${abc}", output: "xyz", options: []Option{NoUnset(), NoEmpty()}},
+	}
+
+	params := map[string]string{"abc": "xyz", "empty": ""}
+	provider := ProviderFunc(func(key string) (string, bool, error) {
+		v, ok := params[key]
+		return v, ok, nil
+	})
+	for _, expr := range expressions {
+		t.Logf(expr.input)
+		output, err := EvalProvider(expr.input, provider, expr.options...)
+		if expr.isError != nil {
+			if !expr.isError(err) {
+				t.Errorf("Expected error but got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected output %s but got error %v", expr.output, err)
+		}
+		if output != expr.output {
+			t.Errorf("Expected output %s but got %s", expr.output, output)
+		}
+	}
+}
+
+func TestEvalKeepUnresolved(t *testing.T) {
+	var expressions = []struct {
+		input  string
+		output string
+	}{
+		{input: "${abc} ${missing}", output: "xyz ${missing}"},
+		{input: "${missing^^} ${missing:0:2}", output: "${missing^^} ${missing:0:2}"},
+		{input: "${missing:-pqr}", output: "pqr"},
+		{input: "${abc/${missing}/pqr}", output: "xyz"},
+		{input: "${missing/${abc}/pqr}", output: "${missing/${abc}/pqr}"},
+		{input: `$${abc} ${missing//\//-}`, output: `${abc} ${missing//\//-}`},
+	}
+
+	params := map[string]string{"abc": "xyz"}
+	for _, expr := range expressions {
+		t.Logf(expr.input)
+		output, err := EvalProvider(expr.input, mapProvider(params), KeepUnresolved())
+		if err != nil {
+			t.Errorf("Expected output %s but got error %v", expr.output, err)
+		}
+		if output != expr.output {
+			t.Errorf("Expected output %s but got %s", expr.output, output)
+		}
+	}
+}
+
+func TestEvalUnresolvedPolicy(t *testing.T) {
+	policy := func(key string) Policy {
+		switch {
+		case strings.HasPrefix(key, "SECRET_"):
+			return PolicyError
+		case strings.HasPrefix(key, "LATER_"):
+			return PolicyKeep
+		}
+		return PolicyEmpty
+	}
+	params := map[string]string{"SECRET_SET": "s3cr3t"}
+
+	output, err := EvalProvider("${SECRET_SET}|${LATER_HOST}|${TUNING}", mapProvider(params), UnresolvedPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "s3cr3t|${LATER_HOST}|"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	_, err = EvalProvider("${SECRET_UNSET}|${LATER_HOST}", mapProvider(params), UnresolvedPolicy(policy))
+	if !IsValueNotFoundError(err) {
+		t.Errorf("Expected valueNotFoundError, got %v", err)
+	}
+	if want := "input/default value not found for key SECRET_UNSET at line 1, column 1 near `${SECRET_UNSET}|`; did you mean SECRET_SET?"; err != nil && err.Error() != want {
+		t.Errorf("Expected error %q, got %q", want, err)
+	}
+}
+
+func TestExecuteResolved(t *testing.T) {
+	tmpl, err := Parse("${host}:${port:-${default_port}} ${user:-${default_user}} ${host} ${missing}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{
+		"host":         "localhost",
+		"port":         "5432",
+		"default_port": "5433",
+		"default_user": "admin",
+	}
+	output, resolved, err := tmpl.ExecuteResolved(mapProvider(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "localhost:5432 admin localhost "; output != want {
+		t.Errorf("Want template executed to %q, got %q", want, output)
+	}
+	if want := []string{"host", "port", "default_user"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("Want resolved variables %q, got %q", want, resolved)
+	}
+}
+
+func TestExecuteReport(t *testing.T) {
+	input := "host=${host} port=${port:-${default_port}} name=${name^^}"
+	tmpl, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{
+		"host":         "localhost",
+		"default_port": "5433",
+		"name":         "db",
+	}
+	output, report, err := tmpl.ExecuteReport(mapProvider(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "host=localhost port=5433 name=DB"; output != want {
+		t.Errorf("Want template executed to %q, got %q", want, output)
+	}
+	want := []Substitution{
+		{Name: "host", Value: "localhost", Defined: true, Pos: 5, End: 12},
+		{Name: "port", Op: ":-", Value: "5433", Pos: 18, End: 42},
+		{Name: "default_port", Value: "5433", Defined: true, Pos: 26, End: 41},
+		{Name: "name", Op: "^^", Value: "DB", Defined: true, Pos: 48, End: 57},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Want report %+v, got %+v", want, report)
+	}
+	for _, sub := range report {
+		t.Logf("%s: %s", input[sub.Pos:sub.End], sub.Value)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tmpl, err := Parse("${host}:${port} ${missing}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"host": "localhost", "port": "5432"}
+	report, err := tmpl.DryRun(mapProvider(params), NoUnset())
+	if !IsValueNotFoundError(err) {
+		t.Errorf("Expected valueNotFoundError, got %v", err)
+	}
+	var names []string
+	for _, sub := range report {
+		names = append(names, sub.Name)
+	}
+	if want := []string{"host", "port", "missing"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Want substitutions for %q, got %q", want, names)
+	}
+}
+
+func TestEvalHooks(t *testing.T) {
+	params := map[string]string{"APP_HOST": " localhost ", "APP_PORT": "", "APP_SECRET": "s3cr3t"}
+
+	prefix := BeforeLookup(func(key string) string {
+		return "APP_" + strings.ToUpper(key)
+	})
+	trim := AfterLookup(func(key, value string, ok bool) (string, bool, error) {
+		return strings.TrimSpace(value), ok, nil
+	})
+	emptyUnset := AfterLookup(func(key, value string, ok bool) (string, bool, error) {
+		return value, ok && value != "", nil
+	})
+	output, err := EvalMap("${host}:${port=5432}", params, prefix, trim, emptyUnset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "localhost:5432"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	errVeto := errors.New("secrets are not allowed")
+	veto := AfterLookup(func(key, value string, ok bool) (string, bool, error) {
+		if strings.HasSuffix(key, "_SECRET") {
+			return "", false, errVeto
+		}
+		return value, ok, nil
+	})
+	if _, err := EvalMap("${secret}", params, prefix, veto); err != errVeto {
+		t.Errorf("Expected error %v but got %v", errVeto, err)
+	}
+}
+
+func TestEvalFuncs(t *testing.T) {
+	funcs := Funcs(FuncMap{
+		"upper": func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		},
+		"trim": func(s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		},
+		"fail": func(s string) (string, error) {
+			return "", errors.New("failed")
+		},
+	})
+	params := map[string]string{"name": " envsubst "}
+
+	output, err := EvalMap("[${upper(trim(name))}] [${trim(name)}] [${missing:-${upper(name)}}]", params, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[ENVSUBST] [envsubst] [ ENVSUBST ]"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	if _, err := EvalMap("${fail(name)}", params, funcs); err == nil || err.Error() != "failed" {
+		t.Errorf("Expected function error but got %v", err)
+	}
+	if _, err := EvalMap("${sha256(name)}", params, funcs); err == nil {
+		t.Errorf("Expected error calling undefined function")
+	}
+}
+
+func TestEvalPipelines(t *testing.T) {
+	funcs := Funcs(FuncMap{
+		"upper": func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		},
+		"trim": func(s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		},
+	})
+	params := map[string]string{"name": " envsubst "}
+
+	output, err := EvalMap("[${name|upper|trim}]", params, funcs, Pipelines())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[ENVSUBST]"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	if _, err := EvalMap("${name|upper}", params, funcs); err == nil {
+		t.Errorf("Expected error for pipeline without Pipelines option")
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	input := "${a:-${b:-${c}}} ${d:-0123456789}"
+	if _, err := Parse(input, MaxDepth(3), MaxExpressions(4), MaxOperandLength(10)); err != nil {
+		t.Errorf("Expected template within limits but got error %v", err)
+	}
+	for _, opt := range []Option{MaxDepth(2), MaxExpressions(3), MaxOperandLength(9)} {
+		_, err := Parse(input, opt)
+		if _, ok := err.(*LimitError); !ok {
+			t.Errorf("Expected LimitError but got %v", err)
+		}
+	}
+}
+
+func TestMaxSubstitutions(t *testing.T) {
+	params := mapProvider{
+		"a": "${b}${b}",
+		"b": "${c}${c}",
+		"c": "x",
+	}
+	var tests = []struct {
+		input   string
+		options []Option
+		max     int
+		output  string
+	}{
+		{input: "${c}${c}${c}", max: 3, output: "xxx"},
+		{input: "${c}${c}${c}", max: 2},
+		// 1 for a, 2 for b and 4 for c
+		{input: "${a}", options: []Option{Recursive(4)}, max: 7, output: "xxxx"},
+		{input: "${a}", options: []Option{Recursive(4)}, max: 6},
+	}
+	for _, test := range tests {
+		opts := append(test.options, MaxSubstitutions(test.max))
+		output, err := EvalProvider(test.input, params, opts...)
+		if test.output == "" {
+			if err, ok := err.(*LimitError); !ok || err.Limit != "substitution" {
+				t.Errorf("Expected substitution LimitError for %q with max %d, got %v", test.input, test.max, err)
+			}
+			continue
+		}
+		if err != nil || output != test.output {
+			t.Errorf("Expected %q for %q with max %d, got %q, %v", test.output, test.input, test.max, output, err)
+		}
+	}
+
+	// 1 + 2 + 4 substitutions over three passes
+	if _, err := ExpandUntilStable("${a}", params, 5, MaxSubstitutions(6)); err == nil {
+		t.Errorf("Expected LimitError counted over all passes")
+	}
+	if out, err := ExpandUntilStable("${a}", params, 5, MaxSubstitutions(7)); err != nil || out != "xxxx" {
+		t.Errorf("Expected xxxx within limit, got %q, %v", out, err)
+	}
+}
+
+func TestErrorOrdering(t *testing.T) {
+	params := mapProvider{"e2": "", "e3": ""}
+	_, err := EvalProvider("${e1:-${e2}} ${e3}", params, NoEmpty())
+	if want := "substituted value empty for keys e1, e2, e3"; err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
+
+	_, err = EvalProvider("${m1:-${m2^^}} ${m2} ${m1}", params, NoUnset())
+	merr, ok := err.(*MissingVarError)
+	if !ok {
+		t.Fatalf("Expected MissingVarError, got %v", err)
+	}
+	if want := []string{"m2", "m1"}; !reflect.DeepEqual(merr.Names, want) {
+		t.Errorf("Expected missing %q, got %q", want, merr.Names)
+	}
+	if merr.Refs[0].Offset != 6 {
+		t.Errorf("Expected first reference of m2 at 6, got %d", merr.Refs[0].Offset)
+	}
+
+	m := map[interface{}]interface{}{"${a}": "1", "${b}": "2", "x": "3", "y": "4"}
+	for i := 0; i < 10; i++ {
+		c := map[string]interface{}{"m": copyMap(m)}
+		err := ExpandMap(c, func(s string) string { return map[string]string{"a": "x", "b": "y"}[s] }, ExpandKeys())
+		if want := "expanded key x collides with an existing key"; err == nil || err.Error() != want {
+			t.Fatalf("Expected error %q, got %v", want, err)
+		}
+	}
+}
+
+func copyMap(m map[interface{}]interface{}) map[interface{}]interface{} {
+	c := make(map[interface{}]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func TestExecuteWriter(t *testing.T) {
+	tmpl, err := Parse("host=${host} port=${port:-5432}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := mapProvider{"host": "localhost"}
+	var b strings.Builder
+	for i := 0; i < 3; i++ {
+		if err := tmpl.ExecuteWriter(&b, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := strings.Repeat("host=localhost port=5432\n", 3); b.String() != want {
+		t.Errorf("Expected output %q, got %q", want, b.String())
+	}
+	if err := tmpl.ExecuteWriter(ioutil.Discard, params, NoUnset()); err != nil {
+		t.Errorf("Expected port default to satisfy NoUnset, got %v", err)
+	}
+	if err := tmpl.ExecuteWriter(ioutil.Discard, mapProvider{}, NoUnset()); !IsValueNotFoundError(err) {
+		t.Errorf("Expected valueNotFoundError, got %v", err)
+	}
+}
+
+func TestEvalPlain(t *testing.T) {
+	mapping := func(string) string { return "x" }
+	var tests = []struct {
+		input, output string
+	}{
+		{"plain text", "plain text"},
+		{`a\\b`, `a\b`},
+		{bom + "a", "a"},
+	}
+	for _, test := range tests {
+		got, err := Eval(test.input, mapping, StripBOM())
+		if err != nil || got != test.output {
+			t.Errorf("Want %q evaluated to %q, got %q, %v", test.input, test.output, got, err)
+		}
+	}
+
+	s := strings.Repeat("plain text, ", 10)
+	allocs := testing.AllocsPerRun(100, func() {
+		if got, _ := Eval(s, mapping, NoUnset()); got != s {
+			t.Fatalf("Want %q, got %q", s, got)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Want no allocations for plain text, got %v", allocs)
+	}
+}
+
+func BenchmarkEvalPlain(b *testing.B) {
+	s := strings.Repeat("plain text, ", 10)
+	mapping := func(string) string { return "x" }
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(s, mapping)
+	}
+}
+
+func TestTemplateCompiledPatterns(t *testing.T) {
+	tmpl, err := Parse("${file##*/} ${file%.*} ${file#${prefix}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, values := range []map[string]string{
+		{"file": "dir/a.txt", "prefix": "dir/"},
+		{"file": "x/y/b.go", "prefix": "x"},
+	} {
+		want, err := EvalMap("${file##*/} ${file%.*} ${file#${prefix}}", values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.ExecuteProvider(mapProvider(values))
+		if err != nil || got != want {
+			t.Errorf("Want %q, got %q, %v", want, got, err)
+		}
+	}
+}
+
+func BenchmarkExecutePattern(b *testing.B) {
+	tmpl, err := Parse("${path##*/[a-z]*/} ${path%%.[a-z]*}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	mapping := func(string) string { return "/usr/local/share/doc/readme.md" }
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tmpl.ExecuteProvider(funcProvider(mapping))
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	tmpl, err := Parse(strings.Repeat("name: ${NAME}, value: ${VALUE:-${DEFAULT}}\n", 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	values := mapProvider{"NAME": "envsubst", "DEFAULT": "none"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tmpl.ExecuteProvider(values)
+	}
+}
+
+func TestTemplateRelease(t *testing.T) {
+	values := mapProvider{"a": "dir/x", "b": "y"}
+	for i := 0; i < 3; i++ {
+		tmpl, err := Parse("${a##*/}-${b:-${c}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tmpl.ExecuteProvider(values)
+		if want := "x-y"; err != nil || got != want {
+			t.Errorf("Want %q, got %q, %v", want, got, err)
+		}
+		tmpl.Release()
+	}
+}
+
+func TestInternValues(t *testing.T) {
+	var tests = []struct {
+		opts    []Option
+		lookups int
+	}{
+		{nil, 4},
+		{[]Option{InternValues()}, 2},
+	}
+	for _, test := range tests {
+		lookups := 0
+		p := ProviderFunc(func(key string) (string, bool, error) {
+			lookups++
+			return strings.ToUpper(key), key != "c", nil
+		})
+		got, err := EvalProvider("${a}-${a}-${c:-x}-${c:-y}", p, test.opts...)
+		if want := "A-A-x-y"; err != nil || got != want {
+			t.Errorf("Want %q, got %q, %v", want, got, err)
+		}
+		if lookups != test.lookups {
+			t.Errorf("Want %d lookups, got %d", test.lookups, lookups)
+		}
+	}
+}
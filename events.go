@@ -0,0 +1,17 @@
+package envsubst
+
+import "errors"
+
+// Event is a chunk of template output, as produced by Events.
+type Event struct {
+	// Text is the output text of the chunk.
+	Text string
+	// Substitution describes the substitution that produced the
+	// text. It is nil for literal text, including references left
+	// verbatim by an UnresolvedPolicy.
+	Substitution *Substitution
+}
+
+// errStopped is returned internally when the receiver of the events
+// stops the execution early.
+var errStopped = errors.New("envsubst: execution stopped")
@@ -0,0 +1,27 @@
+//go:build go1.23
+// +build go1.23
+
+package envsubst
+
+import (
+	"io/ioutil"
+	"iter"
+)
+
+// Events returns an iterator over the output of the template as a
+// sequence of literal text and substitution events, in output order.
+// The output is not materialized, so the events can be used to build
+// custom renderers. Errors are yielded last; those collected during
+// execution, such as undefined variables with NoUnset, follow all the
+// events of a complete execution.
+func (t *Template) Events(p Provider, opts ...Option) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		s := t.newState(ioutil.Discard, p, t.options(opts))
+		s.emit = func(ev Event) bool {
+			return yield(ev, nil)
+		}
+		if err := t.run(s); err != nil && err != errStopped {
+			yield(Event{}, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+//go:build go1.23
+// +build go1.23
+
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	tmpl, err := Parse("host=${host} port=${port:-5432} ${later}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"host": "localhost"}
+
+	var texts []string
+	var names []string
+	tmpl.Events(mapProvider(params), KeepUnresolved())(func(ev Event, err error) bool {
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, ev.Text)
+		if ev.Substitution != nil {
+			names = append(names, ev.Substitution.Name)
+		}
+		return true
+	})
+	if want := []string{"host=", "localhost", " port=", "5432", " ", "${later}"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("Want event texts %q, got %q", want, texts)
+	}
+	if want := []string{"host", "port"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Want substitution events for %q, got %q", want, names)
+	}
+
+	// stopping early does not yield further events or errors.
+	var n int
+	tmpl.Events(mapProvider(params), NoUnset())(func(ev Event, err error) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Want iteration to stop after 1 event, got %d", n)
+	}
+
+	var last error
+	tmpl.Events(mapProvider(params), NoUnset())(func(ev Event, err error) bool {
+		last = err
+		return true
+	})
+	if !IsValueNotFoundError(last) {
+		t.Errorf("Want valueNotFoundError yielded last, got %v", last)
+	}
+}
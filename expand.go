@@ -0,0 +1,106 @@
+package envsubst
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// ExpandSlice replaces ${var} in the values of a list of environment
+// entries in the os.Environ "KEY=VALUE" format, based on the mapping
+// function. Keys, and entries without a separator, are left unchanged.
+// The returned slice is a copy; environ is not modified.
+//
+// If the Sequential option is given, a value may also reference the
+// keys of the entries that precede it.
+func ExpandSlice(environ []string, mapping func(string) string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	defined := make(map[string]string)
+	lookup := func(key string) string {
+		if v, ok := defined[key]; ok {
+			return v
+		}
+		return mapping(key)
+	}
+
+	var batch BatchError
+	out := make([]string, len(environ))
+	for i, kv := range environ {
+		key, value, ok := splitEntry(kv)
+		if !ok {
+			out[i] = kv
+			continue
+		}
+		v, err := Eval(value, lookup, opts...)
+		if err != nil {
+			batch = append(batch, &InputError{Index: i, Err: err})
+			out[i] = kv
+			continue
+		}
+		out[i] = key + "=" + v
+		if o.sequential {
+			defined[key] = v
+		}
+	}
+	if len(batch) != 0 {
+		return out, batch
+	}
+	return out, nil
+}
+
+// ExpandCmd replaces ${var} in the Path, Args, Env and Dir fields of cmd
+// based on the mapping function. Env entries are expanded as described
+// by ExpandSlice, with the same options. The command is only modified if
+// every field is expanded successfully. An expanded Path without a
+// separator is looked up in PATH as exec.Command does, replacing the
+// result of the lookup of the unexpanded name, so that commands created
+// with exec.Command("${TOOL}") run.
+func ExpandCmd(cmd *exec.Cmd, mapping func(string) string, opts ...Option) error {
+	path, err := Eval(cmd.Path, mapping, opts...)
+	if err != nil {
+		return err
+	}
+	dir, err := Eval(cmd.Dir, mapping, opts...)
+	if err != nil {
+		return err
+	}
+	var args []string
+	if cmd.Args != nil {
+		args = make([]string, len(cmd.Args))
+		for i, arg := range cmd.Args {
+			args[i], err = Eval(arg, mapping, opts...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var env []string
+	if cmd.Env != nil {
+		env, err = ExpandSlice(cmd.Env, mapping, opts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if path != cmd.Path {
+		path = lookCmdPath(cmd, path)
+	}
+	cmd.Path = path
+	cmd.Dir = dir
+	cmd.Args = args
+	cmd.Env = env
+	return nil
+}
+
+// splitEntry splits an environment entry into its key and value. The
+// search for the separator starts at the second byte, since Windows
+// uses keys such as "=C:" for per-drive working directories.
+func splitEntry(kv string) (key, value string, ok bool) {
+	if kv == "" {
+		return "", "", false
+	}
+	i := strings.IndexByte(kv[1:], '=')
+	if i < 0 {
+		return "", "", false
+	}
+	return kv[:i+1], kv[i+2:], true
+}
@@ -0,0 +1,25 @@
+//go:build go1.20
+// +build go1.20
+
+package envsubst
+
+import (
+	"os/exec"
+	"path/filepath"
+)
+
+// lookCmdPath resolves the expanded path of cmd as exec.Command does,
+// looking up bare names in PATH, and replaces the error of the lookup
+// exec.Command performed on the unexpanded name.
+func lookCmdPath(cmd *exec.Cmd, path string) string {
+	cmd.Err = nil
+	if filepath.Base(path) != path {
+		return path
+	}
+	lp, err := exec.LookPath(path)
+	if lp != "" {
+		path = lp
+	}
+	cmd.Err = err
+	return path
+}
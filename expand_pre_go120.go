@@ -0,0 +1,23 @@
+//go:build !go1.20
+// +build !go1.20
+
+package envsubst
+
+import (
+	"os/exec"
+	"path/filepath"
+)
+
+// lookCmdPath resolves the expanded path of cmd as exec.Command does,
+// looking up bare names in PATH. Before Go 1.20, the error of the lookup
+// exec.Command performed on the unexpanded name cannot be cleared, so
+// commands should then be created with an exec.Cmd literal.
+func lookCmdPath(cmd *exec.Cmd, path string) string {
+	if filepath.Base(path) != path {
+		return path
+	}
+	if lp, err := exec.LookPath(path); err == nil {
+		path = lp
+	}
+	return path
+}
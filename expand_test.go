@@ -0,0 +1,93 @@
+package envsubst
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestExpandSlice(t *testing.T) {
+	params := map[string]string{"HOME": "/home/bozo"}
+	mapping := func(s string) string {
+		return params[s]
+	}
+	environ := []string{
+		"HOME=/root",
+		"CONFIG=${HOME}/.config",
+		"=C:=C:\\${HOME}",
+		"NOSEPARATOR${HOME}",
+	}
+
+	got, err := ExpandSlice(environ, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"HOME=/root",
+		"CONFIG=/home/bozo/.config",
+		"=C:=C:\\/home/bozo",
+		"NOSEPARATOR${HOME}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want environ expanded to %q, got %q", want, got)
+	}
+
+	got, err = ExpandSlice(environ, mapping, Sequential())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "CONFIG=/root/.config"; got[1] != want {
+		t.Errorf("Want sequential entry expanded to %q, got %q", want, got[1])
+	}
+}
+
+func TestExpandCmd(t *testing.T) {
+	params := map[string]string{"BIN": "/usr/bin", "HOME": "/home/bozo"}
+	mapping := func(s string) string {
+		return params[s]
+	}
+	cmd := &exec.Cmd{
+		Path: "${BIN}/env",
+		Args: []string{"env", "--chdir=${HOME}"},
+		Env:  []string{"CONFIG=${HOME}/.config"},
+		Dir:  "${HOME}/src",
+	}
+	if err := ExpandCmd(cmd, mapping); err != nil {
+		t.Fatal(err)
+	}
+	want := &exec.Cmd{
+		Path: "/usr/bin/env",
+		Args: []string{"env", "--chdir=/home/bozo"},
+		Env:  []string{"CONFIG=/home/bozo/.config"},
+		Dir:  "/home/bozo/src",
+	}
+	if !reflect.DeepEqual(cmd, want) {
+		t.Errorf("Want command expanded to %+v, got %+v", want, cmd)
+	}
+
+	cmd = &exec.Cmd{Path: "${BIN}/env", Args: []string{"${BIN"}}
+	if err := ExpandCmd(cmd, mapping); err == nil {
+		t.Errorf("Expected error for bad substitution")
+	}
+	if cmd.Path != "${BIN}/env" {
+		t.Errorf("Expected command to be unchanged on error, got path %s", cmd.Path)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh in PATH")
+	}
+	cmd = exec.Command("${SHELL_NAME}", "-c", "echo ${GREETING}")
+	err = ExpandCmd(cmd, func(s string) string {
+		return map[string]string{"SHELL_NAME": "sh", "GREETING": "hello"}[s]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Path != sh {
+		t.Errorf("Want the command looked up as %s, got %s", sh, cmd.Path)
+	}
+	if out, err := cmd.Output(); err != nil || string(out) != "hello\n" {
+		t.Errorf("Want the expanded command to run, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"bytes"
+	"io/fs"
+)
+
+// ExpandFS returns a file system whose files are those of fsys with
+// ${var} replaced based on the mapping function, as EvalCopy does, so
+// that code reading files through fs.FS, such as http.FileServer with
+// http.FS, serves them expanded. Only the files selected by the Include
+// and Exclude options are expanded, the others being returned as is.
+//
+// Each file is expanded in memory when opened, and its Stat reports the
+// size of the expanded content. Failing to expand a file fails Open with
+// an fs.PathError. Directory entries report the information of the
+// files of fsys. The mapping function must be safe for concurrent use if
+// files are opened concurrently.
+func ExpandFS(fsys fs.FS, mapping func(string) string, opts ...Option) fs.FS {
+	return &expandFS{fsys: fsys, mapping: mapping, opts: opts, options: newOptions(opts)}
+}
+
+type expandFS struct {
+	fsys    fs.FS
+	mapping func(string) string
+	opts    []Option
+	options *options
+}
+
+func (e *expandFS) Open(name string) (fs.File, error) {
+	f, err := e.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || !e.options.renders(name) {
+		return f, nil
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if _, _, err := EvalCopy(&buf, f, e.mapping, e.opts...); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	entry := &memEntry{data: buf.Bytes(), mode: info.Mode(), modTime: info.ModTime()}
+	return &memFile{info: &memInfo{name: info.Name(), entry: entry}, Reader: bytes.NewReader(entry.data)}, nil
+}
@@ -0,0 +1,58 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExpandFS(t *testing.T) {
+	src := fstest.MapFS{
+		"config.js":      {Data: []byte("window.API = \"${API}\";\n")},
+		"img/logo.png":   {Data: []byte("${API}")},
+		"broken/app.tpl": {Data: []byte("${API")},
+	}
+	mapping := func(key string) string {
+		if key == "API" {
+			return "https://api.example.com"
+		}
+		return ""
+	}
+	fsys := ExpandFS(src, mapping, Exclude("*.png"))
+
+	want := "window.API = \"https://api.example.com\";\n"
+	if b, err := fs.ReadFile(fsys, "config.js"); err != nil || string(b) != want {
+		t.Errorf("Want %q, got %q, %v", want, b, err)
+	}
+	if info, err := fs.Stat(fsys, "config.js"); err != nil || info.Size() != int64(len(want)) {
+		t.Errorf("Want the expanded size %d, got %v, %v", len(want), info, err)
+	}
+	if b, err := fs.ReadFile(fsys, "img/logo.png"); err != nil || string(b) != "${API}" {
+		t.Errorf("Want excluded file unchanged, got %q, %v", b, err)
+	}
+	var perr *fs.PathError
+	if _, err := fsys.Open("broken/app.tpl"); !errors.As(err, &perr) || perr.Path != "broken/app.tpl" {
+		t.Errorf("Want a PathError for the malformed file, got %v", err)
+	}
+	if entries, err := fs.ReadDir(fsys, "."); err != nil || len(entries) != 3 {
+		t.Errorf("Want the entries of the root, got %v, %v", entries, err)
+	}
+
+	srv := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/config.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != want {
+		t.Errorf("Want %q served, got %q", want, b)
+	}
+}
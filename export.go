@@ -0,0 +1,92 @@
+package envsubst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShellExports returns an export KEY='value' line for each of the named
+// variables, in the order given, resolving them with the provider, so
+// that the output can be sourced by a POSIX shell. Values are quoted as
+// by ShellQuote. Variables the provider leaves undefined are omitted,
+// unless the NoUnset option is given, in which case they are reported
+// together in a MissingVarError.
+func ShellExports(names []string, p Provider, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	var b strings.Builder
+	var missing []VarRef
+	for _, name := range names {
+		v, ok, err := p.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			if o.noUnset {
+				missing = append(missing, VarRef{Name: name, Offset: -1})
+			}
+			continue
+		}
+		if err := writeExport(&b, name, v); err != nil {
+			return "", err
+		}
+	}
+	if len(missing) != 0 {
+		if l, ok := p.(KeyLister); ok {
+			suggestAll(missing, l.Keys())
+		}
+		return "", newMissingVarError(missing)
+	}
+	return b.String(), nil
+}
+
+// EvalShellExports evaluates the .env file s as a template, see
+// ReadDotenv, and returns its entries as export lines, as ShellExports
+// does. References are resolved from the entries before them, then from
+// the provider, according to the options. Keys must be valid shell
+// variable names.
+func EvalShellExports(s string, p Provider, opts ...Option) (string, error) {
+	entries, err := parseDotenv(s, make(mapProvider), p, newOptions(opts))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		if err := writeExport(&b, e.key, e.value); err != nil {
+			return "", &DotenvError{Line: e.line, Err: err}
+		}
+	}
+	return b.String(), nil
+}
+
+// ShellQuote quotes s for a POSIX shell, within single quotes, so that
+// it is taken literally. Each single quote of s is written as a quote
+// closing the string, a backslash-escaped quote and a quote reopening it.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// writeExport writes the export line of the variable to b.
+func writeExport(b *strings.Builder, name, value string) error {
+	if !isShellName(name) {
+		return fmt.Errorf("invalid shell variable name %s", quote(name))
+	}
+	if strings.IndexByte(value, 0) >= 0 {
+		return fmt.Errorf("value of %s holds a NUL byte, which shell variables cannot", name)
+	}
+	b.WriteString("export ")
+	b.WriteString(name)
+	b.WriteByte('=')
+	b.WriteString(ShellQuote(value))
+	b.WriteByte('\n')
+	return nil
+}
+
+// isShellName reports whether name is a valid shell variable name.
+func isShellName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i], i == 0) {
+			return false
+		}
+	}
+	return name != ""
+}
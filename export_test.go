@@ -0,0 +1,52 @@
+package envsubst
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShellExports(t *testing.T) {
+	p := mapProvider{"HOST": "db", "PASS": "it's $ecret", "EMPTY": ""}
+	got, err := ShellExports([]string{"PASS", "HOST", "EMPTY", "UNSET"}, p)
+	want := "export PASS='it'\\''s $ecret'\nexport HOST='db'\nexport EMPTY=''\n"
+	if err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	var missing *MissingVarError
+	_, err = ShellExports([]string{"UNSET", "HOST", "PORT"}, p, NoUnset())
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"UNSET", "PORT"}) {
+		t.Errorf("Want UNSET and PORT reported as missing, got %v", err)
+	}
+	if _, err := ShellExports([]string{"my-var"}, mapProvider{"my-var": "x"}); err == nil {
+		t.Errorf("Want an error for an invalid name")
+	}
+	if _, err := ShellExports([]string{"NUL"}, mapProvider{"NUL": "a\x00b"}); err == nil {
+		t.Errorf("Want an error for a NUL byte")
+	}
+}
+
+func TestEvalShellExports(t *testing.T) {
+	input := `# database
+export DB_HOST=${HOST:-localhost}
+DB_URL="postgres://${DB_HOST}/app"
+GREETING='hello ${USER}'
+`
+	got, err := EvalShellExports(input, mapProvider{"HOST": "db's"})
+	want := "export DB_HOST='db'\\''s'\n" +
+		"export DB_URL='postgres://db'\\''s/app'\n" +
+		"export GREETING='hello ${USER}'\n"
+	if err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	_, err = EvalShellExports("A=1\nB=${UNSET}\n", mapProvider{}, NoUnset())
+	var derr *DotenvError
+	if !errors.As(err, &derr) || derr.Line != 2 || !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want a missing variable on line 2, got %v", err)
+	}
+	if _, err := EvalShellExports("app.name=web\n", mapProvider{}); !errors.As(err, &derr) || derr.Line != 1 {
+		t.Errorf("Want an invalid name on line 1, got %v", err)
+	}
+}
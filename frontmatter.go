@@ -0,0 +1,237 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frontmatterDelim opens and closes a frontmatter block.
+const frontmatterDelim = "---"
+
+// Frontmatter parses an optional frontmatter block at the start of the
+// input, in which the template declares its variables:
+//
+//	---
+//	vars:
+//	  DB_HOST:
+//	    description: Hostname of the database server
+//	    required: true
+//	  DB_PORT:
+//	    default: "5432"
+//	---
+//	postgres://${DB_HOST}:${DB_PORT}/app
+//
+// The block is delimited by lines holding only ---, and is left out of
+// the output. Each variable may have a description, a default value
+// used when the variable is undefined, and be required. With the NoUnset
+// option, the required variables without a default are checked before
+// anything is rendered, and reported together in a MissingVarError.
+//
+// The block is a subset of YAML: a vars key mapping each name to its
+// description, default and required keys, whose values may be quoted.
+// Any other key is an error. The declarations are returned by the Vars
+// method of parsed templates. Frontmatter is honoured by Parse, by
+// EvalProvider and the functions built on it, and by the streaming
+// functions.
+func Frontmatter() Option {
+	return func(o *options) {
+		o.frontmatter = true
+	}
+}
+
+// VarDecl declares a variable in the frontmatter of a template.
+type VarDecl struct {
+	Name        string
+	Description string
+	// Required reports whether the variable must be defined, or have
+	// a default, when the template is executed with NoUnset.
+	Required bool
+	// Default is the value of the variable when it is undefined, if
+	// HasDefault is set.
+	Default    string
+	HasDefault bool
+}
+
+// Vars returns the variables declared by the frontmatter of the
+// template, in order of declaration, or nil if it has none.
+func (t *Template) Vars() []VarDecl {
+	return t.vars
+}
+
+// frontmatterLen returns the length of the frontmatter block at the
+// start of s, including its closing line, 0 if s does not start with
+// one, or -1 if its closing line is missing.
+func frontmatterLen(s string) int {
+	if !strings.HasPrefix(s, frontmatterDelim+"\n") && !strings.HasPrefix(s, frontmatterDelim+"\r\n") {
+		return 0
+	}
+	for i := strings.IndexByte(s, '\n') + 1; i < len(s); {
+		end := strings.IndexByte(s[i:], '\n')
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += i + 1
+		}
+		if strings.TrimRight(s[i:end], "\r\n") == frontmatterDelim {
+			return end
+		}
+		i = end
+	}
+	return -1
+}
+
+// parseFrontmatter parses the frontmatter block at the start of s and
+// returns its declarations and length. An unterminated block is not a
+// frontmatter block.
+func parseFrontmatter(s string) ([]VarDecl, int, error) {
+	n := frontmatterLen(s)
+	if n <= 0 {
+		return nil, 0, nil
+	}
+	var (
+		vars      []VarDecl
+		inVars    bool
+		varIndent int
+	)
+	for i := strings.IndexByte(s, '\n') + 1; ; {
+		end := strings.IndexByte(s[i:n], '\n')
+		if end < 0 {
+			end = n
+		} else {
+			end += i + 1
+		}
+		line := strings.TrimRight(s[i:end], "\r\n")
+		if line == frontmatterDelim {
+			break
+		}
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+		pos := i + indent
+		i = end
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		key, value, err := frontmatterEntry(text)
+		if err != nil {
+			return nil, 0, newParseError(s, pos, err)
+		}
+		switch {
+		case indent == 0:
+			if key != "vars" || value != "" {
+				return nil, 0, newParseError(s, pos, fmt.Errorf("unknown frontmatter key %s", quote(key)))
+			}
+			inVars, varIndent = true, 0
+		case !inVars:
+			return nil, 0, newParseError(s, pos, errors.New("frontmatter entry outside of vars"))
+		case varIndent == 0 || indent == varIndent:
+			if value != "" || !validDeclName(key) {
+				return nil, 0, newParseError(s, pos, fmt.Errorf("invalid variable declaration %s", quote(text)))
+			}
+			varIndent = indent
+			vars = append(vars, VarDecl{Name: key})
+		case indent > varIndent:
+			if err := setDeclField(&vars[len(vars)-1], key, value); err != nil {
+				return nil, 0, newParseError(s, pos, err)
+			}
+		default:
+			return nil, 0, newParseError(s, pos, errors.New("inconsistent frontmatter indentation"))
+		}
+	}
+	return vars, n, nil
+}
+
+// frontmatterEntry splits a key: value line of a frontmatter block,
+// unquoting the value.
+func frontmatterEntry(text string) (key, value string, err error) {
+	i := strings.IndexByte(text, ':')
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid frontmatter line %s", quote(text))
+	}
+	key = text[:i]
+	value = strings.TrimSpace(text[i+1:])
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		value, err = strconv.Unquote(value)
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		value = strings.Replace(value[1:len(value)-1], "''", "'", -1)
+	case strings.HasPrefix(value, "#"):
+		value = ""
+	}
+	return key, value, err
+}
+
+// setDeclField sets the field of the declaration named by key.
+func setDeclField(d *VarDecl, key, value string) error {
+	switch key {
+	case "description":
+		d.Description = value
+	case "default":
+		d.Default, d.HasDefault = value, true
+	case "required":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid required value %s for variable %s", quote(value), d.Name)
+		}
+		d.Required = b
+	default:
+		return fmt.Errorf("unknown key %s for variable %s", quote(key), d.Name)
+	}
+	return nil
+}
+
+// validDeclName reports whether name is a valid variable name, possibly
+// dotted.
+func validDeclName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i], i == 0) && (i == 0 || name[i] != '.') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// declare returns p resolving the variables undefined by p to their
+// declared defaults, if any.
+func declare(p Provider, vars []VarDecl) Provider {
+	var defaults mapProvider
+	for _, v := range vars {
+		if v.HasDefault {
+			if defaults == nil {
+				defaults = make(mapProvider)
+			}
+			defaults[v.Name] = v.Default
+		}
+	}
+	if defaults == nil || p == nil {
+		return p
+	}
+	return chain{p, defaults}
+}
+
+// checkDeclared returns a MissingVarError listing the required variables
+// that p leaves undefined, suggesting names listed by l if it
+// implements KeyLister.
+func checkDeclared(p, l Provider, vars []VarDecl) error {
+	var missing []VarRef
+	for _, v := range vars {
+		if !v.Required {
+			continue
+		}
+		_, ok, err := p.Lookup(v.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			missing = append(missing, VarRef{Name: v.Name, Offset: -1})
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if l, ok := l.(KeyLister); ok {
+		suggestAll(missing, l.Keys())
+	}
+	return newMissingVarError(missing)
+}
@@ -0,0 +1,95 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFrontmatter(t *testing.T) {
+	input := `---
+# declared variables
+vars:
+  DB_HOST:
+    description: Hostname of the database server
+    required: true
+  DB_PORT:
+    description: 'Port of the ''database'' server'
+    default: "5432"
+---
+postgres://${DB_HOST}:${DB_PORT}/app
+`
+	tmpl, err := Parse(input, Frontmatter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VarDecl{
+		{Name: "DB_HOST", Description: "Hostname of the database server", Required: true},
+		{Name: "DB_PORT", Description: "Port of the 'database' server", Default: "5432", HasDefault: true},
+	}
+	if got := tmpl.Vars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %+v, got %+v", want, got)
+	}
+	got, err := tmpl.ExecuteProvider(mapProvider{"DB_HOST": "db"})
+	if want := "postgres://db:5432/app\n"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	subs, _ := tmpl.DryRun(mapProvider{"DB_HOST": "db"})
+	if len(subs) != 2 || subs[0].Pos != strings.Index(input, "${DB_HOST}") {
+		t.Errorf("Want positions in the input, got %+v", subs)
+	}
+
+	var missing *MissingVarError
+	_, err = tmpl.ExecuteProvider(mapProvider{"DB_PORT": "1"}, NoUnset())
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"DB_HOST"}) {
+		t.Errorf("Want DB_HOST reported as missing, got %v", err)
+	}
+	var b strings.Builder
+	err = tmpl.ExecuteWriter(&b, mapProvider{}, NoUnset())
+	if err == nil || b.Len() != 0 {
+		t.Errorf("Want an error before rendering, got %q, %v", b.String(), err)
+	}
+
+	mapping := func(s string) string {
+		return map[string]string{"DB_HOST": "db"}[s]
+	}
+	if got, err := Eval(input, mapping, Frontmatter()); err != nil || got != "postgres://db:5432/app\n" {
+		t.Errorf("Want the frontmatter applied, got %q, %v", got, err)
+	}
+	if got, _ := Eval(input, mapping); !strings.HasPrefix(got, "---\n") {
+		t.Errorf("Want the frontmatter kept without the option, got %q", got)
+	}
+	out, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping, Frontmatter()))
+	if err != nil || string(out) != "postgres://db:5432/app\n" {
+		t.Errorf("Want the frontmatter applied when streaming, got %q, %v", out, err)
+	}
+	_, err = ioutil.ReadAll(NewReader(strings.NewReader(input), func(string) string { return "" }, Frontmatter(), NoUnset()))
+	if !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want a missing variable when streaming, got %v", err)
+	}
+
+	plain := "---\nvars:\n  NAME: {}\n---\ntext\n"
+	if got, err := Eval(plain, mapping); err != nil || got != plain {
+		t.Errorf("Want %q, got %q, %v", plain, got, err)
+	}
+	if got, err := Eval("---\nkind: List\n", mapping, Frontmatter()); err != nil || got != "---\nkind: List\n" {
+		t.Errorf("Want an unterminated block kept, got %q, %v", got, err)
+	}
+
+	invalid := []string{
+		"---\ntitle: Page\n---\n",
+		"---\nvars:\n  NAME:\n    type: string\n---\n",
+		"---\nvars:\n  NAME:\n    required: maybe\n---\n",
+		"---\nvars:\n  1NAME:\n---\n",
+		"---\n  NAME:\n---\n",
+	}
+	for _, s := range invalid {
+		var perr *ParseError
+		if _, err := Parse(s, Frontmatter()); !errors.As(err, &perr) || perr.Line < 2 {
+			t.Errorf("Want a parse error for %q, got %v", s, err)
+		}
+	}
+}
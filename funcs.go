@@ -36,7 +36,10 @@ func toLowerFirst(s string, args ...string) string {
 		return s
 	}
 	r, n := utf8.DecodeRuneInString(s)
-	return string(unicode.ToLower(r)) + s[n:]
+	if l := unicode.ToLower(r); l != r {
+		return string(l) + s[n:]
+	}
+	return s
 }
 
 // toUpperFirst returns a copy of the string s with the first
@@ -46,7 +49,10 @@ func toUpperFirst(s string, args ...string) string {
 		return s
 	}
 	r, n := utf8.DecodeRuneInString(s)
-	return string(unicode.ToUpper(r)) + s[n:]
+	if u := unicode.ToUpper(r); u != r {
+		return string(u) + s[n:]
+	}
+	return s
 }
 
 // toDefault returns a copy of the string s if not empty, else
@@ -130,7 +136,7 @@ func replacePrefix(s string, args ...string) string {
 		return s
 	}
 	if strings.HasPrefix(s, args[0]) {
-		return strings.Replace(s, args[0], args[1], 1)
+		return args[1] + s[len(args[0]):]
 	}
 	return s
 }
@@ -142,8 +148,7 @@ func replaceSuffix(s string, args ...string) string {
 		return s
 	}
 	if strings.HasSuffix(s, args[0]) {
-		s = strings.TrimSuffix(s, args[0])
-		s = s + args[1]
+		return s[:len(s)-len(args[0])] + args[1]
 	}
 	return s
 }
@@ -152,77 +157,114 @@ func replaceSuffix(s string, args ...string) string {
 
 func trimShortestPrefix(s string, args ...string) string {
 	if len(args) != 0 {
-		s = trimShortest(s, args[0])
+		s = trimShortest(s, path.Compile(args[0]))
 	}
 	return s
 }
 
 func trimShortestSuffix(s string, args ...string) string {
 	if len(args) != 0 {
-		r := reverse(s)
-		rarg := reverse(args[0])
-		s = reverse(trimShortest(r, rarg))
+		s = trimShortestSuf(s, path.Compile(args[0]))
 	}
 	return s
 }
 
 func trimLongestPrefix(s string, args ...string) string {
 	if len(args) != 0 {
-		s = trimLongest(s, args[0])
+		s = trimLongest(s, path.Compile(args[0]))
 	}
 	return s
 }
 
 func trimLongestSuffix(s string, args ...string) string {
 	if len(args) != 0 {
-		r := reverse(s)
-		rarg := reverse(args[0])
-		s = reverse(trimLongest(r, rarg))
+		s = trimLongestSuf(s, path.Compile(args[0]))
 	}
 	return s
 }
 
-func trimShortest(s, arg string) string {
-	var shortestMatch string
-	for i := 0; i < len(s); i++ {
-		match, err := path.Match(arg, s[0:len(s)-i])
+// compileTrim returns the trimming function of the named operator with
+// its pattern argument compiled, or nil if the operator does not trim
+// a pattern.
+func compileTrim(name, arg string) func(string) string {
+	var trim func(string, *path.Pattern) string
+	switch name {
+	case "#":
+		trim = trimShortest
+	case "##":
+		trim = trimLongest
+	case "%":
+		trim = trimShortestSuf
+	case "%%":
+		trim = trimLongestSuf
+	default:
+		return nil
+	}
+	p := path.Compile(arg)
+	return func(s string) string { return trim(s, p) }
+}
 
-		if err != nil {
-			return s
-		}
+// The trimming functions below match the pattern against the non-empty
+// prefixes or suffixes of s ending or starting at character
+// boundaries, and return the rest of s as a slice of it. They return s
+// if no affix matches or the pattern is malformed.
 
-		if match {
-			shortestMatch = s[0 : len(s)-i]
+// trimShortest removes the shortest prefix of s matching the pattern.
+func trimShortest(s string, p *path.Pattern) string {
+	for i := 1; i <= len(s); i++ {
+		if i < len(s) && !utf8.RuneStart(s[i]) {
+			continue
+		}
+		if match, err := p.Match(s[:i]); err != nil || match {
+			return trimmed(s, i, len(s), err)
 		}
 	}
+	return s
+}
 
-	if shortestMatch != "" {
-		return strings.TrimPrefix(s, shortestMatch)
+// trimLongest removes the longest prefix of s matching the pattern.
+func trimLongest(s string, p *path.Pattern) string {
+	for i := len(s); i > 0; i-- {
+		if i < len(s) && !utf8.RuneStart(s[i]) {
+			continue
+		}
+		if match, err := p.Match(s[:i]); err != nil || match {
+			return trimmed(s, i, len(s), err)
+		}
 	}
+	return s
+}
 
+// trimShortestSuf removes the shortest suffix of s matching the pattern.
+func trimShortestSuf(s string, p *path.Pattern) string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if !utf8.RuneStart(s[i]) {
+			continue
+		}
+		if match, err := p.Match(s[i:]); err != nil || match {
+			return trimmed(s, 0, i, err)
+		}
+	}
 	return s
 }
 
-func trimLongest(s, arg string) string {
+// trimLongestSuf removes the longest suffix of s matching the pattern.
+func trimLongestSuf(s string, p *path.Pattern) string {
 	for i := 0; i < len(s); i++ {
-		match, err := path.Match(arg, s[0:len(s)-i])
-
-		if err != nil {
-			return s
+		if !utf8.RuneStart(s[i]) {
+			continue
 		}
-
-		if match {
-			return strings.TrimPrefix(s, s[0:len(s)-i])
+		if match, err := p.Match(s[i:]); err != nil || match {
+			return trimmed(s, 0, i, err)
 		}
 	}
-
 	return s
 }
 
-func reverse(s string) string {
-	r := []rune(s)
-	for i, j := 0, len(r)-1; i < len(r)/2; i, j = i+1, j-1 {
-		r[i], r[j] = r[j], r[i]
+// trimmed returns s[i:j], or s if err is not nil.
+func trimmed(s string, i, j int, err error) string {
+	if err != nil {
+		return s
 	}
-	return string(r)
+	return s[i:j]
 }
@@ -82,3 +82,36 @@ func Test_substr(t *testing.T) {
 		t.Errorf("Expect substr function to ignore length if out of bound")
 	}
 }
+
+func Test_compileTrim(t *testing.T) {
+	var tests = []struct {
+		name, arg, input, want string
+	}{
+		{"#", "*/", "a/b/c", "b/c"},
+		{"##", "*/", "a/b/c", "c"},
+		{"%", ".*", "a.tar.gz", "a.tar"},
+		{"%%", ".*", "a.tar.gz", "a"},
+		{"#", "[a-", "a-b", "a-b"},
+		{"%", ".[a-z]*", "a.tar.gz", "a.tar"},
+		{"%%", "\\.*", "a.tar.gz", "a"},
+		{"#", "?", "éa", "a"},
+		{"%", "?", "aé", "a"},
+		{"##", "*", "abc", ""},
+		{"%", "x", "abc", "abc"},
+	}
+	for _, test := range tests {
+		fn := compileTrim(test.name, test.arg)
+		if got := fn(test.input); got != test.want {
+			t.Errorf("Expect %s%s on %q to return %q, got %q", test.name, test.arg, test.input, test.want, got)
+		}
+		if got := lookupFunc(test.name, 1)(test.input, test.arg); got != fn(test.input) {
+			t.Errorf("Expect compiled %s%s to match uncompiled, got %q", test.name, test.arg, got)
+		}
+		if n := testing.AllocsPerRun(10, func() { fn(test.input) }); n != 0 {
+			t.Errorf("Expect %s%s to trim without allocating, got %v allocations", test.name, test.arg, n)
+		}
+	}
+	if compileTrim(":", "1") != nil {
+		t.Errorf("Expect no trimming function for substrings")
+	}
+}
@@ -0,0 +1,64 @@
+// Package ttlcache implements the cache of variable values shared by the
+// remote providers.
+package ttlcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache holds values, including undefined ones, until they expire. The
+// zero value is an empty cache whose values never expire. It is safe
+// for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   string
+	ok      bool
+	expires time.Time // zero if the value never expires
+}
+
+// Get returns the value cached for key. The first boolean reports
+// whether the variable is defined, the second whether the value is
+// cached and not expired.
+func (c *Cache) Get(key string) (value string, ok, cached bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, cached := c.entries[key]
+	if !cached {
+		return "", false, false
+	}
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(c.entries, key)
+		return "", false, false
+	}
+	return e.value, e.ok, true
+}
+
+// Set caches the value of key for ttl, or forever if ttl is zero. A
+// negative ttl does not cache the value.
+func (c *Cache) Set(key, value string, ok bool, ttl time.Duration) {
+	if ttl < 0 {
+		return
+	}
+	e := entry{value: value, ok: ok}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]entry)
+	}
+	c.entries[key] = e
+}
+
+// Delete removes the value of key from the cache.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,195 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvalJSON replaces ${var} in a JSON document, resolving variables with
+// the provider. Values substituted inside strings are escaped, quotes,
+// backslashes and control characters included, so that the document
+// stays valid whatever they contain.
+//
+// A string consisting of a single reference with a type, as in
+// "${PORT:int}", is replaced as a whole by the value as a JSON value of
+// that type, so that "port": "${PORT:int}" renders as "port": 8080. The
+// types are:
+//
+//   - int: an integer.
+//   - float: a number.
+//   - bool: true or false, also accepting the forms of strconv.ParseBool.
+//   - json: any JSON value, inserted as is.
+//
+// A value that is not of its type is an error. Typed references may
+// also appear outside strings, as in "port": ${PORT:int}, and other
+// references outside strings are substituted as is. Within a longer
+// string, the type of a reference is ignored.
+func EvalJSON(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	o := newOptions(opts)
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '"':
+			end := jsonStringEnd(s, i)
+			if end < 0 {
+				v, err := evalWith(keepBackslashes(s[i:]), p, o)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(v)
+				i = len(s)
+				continue
+			}
+			inner := s[i+1 : end-1]
+			if v, ok, err := evalTypedJSON(inner, p, o); ok || err != nil {
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(v)
+				i = end
+				continue
+			}
+			v, err := evalJSONString(inner, p, o)
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte('"')
+			b.WriteString(v)
+			b.WriteByte('"')
+			i = end
+		case s[i] == '$' && strings.HasPrefix(s[i:], "${"):
+			end := skipReference(s, i)
+			v, ok, err := evalTypedJSON(s[i:end], p, o)
+			if !ok && err == nil {
+				v, err = evalWith(s[i:end], p, o)
+			}
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = end
+		default:
+			j := jsonLiteralEnd(s, i)
+			v, err := evalWith(keepBackslashes(s[i:j]), p, o)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			i = j
+		}
+	}
+	return b.String(), nil
+}
+
+// evalJSONString evaluates the inside of a JSON string, escaping the
+// substituted values.
+func evalJSONString(s string, p Provider, o *options) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	return evalEscaped(s, p, o, jsonEscape)
+}
+
+// jsonLiteralEnd returns the end of the text starting at i outside
+// strings, at the next string or reference. A $$ escape is kept whole.
+func jsonLiteralEnd(s string, i int) int {
+	j := i
+	for j < len(s) && s[j] != '"' {
+		if s[j] == '$' && j+1 < len(s) {
+			if s[j+1] == '$' {
+				j += 2
+				continue
+			}
+			if s[j+1] == '{' && j > i {
+				break
+			}
+		}
+		j++
+	}
+	return j
+}
+
+// jsonStringEnd returns the end of the JSON string starting at i, after
+// its closing quote, or -1 if it is not closed.
+func jsonStringEnd(s string, i int) int {
+	for j := i + 1; j < len(s); {
+		switch {
+		case s[j] == '\\':
+			j += 2
+		case s[j] == '$' && strings.HasPrefix(s[j:], "${"):
+			j = skipReference(s, j)
+		case s[j] == '"':
+			return j + 1
+		default:
+			j++
+		}
+	}
+	return -1
+}
+
+// evalTypedJSON evaluates s if it is a typed reference such as
+// ${PORT:int}, returning the value as JSON. The boolean reports whether
+// s is a typed reference.
+func evalTypedJSON(s string, p Provider, o *options) (string, bool, error) {
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return "", false, nil
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return "", false, nil
+	}
+	name, typ := s[2:i], s[i+1:len(s)-1]
+	switch typ {
+	case "int", "float", "bool", "json":
+	default:
+		return "", false, nil
+	}
+	for j, r := range name {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || j > 0 && '0' <= r && r <= '9') {
+			return "", false, nil
+		}
+	}
+	if name == "" {
+		return "", false, nil
+	}
+
+	v, err := evalWith("${"+name+"}", p, o)
+	if err != nil {
+		return "", true, err
+	}
+	t := strings.TrimSpace(v)
+	switch typ {
+	case "int":
+		if n, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10), true, nil
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(t, 64); err == nil && json.Valid([]byte(strconv.FormatFloat(f, 'g', -1, 64))) {
+			return strconv.FormatFloat(f, 'g', -1, 64), true, nil
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(t); err == nil {
+			return strconv.FormatBool(b), true, nil
+		}
+	case "json":
+		if t != "" && json.Valid([]byte(t)) {
+			return t, true, nil
+		}
+	}
+	return "", true, fmt.Errorf("value of %s is not a valid %s", name, typ)
+}
+
+// jsonEscape escapes v for the inside of a JSON string.
+func jsonEscape(v string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	s := strings.TrimSuffix(b.String(), "\n")
+	return s[1 : len(s)-1]
+}
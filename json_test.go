@@ -0,0 +1,67 @@
+package envsubst
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEvalJSON(t *testing.T) {
+	values := mapProvider{
+		"NAME":   "web",
+		"QUOTE":  "say \"hi\"\\now\n\t<b>",
+		"PORT":   " 8080 ",
+		"RATIO":  "0.50",
+		"DEBUG":  "1",
+		"TAGS":   `["a", "b"]`,
+		"BAD":    "eighty",
+		"OBJECT": `{"a": 1}`,
+	}
+	tests := []struct {
+		input, output string
+	}{
+		{`{"name": "${NAME}"}`, `{"name": "web"}`},
+		{`{"path": "C:\\${NAME}\\x\/"}`, `{"path": "C:\\web\\x\/"}`},
+		{`{"msg": "${QUOTE}"}`, `{"msg": "say \"hi\"\\now\n\t<b>"}`},
+		{`{"msg": "a\"${NAME}\""}`, `{"msg": "a\"web\""}`},
+		{`{"port": "${PORT:int}"}`, `{"port": 8080}`},
+		{`{"port": ${PORT:int}}`, `{"port": 8080}`},
+		{`{"ratio": "${RATIO:float}"}`, `{"ratio": 0.5}`},
+		{`{"debug": "${DEBUG:bool}"}`, `{"debug": true}`},
+		{`{"tags": "${TAGS:json}"}`, `{"tags": ["a", "b"]}`},
+		{`{"port": "port ${PORT:int}"}`, `{"port": "port  8080 "}`},
+		{`{"raw": ${OBJECT}}`, `{"raw": {"a": 1}}`},
+		{`{"lit": "$${NAME}", "x": $${NAME}}`, `{"lit": "${NAME}", "x": ${NAME}}`},
+		{`{"${NAME}": 1}`, `{"web": 1}`},
+	}
+	for _, test := range tests {
+		got, err := EvalJSON(test.input, values)
+		if test.output == "" {
+			if err == nil {
+				t.Errorf("Want error for %s, got %s", test.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("Want %s for %s, got %s", test.output, test.input, got)
+		}
+	}
+
+	got, err := EvalJSON(`{"msg": "${QUOTE}", "port": "${PORT:int}"}`, values)
+	var v struct {
+		Msg  string
+		Port int
+	}
+	if err != nil || json.Unmarshal([]byte(got), &v) != nil || v.Msg != values["QUOTE"] || v.Port != 8080 {
+		t.Errorf("Want valid JSON round-tripping the values, got %s, %v", got, err)
+	}
+
+	for _, input := range []string{`{"port": "${BAD:int}"}`, `{"x": "${BAD:json}"}`, `{"x": "${BAD:bool}"}`, `{"x": "${MISSING:float}"}`} {
+		if _, err := EvalJSON(input, values); err == nil {
+			t.Errorf("Want type error for %s", input)
+		}
+	}
+}
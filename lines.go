@@ -0,0 +1,72 @@
+package envsubst
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// LineError records the failure to evaluate a line of input.
+type LineError struct {
+	// Line is the 1-based line number.
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying evaluation error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// EvalLines reads r line by line, replaces ${var} in each line based on
+// the mapping function, and calls fn with the 1-based line number, the
+// input line and the expanded line, both without their line ending.
+// Each line is expanded independently, so expressions cannot span
+// lines. EvalLines stops at the first error returned by fn, or at the
+// first line that fails to evaluate, which is reported as a LineError.
+func EvalLines(r io.Reader, mapping func(string) string, fn func(lineno int, in, out string) error, opts ...Option) error {
+	o := newOptions(opts)
+	o.subs = new(int) // counted over all lines
+	p := funcProvider(mapping)
+	progress := progressTracker{options: o}
+	br := bufio.NewReader(r)
+	for lineno := 1; ; lineno++ {
+		if err := o.canceled(); err != nil {
+			return err
+		}
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			progress.add(0, 0, true)
+			return nil
+		}
+		in := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if lineno == 2 {
+			// only at the start of the input
+			o.stripBOM = false
+		}
+		out, xerr := evalWith(in, p, o)
+		if xerr != nil {
+			return &LineError{Line: lineno, Err: xerr}
+		}
+		if o.mode&parse.ParseDirectives != 0 {
+			o.disabled = parse.EndsDisabled(in, o.disabled)
+		}
+		if ferr := fn(lineno, in, out); ferr != nil {
+			return ferr
+		}
+		progress.add(len(line), len(out)+len(line)-len(in), err == io.EOF)
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
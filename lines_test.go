@@ -0,0 +1,44 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvalLines(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"name": "gopher"}[s]
+	}
+	input := "hello ${name}\r\nplain\n\n${missing:-x}"
+	var got []string
+	err := EvalLines(strings.NewReader(input), mapping, func(lineno int, in, out string) error {
+		got = append(got, fmt.Sprintf("%d|%s|%s", lineno, in, out))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1|hello ${name}|hello gopher", "2|plain|plain", "3||", "4|${missing:-x}|x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want lines %q, got %q", want, got)
+	}
+
+	err = EvalLines(strings.NewReader("a\n${b\nc\n"), mapping, func(int, string, string) error { return nil })
+	var lerr *LineError
+	if !errors.As(err, &lerr) || lerr.Line != 2 || !errors.Is(err, ErrBadSubstitution) {
+		t.Errorf("Want bad substitution on line 2, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	err = EvalLines(strings.NewReader("a\nb\nc\n"), mapping, func(int, string, string) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Want callback error to stop after 1 line, got %v after %d", err, n)
+	}
+}
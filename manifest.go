@@ -0,0 +1,100 @@
+package envsubst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DocumentError records the failure to evaluate a document of a
+// multi-document YAML stream.
+type DocumentError struct {
+	// Document is the 1-based index of the document in the stream.
+	Document int
+	Err      error
+}
+
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("document %d: %v", e.Document, e.Err)
+}
+
+// Unwrap returns the underlying evaluation error.
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// EvalManifests replaces ${var} in a stream of Kubernetes manifests,
+// documents separated by --- lines, evaluating each document as EvalYAML
+// does. The $(VAR) references Kubernetes expands in container commands,
+// arguments and env, and their $$(VAR) escapes, are left untouched: $$ is
+// copied as is rather than read as an escaped $. A document failing to
+// evaluate is reported as a DocumentError.
+func EvalManifests(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	var b strings.Builder
+	for n, doc := range splitDocuments(s) {
+		v, err := EvalYAML(keepDollars(doc), p, opts...)
+		if err != nil {
+			return "", &DocumentError{Document: n + 1, Err: err}
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+// splitDocuments splits a YAML stream before each --- separator line
+// that is not the first line, so that separators start the documents
+// they open.
+func splitDocuments(s string) []string {
+	var docs []string
+	start := 0
+	for i := 0; i < len(s); {
+		end := strings.IndexByte(s[i:], '\n')
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += i + 1
+		}
+		if i > start && isSeparator(s[i:end]) {
+			docs = append(docs, s[start:i])
+			start = i
+		}
+		i = end
+	}
+	return append(docs, s[start:])
+}
+
+// isSeparator reports whether the line is a --- document separator,
+// possibly followed by content or a comment.
+func isSeparator(line string) bool {
+	if !strings.HasPrefix(line, "---") {
+		return false
+	}
+	rest := line[3:]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n'
+}
+
+// keepDollars doubles the $$ escapes outside references, so that they
+// evaluate to themselves.
+func keepDollars(s string) string {
+	if !strings.Contains(s, "$$") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			j := skipReference(s, i)
+			b.WriteString(s[i:j])
+			i = j
+		case strings.HasPrefix(s[i:], "$$"):
+			b.WriteString("$$$$")
+			i += 2
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
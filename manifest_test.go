@@ -0,0 +1,58 @@
+package envsubst
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvalManifests(t *testing.T) {
+	values := mapProvider{
+		"IMAGE": "repo/web:1.0",
+		"MSG":   "hello: world",
+	}
+	input := `apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: ${IMAGE}
+    command: ["sh", "-c", "echo $(GREETING) $$(LITERAL) ${IMAGE}"]
+    env:
+    - name: ADDR
+      value: $(POD_IP):8080
+    - name: ESCAPED
+      value: $$(POD_IP) $${IMAGE}
+---
+kind: ConfigMap
+data:
+  msg: ${MSG}
+`
+	want := `apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: repo/web:1.0
+    command: ["sh", "-c", "echo $(GREETING) $$(LITERAL) repo/web:1.0"]
+    env:
+    - name: ADDR
+      value: $(POD_IP):8080
+    - name: ESCAPED
+      value: $$(POD_IP) $${IMAGE}
+---
+kind: ConfigMap
+data:
+  msg: "hello: world"
+`
+	got, err := EvalManifests(input, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+
+	_, err = EvalManifests("a: 1\n---\nb: ${x\n", values)
+	var derr *DocumentError
+	if !errors.As(err, &derr) || derr.Document != 2 {
+		t.Errorf("Want error for document 2, got %v", err)
+	}
+}
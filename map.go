@@ -0,0 +1,125 @@
+package envsubst
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ExpandMap replaces ${var} in every string value of m based on the
+// mapping function, descending into nested maps and slices as produced
+// by yaml.Unmarshal or json.Unmarshal. The map is modified in place.
+//
+// Map keys are left unchanged unless the ExpandKeys option is given. It
+// is an error for an expanded key to collide with another key.
+func ExpandMap(m map[string]interface{}, mapping func(string) string, opts ...Option) error {
+	o := newOptions(opts)
+	_, err := expandAny(m, mapping, o)
+	return err
+}
+
+// expandAny expands the value v, returning the expanded value. Maps and
+// slices are expanded in place.
+func expandAny(v interface{}, mapping func(string) string, o *options) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return evalWith(v, funcProvider(mapping), o)
+	case []string:
+		for i := range v {
+			s, err := evalWith(v[i], funcProvider(mapping), o)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = s
+		}
+	case []interface{}:
+		for i := range v {
+			e, err := expandAny(v[i], mapping, o)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		renamed := make(map[string]interface{})
+		for _, k := range keys {
+			e, err := expandAny(v[k], mapping, o)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+			if !o.keys {
+				continue
+			}
+			nk, err := evalWith(k, funcProvider(mapping), o)
+			if err != nil {
+				return nil, err
+			}
+			if nk != k {
+				renamed[nk] = e
+				delete(v, k)
+			}
+		}
+		for _, k := range sortedNames(renamed) {
+			if _, ok := v[k]; ok {
+				return nil, fmt.Errorf("expanded key %s collides with an existing key", k)
+			}
+			v[k] = renamed[k]
+		}
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sortAny(keys)
+		renamed := make(map[string]interface{})
+		for _, k := range keys {
+			e, err := expandAny(v[k], mapping, o)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+			ks, ok := k.(string)
+			if !o.keys || !ok {
+				continue
+			}
+			nk, err := evalWith(ks, funcProvider(mapping), o)
+			if err != nil {
+				return nil, err
+			}
+			if nk != ks {
+				renamed[nk] = e
+				delete(v, k)
+			}
+		}
+		for _, k := range sortedNames(renamed) {
+			if _, ok := v[k]; ok {
+				return nil, fmt.Errorf("expanded key %s collides with an existing key", k)
+			}
+			v[k] = renamed[k]
+		}
+	}
+	return v, nil
+}
+
+// sortedNames returns the keys of the map in sorted order.
+func sortedNames(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortAny sorts the map keys by their string representation, so that
+// they are expanded in a deterministic order.
+func sortAny(keys []interface{}) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+}
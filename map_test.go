@@ -0,0 +1,57 @@
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandMap(t *testing.T) {
+	params := map[string]string{"HOST": "localhost", "PORT": "5432", "NAME": "primary"}
+	mapping := func(s string) string {
+		return params[s]
+	}
+
+	m := map[string]interface{}{
+		"host": "${HOST}",
+		"port": 5432,
+		"${NAME}": map[string]interface{}{
+			"url":   "postgres://${HOST}:${PORT}",
+			"flags": []interface{}{"--port=${PORT}", true},
+		},
+		"legacy": map[interface{}]interface{}{
+			"${NAME}": "${HOST}",
+			1:         "${PORT}",
+		},
+	}
+	if err := ExpandMap(m, mapping, ExpandKeys()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"host": "localhost",
+		"port": 5432,
+		"primary": map[string]interface{}{
+			"url":   "postgres://localhost:5432",
+			"flags": []interface{}{"--port=5432", true},
+		},
+		"legacy": map[interface{}]interface{}{
+			"primary": "localhost",
+			1:         "5432",
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Want map expanded to %v, got %v", want, m)
+	}
+
+	m = map[string]interface{}{"${NAME}": "a"}
+	if err := ExpandMap(m, mapping); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["${NAME}"]; !ok {
+		t.Errorf("Expect keys unchanged without ExpandKeys, got %v", m)
+	}
+
+	m = map[string]interface{}{"${NAME}": "a", "primary": "b"}
+	if err := ExpandMap(m, mapping, ExpandKeys()); err == nil {
+		t.Errorf("Expect error when expanded key collides")
+	}
+}
@@ -0,0 +1,106 @@
+package envsubst
+
+import (
+	"fmt"
+	"strings"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// modelinePrefix starts the text of a modeline comment.
+const modelinePrefix = "envsubst:"
+
+// Modelines applies the options of a modeline found on the first line
+// of the input, on top of the options given. A modeline is a comment
+// such as
+//
+//	# envsubst: strict no-empty syntax=posix
+//
+// so that files can carry their settings rather than the tools that
+// render them. The modeline is copied to the output like any comment.
+// Modelines are honoured by EvalProvider and the functions built on it,
+// such as Eval and EvalMap, and by the streaming functions, and through
+// them by RenderDir, RenderFS and ExpandFS. See ParseModeline for the
+// settings.
+func Modelines() Option {
+	return func(o *options) {
+		o.modeline = true
+	}
+}
+
+// ParseModeline returns the options set by the modeline on the first
+// line of s, or nil if there is none. A modeline is a comment, as
+// recognized by the Directives option, whose text starts with
+// "envsubst:" followed by a blank and a list of settings:
+//
+//   - strict: StrictSyntax
+//   - no-unset: NoUnset
+//   - no-empty: NoEmpty
+//   - no-unexpanded: NoUnexpanded
+//   - keep-unresolved: KeepUnresolved
+//   - directives: Directives
+//   - pipelines: Pipelines
+//   - dotted-names: DottedNames
+//   - schemes: SchemeReferences
+//   - syntax=posix: disables the syntax extensions enabled by the
+//     options above or given by the caller, leaving the ${...} forms of
+//     the shell
+//
+// An unknown setting is an error.
+func ParseModeline(s string) ([]Option, error) {
+	line := strings.TrimPrefix(s, bom)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	text, ok := parse.Comment(line)
+	if !ok || !strings.HasPrefix(text, modelinePrefix) {
+		return nil, nil
+	}
+	settings := text[len(modelinePrefix):]
+	if settings != "" && settings[0] != ' ' && settings[0] != '\t' {
+		return nil, nil // a directive such as envsubst:off
+	}
+	var opts []Option
+	for _, setting := range strings.Fields(settings) {
+		opt, ok := modelineSettings[setting]
+		if !ok {
+			return nil, fmt.Errorf("unknown modeline setting %s", quote(setting))
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// modelineSettings maps the settings of modelines to their options.
+var modelineSettings = map[string]Option{
+	"strict":          StrictSyntax(),
+	"no-unset":        NoUnset(),
+	"no-empty":        NoEmpty(),
+	"no-unexpanded":   NoUnexpanded(),
+	"keep-unresolved": KeepUnresolved(),
+	"directives":      Directives(),
+	"pipelines":       Pipelines(),
+	"dotted-names":    DottedNames(),
+	"schemes":         SchemeReferences(),
+	"syntax=posix": func(o *options) {
+		o.mode &^= parse.ParsePipelines | parse.ParseDottedNames | parse.ParseSchemes | parse.ParseDirectives | parse.ParsePathNames
+	},
+}
+
+// applyModeline applies the options of the modeline of s, if enabled by
+// the Modelines option, to o. It only applies once, to the start of
+// the input.
+func applyModeline(s string, o *options) error {
+	if !o.modeline {
+		return nil
+	}
+	o.modeline = false
+	opts, err := ParseModeline(s)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return nil
+}
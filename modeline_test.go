@@ -0,0 +1,60 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestModelines(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"NAME": "web"}[s]
+	}
+	input := "# envsubst: no-unset\nname: ${NAME}\nport: ${PORT}\n"
+	if _, err := Eval(input, mapping, Modelines()); !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want the modeline to enable NoUnset, got %v", err)
+	}
+	if _, err := Eval(input, mapping); err != nil {
+		t.Errorf("Want the modeline ignored without the option, got %v", err)
+	}
+	_, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping, Modelines()))
+	if !errors.Is(err, ErrMissingVar) {
+		t.Errorf("Want the modeline applied when streaming, got %v", err)
+	}
+
+	input = "// envsubst: pipelines\nname: ${NAME|upper}\n"
+	funcs := Funcs(FuncMap{"upper": func(s string) (string, error) { return strings.ToUpper(s), nil }})
+	got, err := Eval(input, mapping, Modelines(), funcs)
+	if want := "// envsubst: pipelines\nname: WEB\n"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	input = "# envsubst: syntax=posix\nname: ${NAME|upper}\n"
+	if _, err := Eval(input, mapping, Modelines(), funcs, Pipelines()); err == nil {
+		t.Errorf("Want syntax=posix to disable pipelines")
+	}
+	input = "# envsubst: syntax=posix\n# envsubst:off\nname: ${NAME}\n"
+	got, err = Eval(input, mapping, Modelines(), Directives())
+	if want := "# envsubst: syntax=posix\n# envsubst:off\nname: web\n"; err != nil || got != want {
+		t.Errorf("Want syntax=posix to disable directives, got %q, %v", got, err)
+	}
+
+	tests := []struct {
+		input string
+		n     int
+		err   bool
+	}{
+		{"# envsubst: strict no-empty syntax=posix\n", 3, false},
+		{"<!-- envsubst: directives -->", 1, false},
+		{"# envsubst:off\n", 0, false},
+		{"name: ${NAME}\n# envsubst: strict\n", 0, false},
+		{"# envsubst: fancy\n", 0, true},
+	}
+	for _, test := range tests {
+		opts, err := ParseModeline(test.input)
+		if len(opts) != test.n || (err != nil) != test.err {
+			t.Errorf("Want %d options for %q, got %d, %v", test.n, test.input, len(opts), err)
+		}
+	}
+}
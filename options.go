@@ -0,0 +1,573 @@
+package envsubst
+
+import (
+	"context"
+	"path"
+	"runtime"
+	"strings"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// Option configures the behaviour of the evaluation functions. Options
+// that do not apply to a given function are ignored.
+type Option func(*options)
+
+// options holds the settings collected from a list of Option values.
+type options struct {
+	workers    int
+	sequential bool
+	keys       bool
+	noUnset    bool
+	noEmpty    bool
+
+	// glob patterns selecting the files rendered by RenderDir and
+	// RenderFS, every file if include is empty
+	include []string
+	exclude []string
+
+	// report ${...} references remaining in the output
+	noUnexpanded bool
+
+	// the colon default forms keep the empty values of defined
+	// variables, as EvalMap does unless ColonDefaults is given
+	keepEmpty bool
+
+	// remove a leading byte order mark from the input
+	stripBOM bool
+	// leave lines of binary data unexpanded
+	skipBinary bool
+	// the input starts in a region disabled by directives, updated
+	// by the streaming functions as they progress
+	disabled bool
+	// apply the options of a modeline on the first line of the input
+	modeline bool
+	// parse a frontmatter block declaring variables at the start of
+	// the input
+	frontmatter bool
+	// resolve each variable once per execution
+	intern bool
+
+	// decides the handling of each unresolved reference,
+	// unless noUnset is set.
+	unresolved func(key string) Policy
+
+	// functions callable from templates
+	funcs FuncMap
+
+	// syntax extensions enabled and limits enforced when parsing
+	mode   parse.Mode
+	limits parse.Limits
+
+	// maximum nesting of recursive expansion, disabled if zero
+	depth int
+
+	// cancels the streaming functions, if set
+	ctx context.Context
+
+	// receives the progress of the streaming functions, if set
+	progress func(Progress)
+
+	// maximum input buffered by the streaming functions, disabled if
+	// zero or less
+	maxBuffer int
+
+	// maximum number of substitutions per execution, disabled if
+	// zero, and the count shared by nested executions, if any
+	maxSubs int
+	subs    *int
+
+	// receives the warnings raised during execution, if set
+	warn func(Warning)
+	// warning codes promoted to errors, all if empty and promoteAll
+	promote    []string
+	promoteAll bool
+
+	// reports whether the value of a variable is secret, if set
+	secret func(key string) bool
+
+	// hooks wrapping each variable lookup
+	before []func(key string) string
+	after  []func(key, value string, ok bool) (string, bool, error)
+}
+
+// defaultMaxBuffer is the default limit of the MaxBuffer option.
+const defaultMaxBuffer = 1 << 20
+
+// newOptions applies the list of options over the default settings.
+func newOptions(opts []Option) *options {
+	o := &options{
+		workers:   runtime.GOMAXPROCS(0),
+		maxBuffer: defaultMaxBuffer,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Workers sets the maximum number of inputs evaluated concurrently by
+// the batch functions. Values less than one are ignored and the default
+// of runtime.GOMAXPROCS(0) is used.
+func Workers(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// Include restricts the files rendered by RenderDir and RenderFS to
+// those matching one of the glob patterns, as path.Match matches them
+// against the slash-separated path of the file or, for patterns without
+// a slash, against its base name. A ** element of a pattern matches any
+// number of directories, so that vendor/** matches every file under
+// vendor and **/testdata/* the files of any testdata directory. Other
+// files are copied unchanged. The option may be given several times.
+func Include(patterns ...string) Option {
+	return func(o *options) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// Exclude copies the files matching one of the glob patterns unchanged
+// from RenderDir and RenderFS, even if they are included, see Include.
+// The option may be given several times.
+func Exclude(patterns ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// renders reports whether the file at the slash-separated path is
+// rendered, according to the Include and Exclude options.
+func (o *options) renders(name string) bool {
+	return (len(o.include) == 0 || matchAny(o.include, name)) && !matchAny(o.exclude, name)
+}
+
+// matchAny reports whether one of the glob patterns matches the path or,
+// for patterns without a slash, its base name.
+func matchAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	elems := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		if matchElems(strings.Split(pattern, "/"), elems) {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, base); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchElems matches the elements of a path against those of a pattern,
+// a ** element matching any number of them.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Sequential allows each entry expanded by ExpandSlice to reference the
+// variables defined by the entries before it, like a sequence of shell
+// assignments. Earlier entries take precedence over the mapping.
+func Sequential() Option {
+	return func(o *options) {
+		o.sequential = true
+	}
+}
+
+// ExpandKeys enables expansion of string map keys by ExpandMap and
+// ExpandStruct, in addition to values.
+func ExpandKeys() Option {
+	return func(o *options) {
+		o.keys = true
+	}
+}
+
+// NoUnset reports references to undefined variables as an error, unless
+// a default value is given. All undefined variables are listed in the
+// error. Eval treats empty values as undefined, since its mapping
+// function cannot tell them apart.
+func NoUnset() Option {
+	return func(o *options) {
+		o.noUnset = true
+	}
+}
+
+// ColonDefaults makes ${var:-default} and ${var:=default} use the
+// default when var is defined but empty, as bash does, in EvalMap, where
+// these forms keep the empty value otherwise. The other functions always
+// follow bash.
+func ColonDefaults() Option {
+	return func(o *options) {
+		o.keepEmpty = false
+	}
+}
+
+// keepEmpty makes the colon default forms keep empty values, see
+// ColonDefaults.
+func keepEmpty() Option {
+	return func(o *options) {
+		o.keepEmpty = true
+	}
+}
+
+// NoEmpty reports substitutions that result in an empty value as an
+// error. A non-empty default value satisfies the check.
+func NoEmpty() Option {
+	return func(o *options) {
+		o.noEmpty = true
+	}
+}
+
+// NoUnexpanded scans the output for remaining ${...} references and
+// reports them as an UnexpandedError, to catch references that were
+// kept by KeepUnresolved or produced by escapes and values, such as a
+// misspelled variable in a partial expansion pipeline.
+func NoUnexpanded() Option {
+	return func(o *options) {
+		o.noUnexpanded = true
+	}
+}
+
+// StripBOM removes a leading UTF-8 byte order mark from the input, which
+// is otherwise copied to the output unchanged like any other text. For
+// the streaming functions, only the mark at the start of the stream is
+// removed.
+func StripBOM() Option {
+	return func(o *options) {
+		o.stripBOM = true
+	}
+}
+
+// InternValues resolves each variable once per execution and reuses
+// the value for every later reference, so that templates referencing
+// the same variable many times neither repeat the lookup nor allocate
+// the value again. Lookup errors are not retained.
+func InternValues() Option {
+	return func(o *options) {
+		o.intern = true
+	}
+}
+
+// SkipBinary leaves the lines of input that hold binary data, a NUL
+// byte or invalid UTF-8, unchanged: references and escapes on them are
+// copied to the output verbatim, and they cannot fail to parse. Input
+// positions reported after such a line may be offset by the escapes
+// added to it. RenderDir copies the files holding a NUL byte in their
+// first 8000 bytes unchanged, as git detects binary files.
+func SkipBinary() Option {
+	return func(o *options) {
+		o.skipBinary = true
+	}
+}
+
+// KeepUnresolved leaves references to undefined variables without a
+// default value verbatim in the output, instead of replacing them with
+// the empty string, so that a later evaluation can resolve them. It has
+// no effect when combined with NoUnset.
+func KeepUnresolved() Option {
+	return UnresolvedPolicy(func(string) Policy {
+		return PolicyKeep
+	})
+}
+
+// Policy specifies the handling of a reference to an undefined variable
+// without a default value.
+type Policy int
+
+const (
+	// PolicyEmpty replaces the reference with the empty string.
+	PolicyEmpty Policy = iota
+	// PolicyKeep leaves the reference verbatim in the output.
+	PolicyKeep
+	// PolicyError reports the variable as undefined, like NoUnset.
+	PolicyError
+)
+
+// UnresolvedPolicy calls fn with the name of each undefined variable
+// referenced without a default value to decide how the reference is
+// handled. It replaces any previous KeepUnresolved or UnresolvedPolicy
+// option and has no effect when combined with NoUnset.
+func UnresolvedPolicy(fn func(key string) Policy) Option {
+	return func(o *options) {
+		o.unresolved = fn
+	}
+}
+
+// policy returns the handling of an unresolved reference to key.
+func (o *options) policy(key string) Policy {
+	switch {
+	case o.noUnset:
+		return PolicyError
+	case o.unresolved != nil:
+		return o.unresolved(key)
+	}
+	return PolicyEmpty
+}
+
+// Warnings calls fn with each warning raised during execution, such as
+// empty substitutions or unbraced references like $HOME. Warnings do
+// not abort execution.
+func Warnings(fn func(Warning)) Option {
+	return func(o *options) {
+		o.warn = fn
+	}
+}
+
+// WarningsAsErrors promotes the warnings with the given codes, or all
+// warnings if no code is given, to errors. Execution fails with a
+// WarningError at the first promoted warning.
+func WarningsAsErrors(codes ...string) Option {
+	return func(o *options) {
+		if len(codes) == 0 {
+			o.promoteAll = true
+		}
+		o.promote = append(o.promote, codes...)
+	}
+}
+
+// promotes reports whether warnings with the code are errors.
+func (o *options) promotes(code string) bool {
+	return o.promoteAll || contains(o.promote, code)
+}
+
+// warns reports whether warnings are collected or promoted.
+func (o *options) warns() bool {
+	return o.warn != nil || o.promoteAll || len(o.promote) != 0
+}
+
+// Secrets marks the named variables as secret. Their values are
+// replaced by RedactedValue in substitution reports and events, and in
+// the messages of errors returned by execution. The output is not
+// redacted.
+func Secrets(keys ...string) Option {
+	return SecretFunc(func(key string) bool {
+		return contains(keys, key)
+	})
+}
+
+// SecretFunc marks the variables for which fn returns true as secret,
+// like Secrets. It adds to any previous Secrets or SecretFunc option.
+func SecretFunc(fn func(key string) bool) Option {
+	return func(o *options) {
+		if prev := o.secret; prev != nil {
+			o.secret = func(key string) bool {
+				return prev(key) || fn(key)
+			}
+			return
+		}
+		o.secret = fn
+	}
+}
+
+// isSecret reports whether the value of the variable is secret.
+func (o *options) isSecret(key string) bool {
+	return o.secret != nil && o.secret(key)
+}
+
+// BeforeLookup adds a hook called with the name of each referenced
+// variable before it is looked up. The variable is looked up by the
+// name returned by the hook, which allows mapping prefixes or aliases.
+// Hooks are called in the order they are given.
+func BeforeLookup(fn func(key string) string) Option {
+	return func(o *options) {
+		o.before = append(o.before, fn)
+	}
+}
+
+// AfterLookup adds a hook called with the result of each variable
+// lookup, before any substitution function or default value is
+// applied. The hook may transform the value, report the variable as
+// undefined by returning false, or abort execution with an error.
+// Hooks are called in the order they are given.
+func AfterLookup(fn func(key, value string, ok bool) (string, bool, error)) Option {
+	return func(o *options) {
+		o.after = append(o.after, fn)
+	}
+}
+
+// FuncMap is the map of functions callable from templates by name, as
+// in ${name(var)}. Calls may be nested, as in ${sha256(trim(var))}, and
+// are applied to the value of the variable.
+type FuncMap map[string]func(value string) (string, error)
+
+// Pipelines enables the ${var|filter|filter} syntax when parsing, which
+// passes the value of the variable through a chain of the functions
+// added with Funcs, from left to right.
+func Pipelines() Option {
+	return func(o *options) {
+		o.mode |= parse.ParsePipelines
+	}
+}
+
+// DottedNames allows dots in variable names when parsing, as in
+// ${database.primary.host}, to reference the values of nested documents
+// served by the provider returned by Values.
+func DottedNames() Option {
+	return func(o *options) {
+		o.mode |= parse.ParseDottedNames
+	}
+}
+
+// PathNames allows variable names that are slash-separated paths
+// starting with a slash when parsing, as in ${/app/prod/db_password}, so
+// that providers keyed by paths, such as the Parameter Store provider of
+// gomodules.xyz/envsubst/provider/aws, resolve full names. The
+// replacement operators cannot follow such names.
+func PathNames() Option {
+	return func(o *options) {
+		o.mode |= parse.ParsePathNames
+	}
+}
+
+// SchemeReferences enables the ${scheme:reference} syntax when parsing,
+// as in ${env:HOME} or ${file:/etc/hostname}, resolving the variable
+// named scheme:reference, which the provider returned by Schemes
+// dispatches to the provider registered for the scheme. Only the
+// operators starting with a colon, such as :-, may follow a reference.
+func SchemeReferences() Option {
+	return func(o *options) {
+		o.mode |= parse.ParseSchemes
+	}
+}
+
+// Directives enables the envsubst:off and envsubst:on directives,
+// comment lines such as "# envsubst:off" or "// envsubst:on": the lines
+// between an off directive and the next on directive, or the end of the
+// input, are copied verbatim, without substitution or escapes. The
+// comment may start with #, //, /*, <!--, ; or --. The streaming
+// functions only split their input at line breaks with this option.
+func Directives() Option {
+	return func(o *options) {
+		o.mode |= parse.ParseDirectives
+	}
+}
+
+// MaxSubstitutions limits the number of substitutions performed by an
+// execution, including those performed while expanding values with the
+// Recursive option and over all the passes of ExpandUntilStable.
+// Execution fails with a LimitError when the limit is exceeded.
+func MaxSubstitutions(n int) Option {
+	return func(o *options) {
+		o.maxSubs = n
+	}
+}
+
+// Context sets a context for the streaming functions, such as NewReader,
+// NewWriter, EvalCopy and EvalLines. They stop and return ctx.Err()
+// once the context is done, checking it before each chunk or line of
+// input.
+func Context(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// canceled returns the error of the context, if any.
+func (o *options) canceled() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// ReportProgress calls fn periodically with the progress of the
+// streaming functions, about every 32 KiB of input and once at the end
+// of the input.
+func ReportProgress(fn func(Progress)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// MaxBuffer limits the memory used by the streaming functions, such as
+// NewReader and NewWriter, to buffer input: the input following the
+// last complete ${...} expression is buffered until the expression is
+// complete, so an expression longer than n bytes, or an unterminated ${,
+// fails with a LimitError. The default limit is 1 MiB; values of zero
+// or less disable the limit.
+func MaxBuffer(n int) Option {
+	return func(o *options) {
+		o.maxBuffer = n
+	}
+}
+
+// StrictSyntax rejects suspicious constructs when parsing with a
+// ParseError, instead of accepting them and rendering them literally or
+// incorrectly: a lone $ at the end of the input or before whitespace,
+// $ followed by a digit or by space and {, the unsupported :+ operator,
+// and unbalanced quotes in operands. Use $$ for a literal $.
+func StrictSyntax() Option {
+	return func(o *options) {
+		o.mode |= parse.ParseStrict
+	}
+}
+
+// MaxDepth limits the nesting of ${...} expressions when parsing. Parse
+// returns a LimitError if the template exceeds the limit.
+func MaxDepth(n int) Option {
+	return func(o *options) {
+		o.limits.Depth = n
+	}
+}
+
+// MaxExpressions limits the number of ${...} expressions when parsing.
+// Parse returns a LimitError if the template exceeds the limit.
+func MaxExpressions(n int) Option {
+	return func(o *options) {
+		o.limits.Exprs = n
+	}
+}
+
+// MaxOperandLength limits the length in bytes of function operands,
+// such as patterns and default values, when parsing. Parse returns a
+// LimitError if the template exceeds the limit.
+func MaxOperandLength(n int) Option {
+	return func(o *options) {
+		o.limits.Operand = n
+	}
+}
+
+// Recursive enables the expansion of variable values that themselves
+// contain ${var} references, up to depth levels of nesting. References
+// are resolved with the same provider and options. Exceeding the depth,
+// or a variable referencing itself directly or indirectly, is an error.
+func Recursive(depth int) Option {
+	return func(o *options) {
+		o.depth = depth
+	}
+}
+
+// Funcs adds the functions of the map to the functions callable from
+// templates, replacing any previously added function with the same
+// name. Calling a function that was not added is an error.
+func Funcs(funcs FuncMap) Option {
+	return func(o *options) {
+		if o.funcs == nil {
+			o.funcs = make(FuncMap)
+		}
+		for name, fn := range funcs {
+			o.funcs[name] = fn
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// template returns a large template of n lines mixing text, escapes and
+// expressions.
+func template(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString("key_${NAME}: ${VALUE:-default value} costs $$5 in C:\\\\dir, ${#LIST}\n")
+	}
+	return b.String()
+}
+
+// nested returns an expression nesting n default values.
+func nested(n int) string {
+	return strings.Repeat("${A:-", n) + "x" + strings.Repeat("}", n)
+}
+
+func benchmarkParse(b *testing.B, s string) {
+	b.SetBytes(int64(len(s)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	benchmarkParse(b, template(1000))
+}
+
+func BenchmarkParseShort(b *testing.B) {
+	benchmarkParse(b, "${HOME}/bin")
+}
+
+func BenchmarkParseOperators(b *testing.B) {
+	benchmarkParse(b, strings.Repeat("${a,} ${a,,} ${a^^} ${#a} ${a#x*} ${a%%.*} ${a:1:2} ${a/x/y} ${a//x/y} ${a/#x/y} ${a:=d} ${a=d}\n", 100))
+}
+
+func BenchmarkParseLiteral(b *testing.B) {
+	benchmarkParse(b, strings.Repeat(strings.Repeat("plain literal text ", 50)+"\n", 1000)+"${VAR}")
+}
+
+func BenchmarkParseEscaped(b *testing.B) {
+	benchmarkParse(b, strings.Repeat("$$", 10000))
+}
+
+func BenchmarkParseEscapedOperands(b *testing.B) {
+	benchmarkParse(b, strings.Repeat(`${PATH//\/\//\\} ${A:-C:\\dir$$1} `, 1000))
+}
+
+func BenchmarkParseNested(b *testing.B) {
+	benchmarkParse(b, nested(1000))
+}
+
+func BenchmarkParseRelease(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree, err := Parse("id=${ID}, name=${NAME:-none}, path=${PATH##*/}")
+		if err != nil {
+			b.Fatal(err)
+		}
+		tree.Release()
+	}
+}
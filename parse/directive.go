@@ -0,0 +1,83 @@
+package parse
+
+import "strings"
+
+// comment leaders and trailers recognized around directives.
+var (
+	commentLeaders  = []string{"<!--", "/*", "//", "#", ";", "--"}
+	commentTrailers = []string{"-->", "*/"}
+)
+
+// Comment returns the text of the line if it is a comment, without
+// the comment leader and trailer and surrounding blanks. Comments start
+// with #, //, /*, <!--, ; or --, possibly repeated as in ##.
+func Comment(line string) (string, bool) {
+	s := strings.TrimSpace(line)
+	for _, c := range commentLeaders {
+		if strings.HasPrefix(s, c) {
+			s = strings.TrimLeft(s[len(c):], c[len(c)-1:])
+			for _, c := range commentTrailers {
+				s = strings.TrimSuffix(s, c)
+			}
+			return strings.TrimSpace(s), true
+		}
+	}
+	return "", false
+}
+
+// directive returns the directive of the line, "off" or "on", or the
+// empty string if the line holds none. A directive is a comment
+// holding only envsubst:off or envsubst:on, such as
+// "# envsubst:off" or "<!-- envsubst:on -->".
+func directive(line string) string {
+	switch s, _ := Comment(line); s {
+	case "envsubst:off":
+		return "off"
+	case "envsubst:on":
+		return "on"
+	}
+	return ""
+}
+
+// disabledRegions appends to regions the start and end positions of the
+// regions of s disabled by directives: the lines following an off
+// directive up to the next on directive, or the end of s. Lines are
+// scanned from position i, which starts a disabled region if disabled
+// is set. It also returns
+// whether s ends in a disabled region.
+func disabledRegions(s string, i int, disabled bool, regions [][2]int) ([][2]int, bool) {
+	start := i
+	for i < len(s) {
+		end := strings.IndexByte(s[i:], '\n')
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += i + 1
+		}
+		switch directive(s[i:end]) {
+		case "off":
+			if !disabled {
+				disabled, start = true, end
+			}
+		case "on":
+			if disabled {
+				if start < i {
+					regions = append(regions, [2]int{start, i})
+				}
+				disabled = false
+			}
+		}
+		i = end
+	}
+	if disabled && start < len(s) {
+		regions = append(regions, [2]int{start, len(s)})
+	}
+	return regions, disabled
+}
+
+// EndsDisabled reports whether the input s ends in a region disabled by
+// directives, given whether it starts in one, see ParseDirectives.
+func EndsDisabled(s string, disabled bool) bool {
+	_, disabled = disabledRegions(s, 0, disabled, nil)
+	return disabled
+}
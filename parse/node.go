@@ -1,26 +1,42 @@
 package parse
 
+import "sync"
+
 // Node is an element in the parse tree.
 type Node interface {
 	node()
 }
 
+// Pos represents a byte position in the original input text.
+type Pos int
+
 // empty string node
 var empty = new(TextNode)
 
 // a template is represented by a tree consisting of one
 // or more of the following nodes.
 type (
-	// TextNode represents a string of text.
+	// TextNode represents a string of text. Pos and End are the
+	// byte offsets of the text in the original input, End being
+	// exclusive. The Value may be shorter than the input it spans
+	// when escape characters were removed.
 	TextNode struct {
 		Value string
+		Pos   Pos
+		End   Pos
 	}
 
-	// FuncNode represents a string function.
+	// FuncNode represents a string function. Funcs lists the
+	// registered functions applied in order to the parameter value.
+	// Pos and End are the byte offsets of the ${...} expression in
+	// the original input, End being exclusive.
 	FuncNode struct {
 		Param string
 		Name  string
 		Args  []Node
+		Funcs []string
+		Pos   Pos
+		End   Pos
 	}
 
 	// ListNode represents a list of nodes.
@@ -64,19 +80,62 @@ type (
 	// }
 )
 
+// pools of the nodes released by Tree.Release, from which the nodes
+// of later trees are allocated.
+var (
+	textNodes = sync.Pool{New: func() interface{} { return new(TextNode) }}
+	funcNodes = sync.Pool{New: func() interface{} { return new(FuncNode) }}
+	listNodes = sync.Pool{New: func() interface{} { return new(ListNode) }}
+)
+
 // newTextNode returns a new TextNode.
-func newTextNode(text string) *TextNode {
-	return &TextNode{Value: text}
+func newTextNode(text string, pos, end Pos) *TextNode {
+	node := textNodes.Get().(*TextNode)
+	node.Value, node.Pos, node.End = text, pos, end
+	return node
 }
 
 // newListNode returns a new ListNode.
 func newListNode(nodes ...Node) *ListNode {
-	return &ListNode{Nodes: nodes}
+	node := listNodes.Get().(*ListNode)
+	node.Nodes = append(node.Nodes, nodes...)
+	return node
 }
 
 // newFuncNode returns a new FuncNode.
 func newFuncNode(name string) *FuncNode {
-	return &FuncNode{Param: name}
+	node := funcNodes.Get().(*FuncNode)
+	node.Param = name
+	return node
+}
+
+// release resets the node and its children and returns them to their
+// pools, keeping the capacity of their slices.
+func release(node Node) {
+	switch node := node.(type) {
+	case *TextNode:
+		if node != empty {
+			*node = TextNode{}
+			textNodes.Put(node)
+		}
+	case *ListNode:
+		for i, n := range node.Nodes {
+			release(n)
+			node.Nodes[i] = nil
+		}
+		node.Nodes = node.Nodes[:0]
+		listNodes.Put(node)
+	case *FuncNode:
+		for i, n := range node.Args {
+			release(n)
+			node.Args[i] = nil
+		}
+		for i := range node.Funcs {
+			node.Funcs[i] = ""
+		}
+		*node = FuncNode{Args: node.Args[:0], Funcs: node.Funcs[:0]}
+		funcNodes.Put(node)
+	}
 }
 
 // node() defines the node in a parse tree
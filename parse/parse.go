@@ -1,42 +1,193 @@
 package parse
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
 
 // ErrBadSubstitution represents a substitution parsing error.
 var ErrBadSubstitution = errors.New("bad substitution")
 
+// Limits bounds the complexity of the parsed input, for use with
+// untrusted templates. A zero value means no limit.
+type Limits struct {
+	// Depth is the maximum nesting of ${...} expressions.
+	Depth int
+	// Exprs is the maximum number of ${...} expressions.
+	Exprs int
+	// Operand is the maximum length in bytes of a function operand.
+	Operand int
+}
+
+// LimitError is returned when the input exceeds one of the limits.
+type LimitError struct {
+	// Limit names the limit that was exceeded.
+	Limit string
+	// Max is the value of the limit.
+	Max int
+	// Pos is the position in the input where the limit was exceeded.
+	Pos Pos
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// UnterminatedError is returned when the input ends before the closing
+// bracket of a ${...} expression. It matches ErrBadSubstitution with
+// errors.Is.
+type UnterminatedError struct {
+	// Pos is the position in the input of the opening ${.
+	Pos Pos
+}
+
+func (e *UnterminatedError) Error() string {
+	return "unterminated ${, missing closing }"
+}
+
+// Is reports whether target is ErrBadSubstitution.
+func (e *UnterminatedError) Is(target error) bool {
+	return target == ErrBadSubstitution
+}
+
+// Mode is a set of flags enabling optional syntax extensions.
+type Mode uint
+
+const (
+	// ParsePipelines enables the ${param|filter|filter} syntax.
+	ParsePipelines Mode = 1 << iota
+	// ParseStrict rejects suspicious constructs with a SyntaxError:
+	// a lone $ at the end of the input or before whitespace, $ followed
+	// by a digit or by space and {, the unsupported :+ operator, and
+	// unbalanced quotes in operands.
+	ParseStrict
+	// ParseDottedNames allows dots in variable names after their first
+	// character, as in ${database.primary.host}.
+	ParseDottedNames
+	// ParseSchemes enables the ${scheme:reference} syntax, where the
+	// reference extends to the closing bracket or the next colon, so that
+	// ${file:/etc/hostname} and ${env:HOME:-/root} name the variables
+	// file:/etc/hostname and env:HOME.
+	ParseSchemes
+	// ParseDirectives honours the envsubst:off and envsubst:on
+	// directives, comment lines such as "# envsubst:off": the lines
+	// between an off directive and the next on directive, or the end of
+	// the input, are parsed as text, verbatim.
+	ParseDirectives
+	// ParsePathNames allows variable names that are slash-separated
+	// paths starting with a slash, as in ${/app/prod/db_password}, their
+	// elements holding letters, digits and the characters _ . and -.
+	// The operators other than the replacement ones may follow them.
+	ParsePathNames
+)
+
 // Tree is the representation of a single parsed SQL statement.
 type Tree struct {
-	Root Node
+	Root   Node
+	Mode   Mode
+	Limits Limits
+
+	// Disabled is set before Parse if the input starts in a region
+	// disabled by directives, and by Parse if it ends in one, so that
+	// inputs split in parts can be parsed in sequence. It only applies
+	// with ParseDirectives.
+	Disabled bool
+
+	// Offset is the position at which Parse starts, the input before it,
+	// such as a frontmatter block, being left out of the tree. Positions
+	// in the tree remain positions in the input.
+	Offset int
 
 	// Parsing only; cleared after parse.
+	text    string // original input
 	scanner *scanner
+	depth   int      // nesting of the current expression
+	exprs   int      // number of expressions parsed
+	regions [][2]int // disabled regions not yet parsed
 }
 
 // Parse parses the string and returns a Tree.
 func Parse(buf string) (*Tree, error) {
+	return ParseMode(buf, 0)
+}
+
+// ParseMode parses the string with the syntax extensions enabled by
+// mode and returns a Tree.
+func ParseMode(buf string, mode Mode) (*Tree, error) {
+	t := New()
+	t.Mode = mode
+	return t.Parse(buf)
+}
+
+// New returns a new Tree, whose Mode and Limits can be set before
+// calling Parse.
+func New() *Tree {
 	t := new(Tree)
 	t.scanner = new(scanner)
-	return t.Parse(buf)
+	return t
 }
 
 // Parse parses the string buffer to construct an ast
 // representation for expansion.
 func (t *Tree) Parse(buf string) (tree *Tree, err error) {
-	t.scanner.init(buf)
+	t.text = buf
+	t.regions = t.regions[:0]
+	if t.Mode&ParseDirectives != 0 {
+		t.regions, t.Disabled = disabledRegions(buf, t.Offset, t.Disabled, t.regions)
+	}
+	t.scanner.init(t.enabledText())
+	if t.Offset > 0 {
+		t.scanner.resume(t.enabledText(), t.Offset)
+	}
+	t.depth = 0
+	t.exprs = 0
 	t.Root, err = t.parseAny()
+	t.text = ""
 	return t, err
 }
 
+// enabledText returns the input up to the next disabled region, which
+// is where the scanner stops. Positions in it are positions in the
+// input.
+func (t *Tree) enabledText() string {
+	if len(t.regions) == 0 {
+		return t.text
+	}
+	return t.text[:t.regions[0][0]]
+}
+
+// Release returns the nodes of the tree to pools, from which later
+// calls to Parse allocate, reducing the garbage of parsing many short
+// strings. Neither the tree nor its nodes may be used after.
+func (t *Tree) Release() {
+	release(t.Root)
+	t.Root = nil
+}
+
+// Pos returns the position in the original input reached by the most
+// recent call to Parse. If parsing failed, it is where the error was
+// detected.
+func (t *Tree) Pos() Pos {
+	return Pos(t.scanner.pos)
+}
+
 func (t *Tree) parseAny() (Node, error) {
 	t.scanner.accept = acceptRune
-	t.scanner.mode = scanIdent | scanLbrack | scanEscape
+	t.scanner.mode = scanIdent | scanLbrack | scanEscape | scanText
 
 	switch t.scanner.scan() {
 	case tokenIdent:
 		left := newTextNode(
 			t.scanner.string(),
+			Pos(t.scanner.start),
+			Pos(t.scanner.pos),
 		)
+		if t.Mode&ParseStrict != 0 {
+			if err := t.checkText(left); err != nil {
+				return nil, err
+			}
+		}
 		right, err := t.parseAny()
 		switch {
 		case err != nil:
@@ -46,9 +197,12 @@ func (t *Tree) parseAny() (Node, error) {
 		}
 		return newListNode(left, right), nil
 	case tokenEOF:
+		if len(t.regions) != 0 {
+			return t.parseDisabled()
+		}
 		return empty, nil
 	case tokenLbrack:
-		left, err := t.parseFunc()
+		left, err := t.parseExpr()
 		if err != nil {
 			return nil, err
 		}
@@ -66,6 +220,55 @@ func (t *Tree) parseAny() (Node, error) {
 	return nil, ErrBadSubstitution
 }
 
+// parseDisabled parses the disabled region at the current position as
+// text, then resumes scanning after it.
+func (t *Tree) parseDisabled() (Node, error) {
+	r := t.regions[0]
+	t.regions = t.regions[1:]
+	left := newTextNode(t.text[r[0]:r[1]], Pos(r[0]), Pos(r[1]))
+	t.scanner.resume(t.enabledText(), r[1])
+	right, err := t.parseAny()
+	switch {
+	case err != nil:
+		return nil, err
+	case right == empty:
+		return left, nil
+	}
+	return newListNode(left, right), nil
+}
+
+// parseExpr parses a substitution function following an opening
+// bracket and records its position in the original input.
+func (t *Tree) parseExpr() (Node, error) {
+	pos := Pos(t.scanner.start)
+	t.depth++
+	t.exprs++
+	switch {
+	case t.Limits.Depth > 0 && t.depth > t.Limits.Depth:
+		return nil, &LimitError{Limit: "depth", Max: t.Limits.Depth, Pos: pos}
+	case t.Limits.Exprs > 0 && t.exprs > t.Limits.Exprs:
+		return nil, &LimitError{Limit: "expression", Max: t.Limits.Exprs, Pos: pos}
+	}
+	node, err := t.parseFunc()
+	if err == ErrBadSubstitution && t.scanner.eof {
+		return nil, &UnterminatedError{Pos: pos}
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.depth--
+	if fn, ok := node.(*FuncNode); ok {
+		fn.Pos = pos
+		fn.End = Pos(t.scanner.pos)
+		if t.Mode&ParseStrict != 0 {
+			if err := t.checkFunc(fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return node, nil
+}
+
 func (t *Tree) parseFunc() (Node, error) {
 	switch t.scanner.peek() {
 	case '#':
@@ -73,7 +276,7 @@ func (t *Tree) parseFunc() (Node, error) {
 	}
 
 	var name string
-	t.scanner.accept = acceptIdent
+	t.scanner.accept = t.acceptName()
 	t.scanner.mode = scanIdent
 
 	switch t.scanner.scan() {
@@ -85,6 +288,9 @@ func (t *Tree) parseFunc() (Node, error) {
 
 	switch t.scanner.peek() {
 	case ':':
+		if t.Mode&ParseSchemes != 0 && isSchemeRef(t.scanner.peek2()) {
+			return t.parseSchemeRef(name)
+		}
 		return t.parseDefaultOrSubstr(name)
 	case '=':
 		return t.parseDefaultFunc(name)
@@ -96,6 +302,16 @@ func (t *Tree) parseFunc() (Node, error) {
 		return t.parseRemoveFunc(name, acceptHashFunc)
 	case '%':
 		return t.parseRemoveFunc(name, acceptPercentFunc)
+	case '(':
+		node, err := t.parseCallFunc(name)
+		if err != nil {
+			return nil, err
+		}
+		return t.parsePipeline(node)
+	case '|':
+		if t.Mode&ParsePipelines != 0 {
+			return t.parsePipeline(newFuncNode(name))
+		}
 	}
 
 	t.scanner.accept = acceptIdent
@@ -114,10 +330,15 @@ func (t *Tree) parseParam(accept acceptFunc, mode byte) (Node, error) {
 	t.scanner.mode = mode | scanLbrack
 	switch t.scanner.scan() {
 	case tokenLbrack:
-		return t.parseFunc()
+		return t.parseExpr()
 	case tokenIdent:
+		if t.Limits.Operand > 0 && len(t.scanner.string()) > t.Limits.Operand {
+			return nil, &LimitError{Limit: "operand length", Max: t.Limits.Operand, Pos: Pos(t.scanner.start)}
+		}
 		return newTextNode(
 			t.scanner.string(),
+			Pos(t.scanner.start),
+			Pos(t.scanner.pos),
 		), nil
 	default:
 		return nil, ErrBadSubstitution
@@ -126,10 +347,7 @@ func (t *Tree) parseParam(accept acceptFunc, mode byte) (Node, error) {
 
 // parse either a default or substring substitution function.
 func (t *Tree) parseDefaultOrSubstr(name string) (Node, error) {
-	t.scanner.read()
-	r := t.scanner.peek()
-	t.scanner.unread()
-	switch r {
+	switch t.scanner.peek2() {
 	case '=', '-', '?', '+':
 		return t.parseDefaultFunc(name)
 	default:
@@ -137,6 +355,36 @@ func (t *Tree) parseDefaultOrSubstr(name string) (Node, error) {
 	}
 }
 
+// parses the ${scheme:reference} variable, when enabled, optionally
+// followed by an operator starting with a colon.
+func (t *Tree) parseSchemeRef(scheme string) (Node, error) {
+	t.scanner.read() // consume the colon
+
+	t.scanner.accept = acceptSchemeRef
+	t.scanner.mode = scanIdent
+	switch t.scanner.scan() {
+	case tokenIdent:
+	default:
+		return nil, ErrBadSubstitution
+	}
+	name := scheme + ":" + t.scanner.string()
+	if t.scanner.peek() == ':' {
+		return t.parseDefaultOrSubstr(name)
+	}
+	return newFuncNode(name), t.consumeRbrack()
+}
+
+// isSchemeRef reports whether r, following ${name:, starts the reference
+// of a scheme rather than the operand of a default or substring
+// operator.
+func isSchemeRef(r rune) bool {
+	switch r {
+	case '=', '-', '?', '+', ' ', '$', '}', ':', eof:
+		return false
+	}
+	return !unicode.IsDigit(r)
+}
+
 // parses the ${param:offset} string function
 // parses the ${param:offset:length} string function
 func (t *Tree) parseSubstrFunc(name string) (Node, error) {
@@ -333,6 +581,55 @@ func (t *Tree) parseCasingFunc(name string) (Node, error) {
 	return node, t.consumeRbrack()
 }
 
+// parses the ${func(param)} string function
+// parses the ${func(func(param))} string function
+func (t *Tree) parseCallFunc(fn string) (*FuncNode, error) {
+	t.scanner.read() // consume the opening parenthesis
+
+	var name string
+	t.scanner.accept = t.acceptName()
+	t.scanner.mode = scanIdent
+	switch t.scanner.scan() {
+	case tokenIdent:
+		name = t.scanner.string()
+	default:
+		return nil, ErrBadSubstitution
+	}
+
+	var node *FuncNode
+	if t.scanner.peek() == '(' {
+		inner, err := t.parseCallFunc(name)
+		if err != nil {
+			return nil, err
+		}
+		node = inner
+	} else {
+		node = newFuncNode(name)
+	}
+
+	if t.scanner.read() != ')' {
+		return nil, ErrBadSubstitution
+	}
+	node.Funcs = append(node.Funcs, fn)
+	return node, nil
+}
+
+// parses the ${param|filter|filter} pipeline, when enabled
+func (t *Tree) parsePipeline(node *FuncNode) (Node, error) {
+	for t.Mode&ParsePipelines != 0 && t.scanner.peek() == '|' {
+		t.scanner.read()
+		t.scanner.accept = acceptIdent
+		t.scanner.mode = scanIdent
+		switch t.scanner.scan() {
+		case tokenIdent:
+			node.Funcs = append(node.Funcs, t.scanner.string())
+		default:
+			return nil, ErrBadSubstitution
+		}
+	}
+	return node, t.consumeRbrack()
+}
+
 // parses the ${#param} string function
 func (t *Tree) parseLenFunc() (Node, error) {
 	node := new(FuncNode)
@@ -346,7 +643,7 @@ func (t *Tree) parseLenFunc() (Node, error) {
 		return nil, ErrBadSubstitution
 	}
 
-	t.scanner.accept = acceptIdent
+	t.scanner.accept = t.acceptName()
 	t.scanner.mode = scanIdent
 	switch t.scanner.scan() {
 	case tokenIdent:
@@ -358,6 +655,18 @@ func (t *Tree) parseLenFunc() (Node, error) {
 	return node, t.consumeRbrack()
 }
 
+// acceptName returns the function accepting the runes of variable
+// names.
+func (t *Tree) acceptName() acceptFunc {
+	switch {
+	case t.Mode&ParsePathNames != 0 && t.scanner.peek() == '/':
+		return acceptPathName
+	case t.Mode&ParseDottedNames != 0:
+		return acceptDottedIdent
+	}
+	return acceptIdent
+}
+
 // consumeRbrack consumes a right closing bracket. If a closing
 // bracket token is not consumed an ErrBadSubstitution is returned.
 func (t *Tree) consumeRbrack() error {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var tests = []struct {
@@ -414,6 +415,36 @@ var tests = []struct {
 			},
 		},
 	},
+	//
+	// registered functions
+	//
+	{
+		Text: "${upper(string)}",
+		Node: &FuncNode{
+			Param: "string",
+			Funcs: []string{"upper"},
+		},
+	},
+	{
+		Text: "${sha256(trim(string))}",
+		Node: &FuncNode{
+			Param: "string",
+			Funcs: []string{"trim", "sha256"},
+		},
+	},
+	{
+		Text: "${string:-${upper(stringz)}}",
+		Node: &FuncNode{
+			Param: "string",
+			Name:  ":-",
+			Args: []Node{
+				&FuncNode{
+					Param: "stringz",
+					Funcs: []string{"upper"},
+				},
+			},
+		},
+	},
 	{
 		Text: "${string//${stringy}/${stringz}}",
 		Node: &FuncNode{
@@ -434,7 +465,407 @@ func TestParse(t *testing.T) {
 			t.Error(err)
 		}
 
-		if diff := cmp.Diff(test.Node, got.Root); diff != "" {
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+}
+
+// positions are covered by TestParsePos.
+var ignorePos = cmp.Options{
+	cmpopts.IgnoreFields(FuncNode{}, "Pos", "End"),
+	cmpopts.IgnoreFields(TextNode{}, "Pos", "End"),
+}
+
+func TestParsePos(t *testing.T) {
+	text := `a\/$$ ${b/\//${c}} ${#d}`
+	got, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []string
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *ListNode:
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *TextNode:
+			spans = append(spans, text[n.Pos:n.End])
+		case *FuncNode:
+			spans = append(spans, text[n.Pos:n.End])
+			for _, c := range n.Args {
+				walk(c)
+			}
+		}
+	}
+	walk(got.Root)
+
+	want := []string{`a\/$$ `, `${b/\//${c}}`, `\/`, `${c}`, ` `, `${#d}`}
+	if !cmp.Equal(spans, want) {
+		t.Errorf("Want node spans %q, got %q", want, spans)
+	}
+}
+
+func TestParseCallErrors(t *testing.T) {
+	for _, text := range []string{
+		"${upper(string}",
+		"${upper()}",
+		"${upper(string)x}",
+		"${upper(string}}",
+	} {
+		if _, err := Parse(text); err != ErrBadSubstitution {
+			t.Errorf("Want %q to fail with bad substitution, got %v", text, err)
+		}
+	}
+}
+
+func TestParsePipelines(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Node Node
+	}{
+		{
+			Text: "${string|upper}",
+			Node: &FuncNode{Param: "string", Funcs: []string{"upper"}},
+		},
+		{
+			Text: "${string|upper|trim}",
+			Node: &FuncNode{Param: "string", Funcs: []string{"upper", "trim"}},
+		},
+		{
+			Text: "${upper(string)|trim}",
+			Node: &FuncNode{Param: "string", Funcs: []string{"upper", "trim"}},
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseMode(test.Text, ParsePipelines)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+
+	for _, text := range []string{"${string|}", "${string|upper|}", "${string||upper}"} {
+		if _, err := ParseMode(text, ParsePipelines); err != ErrBadSubstitution {
+			t.Errorf("Want %q to fail with bad substitution, got %v", text, err)
+		}
+	}
+	if _, err := Parse("${string|upper}"); err != ErrBadSubstitution {
+		t.Errorf("Want pipelines to be rejected unless enabled, got %v", err)
+	}
+}
+
+func TestParseSchemes(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Node Node
+	}{
+		{
+			Text: "${env:HOME}",
+			Node: &FuncNode{Param: "env:HOME"},
+		},
+		{
+			Text: "${file:/etc/hostname}",
+			Node: &FuncNode{Param: "file:/etc/hostname"},
+		},
+		{
+			Text: "${secret:db-password:-none}",
+			Node: &FuncNode{Param: "secret:db-password", Name: ":-", Args: []Node{&TextNode{Value: "none"}}},
+		},
+		{
+			Text: "${var:-default}",
+			Node: &FuncNode{Param: "var", Name: ":-", Args: []Node{&TextNode{Value: "default"}}},
+		},
+		{
+			Text: "${var:1}",
+			Node: &FuncNode{Param: "var", Name: ":", Args: []Node{&TextNode{Value: "1"}}},
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseMode(test.Text, ParseSchemes)
+		if err != nil {
+			t.Errorf("%s: %v", test.Text, err)
+			continue
+		}
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+	got, err := Parse("${env:HOME}")
+	if err != nil || got.Root.(*FuncNode).Name != ":" {
+		t.Errorf("Want a substring operator unless schemes are enabled, got %v", err)
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	text := "a=${a}\n# envsubst:off\necho ${b} $$\n# envsubst:on\nc=${c}\n"
+	tree := New()
+	tree.Mode = ParseDirectives
+	got, err := tree.Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ListNode{Nodes: []Node{
+		&TextNode{Value: "a="},
+		&ListNode{Nodes: []Node{
+			&FuncNode{Param: "a"},
+			&ListNode{Nodes: []Node{
+				&TextNode{Value: "\n# envsubst:off\n"},
+				&ListNode{Nodes: []Node{
+					&TextNode{Value: "echo ${b} $$\n"},
+					&ListNode{Nodes: []Node{
+						&TextNode{Value: "# envsubst:on\nc="},
+						&ListNode{Nodes: []Node{
+							&FuncNode{Param: "c"},
+							&TextNode{Value: "\n"},
+						}},
+					}},
+				}},
+			}},
+		}},
+	}}
+	if diff := cmp.Diff(want, got.Root, ignorePos); diff != "" {
+		t.Errorf(diff)
+	}
+	if got.Disabled {
+		t.Errorf("Want the input to end enabled")
+	}
+
+	tree = New()
+	tree.Mode = ParseDirectives
+	tree.Disabled = true
+	got, err = tree.Parse("${a}\n<!-- envsubst:on -->\n${b}\n// envsubst:off\n${c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := got.Root.(*ListNode).Nodes[0].(*TextNode); text.Value != "${a}\n" || text.Pos != 0 || text.End != 5 {
+		t.Errorf("Want the start disabled, got %+v", text)
+	}
+	if !got.Disabled {
+		t.Errorf("Want the input to end disabled")
+	}
+
+	for _, line := range []string{"#envsubst:off", "  ## envsubst:off", "/* envsubst:off */", "-- envsubst:off", "; envsubst:off"} {
+		if directive(line) != "off" {
+			t.Errorf("Want %q recognized", line)
+		}
+	}
+	for _, line := range []string{"envsubst:off", "# envsubst:off please", "x # envsubst:off"} {
+		if directive(line) != "" {
+			t.Errorf("Want %q ignored", line)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tree := New()
+	tree.Mode = ParseDirectives
+	tree.Offset = len("${skipped}\n# envsubst:off\n")
+	got, err := tree.Parse("${skipped}\n# envsubst:off\nx=${x}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := got.Root.(*ListNode)
+	if text := list.Nodes[0].(*TextNode); text.Value != "x=" || int(text.Pos) != tree.Offset {
+		t.Errorf("Want the text after the offset, got %+v", text)
+	}
+	if fn := list.Nodes[1].(*FuncNode); fn.Param != "x" || int(fn.Pos) != tree.Offset+2 {
+		t.Errorf("Want positions in the input, got %+v", fn)
+	}
+}
+
+func TestParseDottedNames(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Node Node
+	}{
+		{
+			Text: "${database.primary.host}",
+			Node: &FuncNode{Param: "database.primary.host"},
+		},
+		{
+			Text: "${servers.0.port:-80}",
+			Node: &FuncNode{Param: "servers.0.port", Name: ":-", Args: []Node{&TextNode{Value: "80"}}},
+		},
+		{
+			Text: "${#app.name}",
+			Node: &FuncNode{Param: "app.name", Name: "#"},
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseMode(test.Text, ParseDottedNames)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+
+	for _, text := range []string{"${.app}", "${a.b}"} {
+		if _, err := Parse(text); err != ErrBadSubstitution {
+			t.Errorf("Want %q to fail with bad substitution, got %v", text, err)
+		}
+	}
+	if _, err := ParseMode("${.app}", ParseDottedNames); err != ErrBadSubstitution {
+		t.Errorf("Want leading dot to be rejected, got %v", err)
+	}
+}
+
+func TestParsePathNames(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Node Node
+	}{
+		{
+			Text: "${/app/prod/db_password}",
+			Node: &FuncNode{Param: "/app/prod/db_password"},
+		},
+		{
+			Text: "${/app/db-host.name:-localhost}",
+			Node: &FuncNode{Param: "/app/db-host.name", Name: ":-", Args: []Node{&TextNode{Value: "localhost"}}},
+		},
+		{
+			Text: "${app/x/y}",
+			Node: &FuncNode{Param: "app", Name: "/", Args: []Node{&TextNode{Value: "x"}, &TextNode{Value: "y"}}},
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseMode(test.Text, ParsePathNames)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+
+	if _, err := Parse("${/app/x}"); err != ErrBadSubstitution {
+		t.Errorf("Want path names rejected by default, got %v", err)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	var tests = []struct {
+		Text   string
+		Limits Limits
+		Limit  string
+	}{
+		{Text: "${a:-${b:-${c}}}", Limits: Limits{Depth: 3}},
+		{Text: "${a:-${b:-${c:-${d}}}}", Limits: Limits{Depth: 3}, Limit: "depth"},
+		{Text: "${a}${b}${c:-${d}}", Limits: Limits{Exprs: 4}},
+		{Text: "${a}${b}${c:-${d}}${e}", Limits: Limits{Exprs: 4}, Limit: "expression"},
+		{Text: "${a:-abcd}", Limits: Limits{Operand: 4}},
+		{Text: "${a:-abcde}", Limits: Limits{Operand: 4}, Limit: "operand length"},
+	}
+	for _, test := range tests {
+		tree := New()
+		tree.Limits = test.Limits
+		_, err := tree.Parse(test.Text)
+		if test.Limit == "" {
+			if err != nil {
+				t.Errorf("Want %q parsed within limits, got %v", test.Text, err)
+			}
+			continue
+		}
+		if err, ok := err.(*LimitError); !ok || err.Limit != test.Limit {
+			t.Errorf("Want %q to exceed the %s limit, got %v", test.Text, test.Limit, err)
+		}
+	}
+}
+
+func TestParseUnterminated(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Pos  Pos
+	}{
+		{Text: "${a", Pos: 0},
+		{Text: "x ${a:-b", Pos: 2},
+		{Text: "${a} ${b:-${c}", Pos: 5},
+		{Text: "${a:-${b", Pos: 5},
+		{Text: "${a/b", Pos: 0},
+		{Text: "${", Pos: 0},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.Text)
+		uerr, ok := err.(*UnterminatedError)
+		if !ok {
+			t.Errorf("Want %q to fail as unterminated, got %v", test.Text, err)
+			continue
+		}
+		if uerr.Pos != test.Pos {
+			t.Errorf("Want %q unterminated at %d, got %d", test.Text, test.Pos, uerr.Pos)
+		}
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	var tests = []struct {
+		Text string
+		Pos  Pos // position of the error, or -1 if valid
+	}{
+		{Text: "price: 5$", Pos: 8},
+		{Text: "a $ b", Pos: 2},
+		{Text: "a $\n", Pos: 2},
+		{Text: "${a} $", Pos: 5},
+		{Text: "$$ $$", Pos: -1},
+		{Text: "$$$", Pos: 2},
+		{Text: "a $${b}", Pos: -1},
+		{Text: "a$${b}", Pos: -1},
+		{Text: "$HOME", Pos: -1},
+		{Text: "a $1", Pos: 2},
+		{Text: "$$1", Pos: -1},
+		{Text: "a $ {b}", Pos: 2},
+		{Text: "a ${b:?required}", Pos: -1},
+		{Text: "a ${b:+set}", Pos: 2},
+		{Text: `${b:-"x}`, Pos: 5},
+		{Text: `${b:-'x}`, Pos: 5},
+		{Text: `${b:-"x"}`, Pos: -1},
+		{Text: `${b/"/'}`, Pos: 4},
+	}
+	for _, test := range tests {
+		if _, err := Parse(test.Text); err != nil {
+			t.Errorf("Want %q accepted unless strict, got %v", test.Text, err)
+		}
+		_, err := ParseMode(test.Text, ParseStrict)
+		if test.Pos < 0 {
+			if err != nil {
+				t.Errorf("Want %q accepted in strict mode, got %v", test.Text, err)
+			}
+			continue
+		}
+		serr, ok := err.(*SyntaxError)
+		if !ok || serr.Pos != test.Pos {
+			t.Errorf("Want %q rejected at %d in strict mode, got %v", test.Text, test.Pos, err)
+		}
+	}
+}
+
+func TestParseRelease(t *testing.T) {
+	for _, test := range tests {
+		tree, err := Parse(test.Text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Release()
+		if tree.Root != nil {
+			t.Errorf("Want released tree to have no root")
+		}
+	}
+	// trees parsed from released nodes are the same.
+	for _, test := range tests {
+		got, err := Parse(test.Text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.Node, got.Root, ignorePos, cmpopts.EquateEmpty()); diff != "" {
 			t.Errorf(diff)
 		}
 	}
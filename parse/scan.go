@@ -1,12 +1,14 @@
 package parse
 
 import (
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
-// eof rune sent when end of file is reached
-var eof = rune(0)
+// eof rune sent when end of file is reached. It is not a valid rune, so
+// that NUL characters in the input are not mistaken for it.
+var eof = rune(-1)
 
 // token is a lexical token.
 type token uint
@@ -32,20 +34,39 @@ const (
 	scanLbrack
 	scanRbrack
 	scanEscape
+	// skip over text other than brackets and escapes in bulk, all
+	// other runes being accepted.
+	scanText
 )
 
 // returns true if rune is accepted.
 type acceptFunc func(r rune, i int) bool
 
 // scanner implements a lexical scanner that reads unicode
-// characters and tokens from a string buffer.
+// characters and tokens from a string buffer in a single pass: it
+// looks ahead at most two characters and never moves backwards. The
+// buffer is never modified, so that positions in it are positions in
+// the original input, and tokens are slices of it unless they hold
+// escapes.
 type scanner struct {
 	buf   string
 	pos   int
 	start int
-	width int
 	mode  byte
 
+	// positions of the escape characters skipped in the most
+	// recently scanned token.
+	skips []int
+	// bytes of the most recently scanned token without its escape
+	// characters, reused across tokens.
+	value []byte
+	// whether the end of the buffer has been reached.
+	eof bool
+	// positions of the next '$' and '\' characters at or after the
+	// position they were searched from, or len(buf) if none.
+	dollar    int
+	backslash int
+
 	accept acceptFunc
 }
 
@@ -54,120 +75,169 @@ func (s *scanner) init(buf string) {
 	s.buf = buf
 	s.pos = 0
 	s.start = 0
-	s.width = 0
+	s.skips = s.skips[:0]
+	s.eof = false
+	s.dollar = -1
+	s.backslash = -1
 	s.accept = nil
 }
 
-// read returns the next unicode character. It returns eof at
-// the end of the string buffer.
-func (s *scanner) read() rune {
-	if s.pos >= len(s.buf) {
-		s.width = 0
-		return eof
-	}
-	r, w := utf8.DecodeRuneInString(s.buf[s.pos:])
-	s.width = w
-	s.pos += s.width
-	return r
+// resume continues scanning at position pos of buf, which extends the
+// buffer scanned so far.
+func (s *scanner) resume(buf string, pos int) {
+	s.buf = buf
+	s.pos = pos
+	s.start = pos
+	s.eof = false
+	s.dollar = -1
+	s.backslash = -1
 }
 
-func (s *scanner) unread() {
-	s.pos -= s.width
+// at returns the unicode character at position i of the buffer and its
+// width. It returns eof at the end of the buffer.
+func (s *scanner) at(i int) (rune, int) {
+	if i >= len(s.buf) {
+		s.eof = true
+		return eof, 0
+	}
+	if c := s.buf[i]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(s.buf[i:])
 }
 
-// skip skips over the curring unicode character in the buffer
-// by slicing and removing from the buffer.
-func (s *scanner) skip() {
-	l := s.buf[:s.pos-1]
-	r := s.buf[s.pos:]
-	s.buf = l + r
+// read returns the next unicode character and advances past it. It
+// returns eof at the end of the buffer.
+func (s *scanner) read() rune {
+	r, w := s.at(s.pos)
+	s.pos += w
+	return r
 }
 
 // peek returns the next unicode character in the buffer without
-// advancing the scanner. It returns eof if the scanner's position
-// is at the last character of the source.
+// advancing the scanner. It returns eof at the end of the buffer.
 func (s *scanner) peek() rune {
-	r := s.read()
-	s.unread()
+	r, _ := s.at(s.pos)
+	return r
+}
+
+// peek2 returns the unicode character following the next one without
+// advancing the scanner. It returns eof at the end of the buffer.
+func (s *scanner) peek2() rune {
+	_, w := s.at(s.pos)
+	r, _ := s.at(s.pos + w)
 	return r
 }
 
+// skip records the escape character at the current position, which
+// is dropped from the current token, and advances past it and the
+// character it escapes, both being single bytes.
+func (s *scanner) skip() {
+	s.skips = append(s.skips, s.pos)
+	s.pos += 2
+}
+
 // string returns the string corresponding to the most recently
 // scanned token. Valid after calling scan().
 func (s *scanner) string() string {
-	return s.buf[s.start:s.pos]
+	if len(s.skips) == 0 {
+		return s.buf[s.start:s.pos]
+	}
+	s.value = s.value[:0]
+	i := s.start
+	for _, j := range s.skips {
+		s.value = append(s.value, s.buf[i:j]...)
+		i = j + 1
+	}
+	s.value = append(s.value, s.buf[i:s.pos]...)
+	return string(s.value)
 }
 
 // scan reads the next token or Unicode character from source and
-// returns it. It returns EOF at the end of the source.
+// returns it. It returns EOF at the end of the source. An illegal
+// character is consumed.
 func (s *scanner) scan() token {
 	s.start = s.pos
-	r := s.read()
+	s.skips = s.skips[:0]
+	r, w := s.at(s.pos)
 	switch {
 	case r == eof:
 		return tokenEOF
 	case s.scanLbrack(r):
+		s.pos += 2
 		return tokenLbrack
 	case s.scanRbrack(r):
+		s.pos += w
 		return tokenRbrack
-	case s.scanIdent(r):
+	case s.scanIdent():
 		return tokenIdent
 	}
+	s.pos += w
 	return tokenIllegal
 }
 
-// scanIdent reads the next token or Unicode character from source
-// and returns true if the Ident character is accepted.
-func (s *scanner) scanIdent(r rune) bool {
+// scanIdent consumes the characters accepted as part of an Ident
+// token and returns true if there was at least one.
+func (s *scanner) scanIdent() bool {
 	if s.mode&scanIdent == 0 {
 		return false
 	}
-	if s.scanEscaped(r) {
-		s.skip()
-	} else if !s.accept(r, s.pos-s.start) {
-		return false
-	}
-loop:
-	for {
-		r := s.read()
+	for first := true; ; first = false {
+		if !first && s.mode&scanText != 0 {
+			s.pos = s.literal()
+		}
+		r, w := s.at(s.pos)
 		switch {
 		case r == eof:
-			s.unread()
-			break loop
-		case s.scanLbrack(r):
-			s.unread()
-			s.unread()
-			break loop
-		}
-		if s.scanEscaped(r) {
+			return !first
+		case !first && s.scanLbrack(r):
+			return true
+		case s.scanEscaped(r):
 			s.skip()
-			continue
-		}
-		if !s.accept(r, s.pos-s.start) {
-			s.unread()
-			break loop
+		case s.accept(r, s.pos+w-s.start):
+			s.pos += w
+		default:
+			return !first
 		}
 	}
-	return true
 }
 
-// scanLbrack reads the next token or Unicode character from source
-// and returns true if the open bracket is encountered.
+// literal returns the position of the next '$' or '\' character at or
+// after the current position, or len(buf) if none. The positions found
+// are kept until passed, so that the text is only searched once.
+func (s *scanner) literal() int {
+	if s.dollar < s.pos {
+		s.dollar = index(s.buf, s.pos, '$')
+	}
+	if s.backslash < s.pos {
+		s.backslash = index(s.buf, s.pos, '\\')
+	}
+	if s.dollar < s.backslash {
+		return s.dollar
+	}
+	return s.backslash
+}
+
+// index returns the position of the first c in buf at or after i, or
+// len(buf) if none.
+func index(buf string, i int, c byte) int {
+	if j := strings.IndexByte(buf[i:], c); j >= 0 {
+		return i + j
+	}
+	return len(buf)
+}
+
+// scanLbrack returns true if the character r at the current position
+// opens a bracket.
 func (s *scanner) scanLbrack(r rune) bool {
 	if s.mode&scanLbrack == 0 {
 		return false
 	}
-	if r == '$' {
-		if s.read() == '{' {
-			return true
-		}
-		s.unread()
-	}
-	return false
+	return r == '$' && s.peek2() == '{'
 }
 
-// scanRbrack reads the next token or Unicode character from source
-// and returns true if the closing bracket is encountered.
+// scanRbrack returns true if the character r at the current position
+// closes a bracket.
 func (s *scanner) scanRbrack(r rune) bool {
 	if s.mode&scanRbrack == 0 {
 		return false
@@ -175,26 +245,22 @@ func (s *scanner) scanRbrack(r rune) bool {
 	return r == '}'
 }
 
-// scanEscaped reads the next token or Unicode character from source
-// and returns true if it being escaped and should be sipped.
+// scanEscaped returns true if the character r at the current position
+// escapes the next one and should be skipped.
 func (s *scanner) scanEscaped(r rune) bool {
 	if s.mode&scanEscape == 0 {
 		return false
 	}
-	if r == '$' {
-		if s.peek() == '$' {
+	switch r {
+	case '$':
+		return s.peek2() == '$'
+	case '\\':
+		switch s.peek2() {
+		case '/', '\\':
 			return true
 		}
 	}
-	if r != '\\' {
-		return false
-	}
-	switch s.peek() {
-	case '/', '\\':
-		return true
-	default:
-		return false
-	}
+	return false
 }
 
 //
@@ -209,6 +275,21 @@ func acceptIdent(r rune, i int) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
 }
 
+func acceptDottedIdent(r rune, i int) bool {
+	return acceptIdent(r, i) || r == '.' && i > 1
+}
+
+func acceptPathName(r rune, i int) bool {
+	if i == 1 {
+		return r == '/'
+	}
+	return acceptIdent(r, i) || r == '/' || r == '.' || r == '-'
+}
+
+func acceptSchemeRef(r rune, i int) bool {
+	return r != '}' && r != ':'
+}
+
 func acceptColon(r rune, i int) bool {
 	return r == ':'
 }
@@ -1 +1,33 @@
 package parse
+
+import "testing"
+
+func TestScanEscapes(t *testing.T) {
+	var tests = []struct {
+		input string
+		value string
+		end   int
+	}{
+		{"text", "text", 4},
+		{"$$x", "$x", 3},
+		{"$$$", "$$", 3},
+		{`a\\b\/c\d`, `a\b/c\d`, 9},
+		{"é$$ü${x}", "é$ü", 6},
+	}
+	for _, test := range tests {
+		s := new(scanner)
+		s.init(test.input)
+		s.accept = acceptRune
+		s.mode = scanIdent | scanLbrack | scanEscape | scanText
+		if tok := s.scan(); tok != tokenIdent {
+			t.Errorf("Want %q scanned as ident, got %v", test.input, tok)
+			continue
+		}
+		if got := s.string(); got != test.value {
+			t.Errorf("Want %q scanned as %q, got %q", test.input, test.value, got)
+		}
+		if s.pos != test.end {
+			t.Errorf("Want %q scanned up to %d, got %d", test.input, test.end, s.pos)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package parse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SyntaxError is returned in strict mode when the input contains a
+// suspicious construct that is otherwise accepted.
+type SyntaxError struct {
+	// Msg describes the construct.
+	Msg string
+	// Pos is the position of the construct in the input.
+	Pos Pos
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Msg
+}
+
+// checkText reports the suspicious constructs in the text node, using
+// the original input to tell escaped from literal characters.
+func (t *Tree) checkText(node *TextNode) error {
+	text := t.text[node.Pos:node.End]
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '$' {
+			i++ // escaped
+			continue
+		}
+		pos := node.Pos + Pos(i)
+		next := text[i+1:]
+		switch {
+		case next == "" && int(node.End) == len(t.text):
+			return &SyntaxError{Msg: "lone $ is not a substitution, use $$ for a literal $", Pos: pos}
+		case next == "":
+		case strings.TrimLeft(next, " \t") != next && strings.HasPrefix(strings.TrimLeft(next, " \t"), "{"):
+			return &SyntaxError{Msg: "$ followed by space and { is not a substitution, remove the space", Pos: pos}
+		case unicode.IsSpace(rune(next[0])):
+			return &SyntaxError{Msg: "lone $ is not a substitution, use $$ for a literal $", Pos: pos}
+		case '0' <= next[0] && next[0] <= '9':
+			return &SyntaxError{Msg: "positional parameter $" + next[:1] + " is not supported", Pos: pos}
+		}
+	}
+	return nil
+}
+
+// checkFunc reports the suspicious constructs in the function node.
+func (t *Tree) checkFunc(node *FuncNode) error {
+	switch node.Name {
+	case ":+":
+		return &SyntaxError{Msg: "operator " + node.Name + " is not supported", Pos: node.Pos}
+	}
+	for _, arg := range node.Args {
+		text, ok := arg.(*TextNode)
+		if !ok {
+			continue
+		}
+		for _, q := range []string{`"`, "'"} {
+			if strings.Count(text.Value, q)%2 != 0 {
+				return &SyntaxError{Msg: "unbalanced " + q + " in operand of " + node.Param, Pos: text.Pos}
+			}
+		}
+	}
+	return nil
+}
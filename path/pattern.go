@@ -0,0 +1,77 @@
+package path
+
+// Pattern is a shell file name pattern split into its chunks once, so
+// that it can be matched against many names. See Match for the syntax.
+type Pattern struct {
+	text   string
+	chunks []chunk
+}
+
+// chunk is a non-star segment of a pattern, possibly preceded by a star.
+type chunk struct {
+	star bool
+	text string
+}
+
+// Compile splits the pattern into chunks. Malformed patterns are only
+// reported by Match, as the pattern is not fully checked until used.
+func Compile(pattern string) *Pattern {
+	p := &Pattern{text: pattern}
+	for len(pattern) > 0 {
+		var c chunk
+		c.star, c.text, pattern = scanChunk(pattern)
+		p.chunks = append(p.chunks, c)
+	}
+	return p
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.text
+}
+
+// Match reports whether name matches the pattern, like the Match
+// function.
+func (p *Pattern) Match(name string) (matched bool, err error) {
+	chunks := p.chunks
+Pattern:
+	for len(chunks) > 0 {
+		star, chunk := chunks[0].star, chunks[0].text
+		chunks = chunks[1:]
+		if star && chunk == "" {
+			// Return rest of string
+			return true, nil
+		}
+		// Look for match at current position.
+		t, ok, err := matchChunk(chunk, name)
+		// if we're the last chunk, make sure we've exhausted the name
+		// otherwise we'll give a false result even if we could still match
+		// using the star
+		if ok && (len(t) == 0 || len(chunks) > 0) {
+			name = t
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if star {
+			// Look for match skipping i+1 bytes.
+			for i := 0; i < len(name); i++ {
+				t, ok, err := matchChunk(chunk, name[i+1:])
+				if ok {
+					// if we're the last chunk, make sure we exhausted the name
+					if len(chunks) == 0 && len(t) > 0 {
+						continue
+					}
+					name = t
+					continue Pattern
+				}
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+		return false, nil
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,40 @@
+package envsubst
+
+// Progress reports the progress of a streaming function.
+type Progress struct {
+	// BytesIn is the number of bytes of input expanded so far.
+	BytesIn int64
+	// BytesOut is the number of bytes of output produced so far.
+	BytesOut int64
+	// Substitutions is the number of substitutions performed so far.
+	Substitutions int
+	// Done reports whether the end of the input was reached.
+	Done bool
+}
+
+// progressTracker accumulates the progress of a streaming function and
+// reports it periodically.
+type progressTracker struct {
+	options *options
+	p       Progress
+	last    int64 // BytesIn when last reported
+}
+
+// add records that in bytes of input were expanded into out bytes of
+// output, and reports the progress if due or if done is set.
+func (t *progressTracker) add(in, out int, done bool) {
+	if t.options.progress == nil {
+		return
+	}
+	t.p.BytesIn += int64(in)
+	t.p.BytesOut += int64(out)
+	if !done && t.p.BytesIn-t.last < chunkSize {
+		return
+	}
+	t.last = t.p.BytesIn
+	if t.options.subs != nil {
+		t.p.Substitutions = *t.options.subs
+	}
+	t.p.Done = done
+	t.options.progress(t.p)
+}
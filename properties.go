@@ -0,0 +1,149 @@
+package envsubst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvalINI replaces ${var} in the values of an INI file, resolving
+// variables with the provider. Section headers, keys and comments,
+// lines starting with # or ;, are copied unchanged, and values are the
+// text after the first = or : of a line. A substituted value containing
+// a line break is an error, since it would end the entry.
+func EvalINI(s string, p Provider, opts ...Option) (string, error) {
+	return evalEntries(s, p, newOptions(opts), false)
+}
+
+// EvalProperties replaces ${var} in the values of a Java .properties
+// file, resolving variables with the provider. Keys and comments, lines
+// starting with # or !, are copied unchanged, and values are the text
+// after the first unescaped =, : or blank of a logical line, including
+// its continuation lines. Substituted values are escaped: backslashes
+// are doubled, so that a trailing backslash does not continue the line,
+// line breaks, tabs and form feeds are written as \n, \r, \t and \f, and
+// a leading blank of a value is escaped so that it is kept.
+func EvalProperties(s string, p Provider, opts ...Option) (string, error) {
+	return evalEntries(s, p, newOptions(opts), true)
+}
+
+// evalEntries evaluates the values of the entries of an INI file, or a
+// .properties file if props is set.
+func evalEntries(s string, p Provider, o *options, props bool) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	var b strings.Builder
+	cont := false // the line continues the value of the previous one
+	for len(s) > 0 {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line, s = s[:i+1], s[i+1:]
+		} else {
+			s = ""
+		}
+		body := strings.TrimRight(line, "\r\n")
+		eol := line[len(body):]
+
+		start := len(body) // start of the value
+		switch trimmed := strings.TrimLeft(body, " \t\f"); {
+		case cont:
+			start = 0
+		case trimmed == "", trimmed[0] == '#':
+		case trimmed[0] == ';' && !props, trimmed[0] == '!' && props:
+		case trimmed[0] == '[' && !props:
+		default:
+			start = entrySeparator(body, len(body)-len(trimmed), props)
+		}
+		cont = props && continues(body)
+
+		b.WriteString(body[:start])
+		value := body[start:]
+		if !isPlain(value) {
+			var err error
+			if props {
+				value, err = evalEscaped(value, p, o, escapeProperty)
+			} else {
+				value, err = evalEscapedErr(value, p, o, func(name, v string) (string, error) {
+					if strings.ContainsAny(v, "\r\n") {
+						return "", fmt.Errorf("value of %s contains a line break", name)
+					}
+					return v, nil
+				})
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		b.WriteString(value)
+		b.WriteString(eol)
+	}
+	return b.String(), nil
+}
+
+// entrySeparator returns the start of the value of the entry whose key
+// starts at i, after the separator and the blanks around it.
+func entrySeparator(line string, i int, props bool) int {
+	j := i
+	for ; j < len(line); j++ {
+		c := line[j]
+		if props && c == '\\' {
+			j++
+			continue
+		}
+		if c == '=' || c == ':' || props && (c == ' ' || c == '\t' || c == '\f') {
+			break
+		}
+	}
+	if j == len(line) {
+		return j
+	}
+	// skip the blanks, then a single = or : after them if the key ended
+	// at a blank.
+	for j < len(line) && (line[j] == ' ' || line[j] == '\t' || line[j] == '\f') {
+		j++
+	}
+	if j < len(line) && (line[j] == '=' || line[j] == ':') {
+		j++
+	}
+	for j < len(line) && (line[j] == ' ' || line[j] == '\t' || line[j] == '\f') {
+		j++
+	}
+	return j
+}
+
+// continues reports whether a line of a .properties file continues on
+// the next one, ending with an odd number of backslashes.
+func continues(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// escapeProperty escapes v for the value of a .properties entry.
+func escapeProperty(v string) string {
+	var b strings.Builder
+	for i, r := range v {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case ' ':
+			if i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
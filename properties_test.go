@@ -0,0 +1,67 @@
+package envsubst
+
+import "testing"
+
+func TestEvalINI(t *testing.T) {
+	values := mapProvider{
+		"HOST":  "db.local",
+		"PORT":  "5432",
+		"KEY":   "name",
+		"LINES": "one\ntwo",
+	}
+	tests := []struct {
+		input, output string
+	}{
+		{"[db]\nhost = ${HOST}\nport: ${PORT}\n", "[db]\nhost = db.local\nport: 5432\n"},
+		{"[${KEY}]\n${KEY}=${HOST}\r\n", "[${KEY}]\n${KEY}=db.local\r\n"},
+		{"; ${HOST}\n# ${HOST}\nurl=${HOST}:${PORT}", "; ${HOST}\n# ${HOST}\nurl=db.local:5432"},
+		{"novalue ${HOST}\n", "novalue ${HOST}\n"},
+	}
+	for _, test := range tests {
+		got, err := EvalINI(test.input, values)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("Want %q for %q, got %q", test.output, test.input, got)
+		}
+	}
+
+	if _, err := EvalINI("text=${LINES}", values); err == nil {
+		t.Errorf("Want error for a value with a line break")
+	}
+}
+
+func TestEvalProperties(t *testing.T) {
+	values := mapProvider{
+		"HOST":  "db.local",
+		"DIR":   `C:\data\`,
+		"LINES": "one\ntwo",
+		"SPACE": "  padded",
+		"KEY":   "name",
+	}
+	tests := []struct {
+		input, output string
+	}{
+		{"host=${HOST}\nhost2 : ${HOST}\nhost3 ${HOST}\n", "host=db.local\nhost2 : db.local\nhost3 db.local\n"},
+		{"dir=${DIR}\nnext=1", `dir=C:\\data\\` + "\nnext=1"},
+		{"text=${LINES}", `text=one\ntwo`},
+		{"pad=${SPACE}", `pad=\  padded`},
+		{"${KEY}=${HOST}", "${KEY}=db.local"},
+		{`a\=${KEY}=${HOST}`, `a\=${KEY}=db.local`},
+		{"! ${HOST}\n# ${HOST}", "! ${HOST}\n# ${HOST}"},
+		{"list=a,\\\n  ${DIR}\n${KEY}=1", "list=a,\\\n  C:\\\\data\\\\\n${KEY}=1"},
+		{"even=a\\\\\n${KEY}=1", "even=a\\\\\n${KEY}=1"},
+	}
+	for _, test := range tests {
+		got, err := EvalProperties(test.input, values)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("Want %q for %q, got %q", test.output, test.input, got)
+		}
+	}
+}
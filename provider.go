@@ -0,0 +1,417 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Provider resolves variable names to values during execution.
+type Provider interface {
+	// Lookup retrieves the value of the named variable. The boolean
+	// reports whether the variable is defined. A non-nil error aborts
+	// execution.
+	Lookup(key string) (string, bool, error)
+}
+
+// KeyLister is implemented by providers that can list the names of the
+// variables they define. It is used to suggest the closest names for
+// undefined variables.
+type KeyLister interface {
+	Keys() []string
+}
+
+// ProviderFunc adapts an ordinary function to the Provider interface.
+type ProviderFunc func(key string) (string, bool, error)
+
+// Lookup calls f(key).
+func (f ProviderFunc) Lookup(key string) (string, bool, error) {
+	return f(key)
+}
+
+// Chain returns a provider resolving each variable from the first of
+// the providers that defines it, so that variables can be taken from
+// several sources in order of precedence. An error from any provider
+// aborts the lookup. The chain lists the names of the variables defined
+// by the providers that implement KeyLister.
+func Chain(providers ...Provider) Provider {
+	return chain(providers)
+}
+
+type chain []Provider
+
+func (c chain) Lookup(key string) (string, bool, error) {
+	for _, p := range c {
+		v, ok, err := p.Lookup(key)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return v, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (c chain) Keys() []string {
+	set := make(map[string]string)
+	for _, p := range c {
+		if l, ok := p.(KeyLister); ok {
+			for _, key := range l.Keys() {
+				set[key] = ""
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+// WithDefaults returns a provider resolving variables from p, and those
+// that p does not define from defaults, so that baseline values can be
+// set programmatically rather than with ${var:-default} in every
+// template. Unlike the :- operator, a variable that p defines as empty
+// keeps its empty value.
+func WithDefaults(p Provider, defaults map[string]string) Provider {
+	m := make(mapProvider, len(defaults))
+	for k, v := range defaults {
+		m[k] = v
+	}
+	return chain{p, m}
+}
+
+// Route dispatches the variables whose name starts with Prefix to
+// Provider, see Router.
+type Route struct {
+	Prefix   string
+	Provider Provider
+	// Strip removes the prefix from the name given to the provider.
+	Strip bool
+}
+
+// Router returns a provider dispatching each variable to the provider
+// of the route with the longest matching prefix, or to fallback if no
+// route matches. A variable is undefined if no route matches and
+// fallback is nil.
+func Router(routes []Route, fallback Provider) Provider {
+	r := &router{routes: append([]Route(nil), routes...), fallback: fallback}
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].Prefix) > len(r.routes[j].Prefix)
+	})
+	return r
+}
+
+type router struct {
+	routes   []Route
+	fallback Provider
+}
+
+func (r *router) Lookup(key string) (string, bool, error) {
+	for _, route := range r.routes {
+		if strings.HasPrefix(key, route.Prefix) {
+			if route.Strip {
+				key = key[len(route.Prefix):]
+			}
+			return route.Provider.Lookup(key)
+		}
+	}
+	if r.fallback == nil {
+		return "", false, nil
+	}
+	return r.fallback.Lookup(key)
+}
+
+// CaseInsensitive returns a provider resolving variable names without
+// regard to case, as Windows does for environment variables. A name
+// defined by p as given takes precedence. Otherwise, if p implements
+// KeyLister, the first of its sorted names equal to the given one under
+// Unicode case folding is used, e.g. Path before path for PATH;
+// if not, the upper and lower case forms of the name are tried in turn.
+func CaseInsensitive(p Provider) Provider {
+	return caseInsensitive{p}
+}
+
+type caseInsensitive struct {
+	provider Provider
+}
+
+func (c caseInsensitive) Lookup(key string) (string, bool, error) {
+	v, ok, err := c.provider.Lookup(key)
+	if err != nil || ok {
+		return v, ok, err
+	}
+	if l, ok := c.provider.(KeyLister); ok {
+		keys := l.Keys()
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k != key && strings.EqualFold(k, key) {
+				return c.provider.Lookup(k)
+			}
+		}
+		return "", false, nil
+	}
+	for _, k := range []string{strings.ToUpper(key), strings.ToLower(key)} {
+		if k != key {
+			if v, ok, err := c.provider.Lookup(k); err != nil || ok {
+				return v, ok, err
+			}
+		}
+	}
+	return "", false, nil
+}
+
+func (c caseInsensitive) Keys() []string {
+	if l, ok := c.provider.(KeyLister); ok {
+		return l.Keys()
+	}
+	return nil
+}
+
+// FileVars returns a provider implementing the _FILE convention of
+// Docker images: a variable FOO that p does not define takes the
+// contents of the file named by FOO_FILE, if p defines it, with
+// surrounding white space removed. Failing to read the file aborts the
+// lookup. The provider lists the names of both kinds of variables if p
+// implements KeyLister.
+func FileVars(p Provider) Provider {
+	return fileVars{p}
+}
+
+// fileSuffix is the suffix of the variables naming a file holding the
+// value of another variable.
+const fileSuffix = "_FILE"
+
+type fileVars struct {
+	provider Provider
+}
+
+func (f fileVars) Lookup(key string) (string, bool, error) {
+	v, ok, err := f.provider.Lookup(key)
+	if err != nil || ok {
+		return v, ok, err
+	}
+	name, ok, err := f.provider.Lookup(key + fileSuffix)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(b)), true, nil
+}
+
+func (f fileVars) Keys() []string {
+	l, ok := f.provider.(KeyLister)
+	if !ok {
+		return nil
+	}
+	set := make(map[string]string)
+	for _, key := range l.Keys() {
+		set[key] = ""
+		if strings.HasSuffix(key, fileSuffix) && len(key) > len(fileSuffix) {
+			set[strings.TrimSuffix(key, fileSuffix)] = ""
+		}
+	}
+	return sortedKeys(set)
+}
+
+// funcProvider adapts a mapping function. Empty values are reported as
+// undefined.
+type funcProvider func(string) string
+
+func (f funcProvider) Lookup(key string) (string, bool, error) {
+	v := f(key)
+	return v, v != "", nil
+}
+
+// mapProvider resolves variables from a map.
+type mapProvider map[string]string
+
+func (m mapProvider) Lookup(key string) (string, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+func (m mapProvider) Keys() []string {
+	return sortedKeys(m)
+}
+
+// envProvider resolves variables from the environment of the current
+// process.
+type envProvider struct{}
+
+func (envProvider) Lookup(key string) (string, bool, error) {
+	v, ok := os.LookupEnv(key)
+	return v, ok, nil
+}
+
+func (envProvider) Keys() []string {
+	var keys []string
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			keys = append(keys, kv[:i])
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Normalize returns a provider normalizing variable names before
+// looking them up in p: surrounding whitespace is removed, letters are
+// converted to upper case, and dashes and dots to underscores, so that
+// ${my.service.port} resolves MY_SERVICE_PORT from the environment.
+// Names containing dots must be enabled with the DottedNames option.
+// The provider lists the normalized names of the variables of p if p
+// implements KeyLister.
+func Normalize(p Provider) Provider {
+	return normalize{p}
+}
+
+type normalize struct {
+	provider Provider
+}
+
+func (n normalize) Lookup(key string) (string, bool, error) {
+	return n.provider.Lookup(NormalizeName(key))
+}
+
+func (n normalize) Keys() []string {
+	l, ok := n.provider.(KeyLister)
+	if !ok {
+		return nil
+	}
+	set := make(map[string]bool)
+	var keys []string
+	for _, key := range l.Keys() {
+		if key = NormalizeName(key); !set[key] {
+			set[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NormalizeName returns the name normalized as by Normalize.
+func NormalizeName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, strings.TrimSpace(key))
+}
+
+// SnapshotEnv returns a provider serving a copy of the environment of
+// the current process, taken when it is called, so that a long render,
+// or several in parallel, see the same values even if the environment
+// is modified meanwhile. As with os.LookupEnv, a variable listed twice
+// takes its first value.
+func SnapshotEnv() Provider {
+	env := os.Environ()
+	m := make(mapProvider, len(env))
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			if _, ok := m[kv[:i]]; !ok {
+				m[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+	return m
+}
+
+// PrefixEnv returns a provider exposing only the environment variables
+// whose name starts with prefix, so that templates cannot read the rest
+// of the environment. If strip is set, variables are referenced without
+// the prefix, e.g. ${PORT} for APP_PORT with the prefix APP_; otherwise
+// they are referenced by their full name and other names are undefined.
+func PrefixEnv(prefix string, strip bool) Provider {
+	return prefixEnv{prefix: prefix, strip: strip}
+}
+
+type prefixEnv struct {
+	prefix string
+	strip  bool
+}
+
+func (p prefixEnv) Lookup(key string) (string, bool, error) {
+	if p.strip {
+		key = p.prefix + key
+	} else if !strings.HasPrefix(key, p.prefix) {
+		return "", false, nil
+	}
+	return envProvider{}.Lookup(key)
+}
+
+func (p prefixEnv) Keys() []string {
+	var keys []string
+	for _, key := range (envProvider{}).Keys() {
+		if strings.HasPrefix(key, p.prefix) {
+			if p.strip {
+				key = key[len(p.prefix):]
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// hookProvider wraps a provider with the lookup hooks of the options.
+type hookProvider struct {
+	provider Provider
+	before   []func(key string) string
+	after    []func(key, value string, ok bool) (string, bool, error)
+}
+
+func (h *hookProvider) Lookup(key string) (string, bool, error) {
+	for _, fn := range h.before {
+		key = fn(key)
+	}
+	v, ok, err := h.provider.Lookup(key)
+	if err != nil {
+		return "", false, err
+	}
+	for _, fn := range h.after {
+		v, ok, err = fn(key, v, ok)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	return v, ok, nil
+}
+
+// internProvider wraps a provider, resolving each variable once and
+// reusing the value for later references.
+type internProvider struct {
+	provider Provider
+	values   map[string]internedValue
+}
+
+// internedValue is the result of a lookup kept by internProvider.
+type internedValue struct {
+	value string
+	ok    bool
+}
+
+func (p *internProvider) Lookup(key string) (string, bool, error) {
+	if v, ok := p.values[key]; ok {
+		return v.value, v.ok, nil
+	}
+	v, ok, err := p.provider.Lookup(key)
+	if err != nil {
+		return "", false, err
+	}
+	p.values[key] = internedValue{value: v, ok: ok}
+	return v, ok, nil
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+// Package aws resolves variables from AWS Systems Manager Parameter
+// Store and AWS Secrets Manager. It is a module of its own, so that
+// only the programs using it depend on the AWS SDK.
+//
+// The providers call the services through the small ParameterClient and
+// SecretClient interfaces, implemented over the clients of the AWS SDK
+// for Go v2 by NewParameterClient and NewSecretClient, and by fakes in
+// tests.
+//
+// Variables named by a full path, such as ${/app/prod/db_password} with
+// the envsubst.PathNames option, resolve the parameter or secret of that
+// name. Other names are prepended with the path of the provider: with
+// the path /app/prod/, ${db_password} resolves the same parameter.
+package aws
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gomodules.xyz/envsubst/internal/ttlcache"
+)
+
+// maxParameters is the maximum number of names accepted by one call to
+// GetParameters.
+const maxParameters = 10
+
+// ParameterClient is the subset of the Parameter Store API used by
+// ParameterStore.
+type ParameterClient interface {
+	// GetParameters returns the decrypted values of the named
+	// parameters, omitting those that do not exist. It is called with
+	// at most 10 names.
+	GetParameters(ctx context.Context, names []string) (map[string]string, error)
+}
+
+// SecretClient is the subset of the Secrets Manager API used by
+// SecretsManager.
+type SecretClient interface {
+	// GetSecretValue returns the string value of the secret with the
+	// given name or ARN. The boolean reports whether the secret exists.
+	GetSecretValue(ctx context.Context, id string) (string, bool, error)
+}
+
+// ParameterStore is a provider resolving variables from Parameter Store.
+// It is safe for concurrent use if the client is.
+type ParameterStore struct {
+	Client ParameterClient
+	// Path is prepended to the variable names that do not start with a
+	// slash to form parameter names.
+	Path string
+	// TTL is how long values are cached. Zero caches values for the
+	// lifetime of the provider, and a negative TTL disables caching.
+	TTL time.Duration
+	// Context is passed to the client, context.Background() if nil.
+	Context context.Context
+
+	cache ttlcache.Cache
+}
+
+// Lookup retrieves the value of the named variable, from the cache if
+// possible.
+func (p *ParameterStore) Lookup(key string) (string, bool, error) {
+	if v, ok, cached := p.cache.Get(key); cached {
+		return v, ok, nil
+	}
+	name := fullName(p.Path, key)
+	values, err := p.Client.GetParameters(background(p.Context), []string{name})
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := values[name]
+	p.cache.Set(key, v, ok, p.TTL)
+	return v, ok, nil
+}
+
+// Prefetch retrieves the values of the named variables that are not
+// cached, in batches of up to 10, so that the variables of a template
+// can be resolved with few calls. It has no effect if caching is
+// disabled.
+func (p *ParameterStore) Prefetch(keys ...string) error {
+	if p.TTL < 0 {
+		return nil
+	}
+	var missing []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if _, _, cached := p.cache.Get(key); !cached && !seen[key] {
+			seen[key] = true
+			missing = append(missing, key)
+		}
+	}
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > maxParameters {
+			batch = batch[:maxParameters]
+		}
+		missing = missing[len(batch):]
+
+		names := make([]string, len(batch))
+		for i, key := range batch {
+			names[i] = fullName(p.Path, key)
+		}
+		values, err := p.Client.GetParameters(background(p.Context), names)
+		if err != nil {
+			return err
+		}
+		for i, key := range batch {
+			v, ok := values[names[i]]
+			p.cache.Set(key, v, ok, p.TTL)
+		}
+	}
+	return nil
+}
+
+// SecretsManager is a provider resolving variables from Secrets Manager.
+// It is safe for concurrent use if the client is.
+type SecretsManager struct {
+	Client SecretClient
+	// Path is prepended to the variable names that do not start with a
+	// slash to form secret names.
+	Path string
+	// TTL is how long values are cached. Zero caches values for the
+	// lifetime of the provider, and a negative TTL disables caching.
+	TTL time.Duration
+	// Context is passed to the client, context.Background() if nil.
+	Context context.Context
+
+	cache ttlcache.Cache
+}
+
+// Lookup retrieves the value of the named variable, from the cache if
+// possible.
+func (s *SecretsManager) Lookup(key string) (string, bool, error) {
+	if v, ok, cached := s.cache.Get(key); cached {
+		return v, ok, nil
+	}
+	v, ok, err := s.Client.GetSecretValue(background(s.Context), fullName(s.Path, key))
+	if err != nil {
+		return "", false, err
+	}
+	s.cache.Set(key, v, ok, s.TTL)
+	return v, ok, nil
+}
+
+// fullName returns the name of the parameter or secret of the variable
+// key: key itself if it is a full path, or else key prepended with
+// path.
+func fullName(path, key string) string {
+	if strings.HasPrefix(key, "/") {
+		return key
+	}
+	return path + key
+}
+
+// background returns ctx, or context.Background() if ctx is nil.
+func background(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"gomodules.xyz/envsubst"
+)
+
+type parameters struct {
+	values map[string]string
+	calls  [][]string
+}
+
+func (p *parameters) GetParameters(ctx context.Context, names []string) (map[string]string, error) {
+	p.calls = append(p.calls, names)
+	values := make(map[string]string)
+	for _, name := range names {
+		if name == "/app/fail" {
+			return nil, errors.New("access denied")
+		}
+		if v, ok := p.values[name]; ok {
+			values[name] = v
+		}
+	}
+	return values, nil
+}
+
+func TestParameterStore(t *testing.T) {
+	client := &parameters{values: map[string]string{"/app/user": "admin", "/app/password": "s3cr3t"}}
+	p := &ParameterStore{Client: client, Path: "/app/"}
+
+	got, err := envsubst.EvalProvider("${user}:${password}@${host:-localhost} ${user}", p)
+	if want := "admin:s3cr3t@localhost admin"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if len(client.calls) != 3 {
+		t.Errorf("Want values and undefined variables cached, got calls %v", client.calls)
+	}
+	if _, _, err := p.Lookup("fail"); err == nil {
+		t.Errorf("Want client error")
+	}
+}
+
+func TestParameterStoreFullPath(t *testing.T) {
+	client := &parameters{values: map[string]string{"/app/prod/db_password": "s3cr3t", "/app/user": "admin"}}
+	p := &ParameterStore{Client: client, Path: "/app/"}
+
+	got, err := envsubst.EvalProvider("${user}:${/app/prod/db_password}", p, envsubst.PathNames())
+	if want := "admin:s3cr3t"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if want := [][]string{{"/app/user"}, {"/app/prod/db_password"}}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("Want full paths looked up as is, got calls %v", client.calls)
+	}
+
+	unprefixed := &ParameterStore{Client: client}
+	if v, ok, err := unprefixed.Lookup("/app/prod/db_password"); v != "s3cr3t" || !ok || err != nil {
+		t.Errorf("Want the full path resolved without a path, got %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestParameterStorePrefetch(t *testing.T) {
+	client := &parameters{values: map[string]string{"/a": "1"}}
+	p := &ParameterStore{Client: client, Path: "/"}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "a"}
+	if err := p.Prefetch(keys...); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 2 || len(client.calls[0]) != 10 || len(client.calls[1]) != 2 {
+		t.Errorf("Want 2 batches of names, got %v", client.calls)
+	}
+	for _, key := range keys {
+		p.Lookup(key)
+	}
+	if len(client.calls) != 2 {
+		t.Errorf("Want prefetched values cached, got calls %v", client.calls)
+	}
+
+	client.calls = nil
+	uncached := &ParameterStore{Client: client, TTL: -1}
+	uncached.Prefetch("a")
+	uncached.Lookup("/a")
+	uncached.Lookup("/a")
+	if want := [][]string{{"/a"}, {"/a"}}; !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("Want no caching, got calls %v", client.calls)
+	}
+}
+
+type secrets map[string]string
+
+func (s secrets) GetSecretValue(ctx context.Context, id string) (string, bool, error) {
+	v, ok := s[id]
+	return v, ok, nil
+}
+
+func TestSecretsManager(t *testing.T) {
+	p := &SecretsManager{Client: secrets{"prod/db": "s3cr3t"}, Path: "prod/"}
+	got, err := envsubst.EvalProvider("${db} ${other:-none}", p)
+	if want := "s3cr3t none"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+}
+
+type ssmAPI struct {
+	input *ssm.GetParametersInput
+}
+
+func (a *ssmAPI) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	a.input = params
+	return &ssm.GetParametersOutput{
+		Parameters:        []ssmtypes.Parameter{{Name: aws.String("/app/user"), Value: aws.String("admin")}},
+		InvalidParameters: []string{"/app/missing"},
+	}, nil
+}
+
+type secretsAPI map[string]*secretsmanager.GetSecretValueOutput
+
+func (a secretsAPI) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if out, ok := a[aws.ToString(params.SecretId)]; ok {
+		return out, nil
+	}
+	if aws.ToString(params.SecretId) == "/denied" {
+		return nil, errors.New("access denied")
+	}
+	return nil, &smtypes.ResourceNotFoundException{Message: aws.String("not found")}
+}
+
+func TestSDKClients(t *testing.T) {
+	api := new(ssmAPI)
+	values, err := NewParameterClient(api).GetParameters(context.Background(), []string{"/app/user", "/app/missing"})
+	if want := map[string]string{"/app/user": "admin"}; err != nil || !reflect.DeepEqual(values, want) {
+		t.Errorf("Want %v, got %v, %v", want, values, err)
+	}
+	if !aws.ToBool(api.input.WithDecryption) {
+		t.Errorf("Want parameters decrypted")
+	}
+
+	p := &SecretsManager{Client: NewSecretClient(secretsAPI{
+		"prod/db":  {SecretString: aws.String("s3cr3t")},
+		"prod/key": {SecretBinary: []byte("k3y")},
+	}), Path: "prod/"}
+	got, err := envsubst.EvalProvider("${db} ${key} ${other:-none}", p)
+	if want := "s3cr3t k3y none"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if _, _, err := p.Lookup("/denied"); err == nil {
+		t.Errorf("Want client error")
+	}
+}
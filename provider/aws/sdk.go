@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SSMAPI is the method of *ssm.Client used by NewParameterClient.
+type SSMAPI interface {
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+}
+
+// SecretsManagerAPI is the method of *secretsmanager.Client used by
+// NewSecretClient.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// NewParameterClient returns a ParameterClient calling Parameter Store
+// with the client of the AWS SDK, decrypting SecureString parameters,
+// as in
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	...
+//	p := &aws.ParameterStore{Client: aws.NewParameterClient(ssm.NewFromConfig(cfg))}
+func NewParameterClient(api SSMAPI) ParameterClient {
+	return parameterClient{api}
+}
+
+type parameterClient struct {
+	api SSMAPI
+}
+
+func (c parameterClient) GetParameters(ctx context.Context, names []string) (map[string]string, error) {
+	out, err := c.api.GetParameters(ctx, &ssm.GetParametersInput{
+		Names:          names,
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// parameters that do not exist are listed in out.InvalidParameters
+	values := make(map[string]string, len(out.Parameters))
+	for _, p := range out.Parameters {
+		values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+	}
+	return values, nil
+}
+
+// NewSecretClient returns a SecretClient calling Secrets Manager with
+// the client of the AWS SDK. Secrets that do not exist are undefined,
+// and binary secrets are resolved as the text of their bytes.
+func NewSecretClient(api SecretsManagerAPI) SecretClient {
+	return secretClient{api}
+}
+
+type secretClient struct {
+	api SecretsManagerAPI
+}
+
+func (c secretClient) GetSecretValue(ctx context.Context, id string) (string, bool, error) {
+	out, err := c.api.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if out.SecretString == nil {
+		return string(out.SecretBinary), true, nil
+	}
+	return *out.SecretString, true, nil
+}
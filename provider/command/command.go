@@ -0,0 +1,115 @@
+// Package command resolves variables by running commands, such as
+// password managers, and capturing their output.
+//
+// Nothing is run unless a provider is constructed with New, which
+// requires every command to be on an allow-list of programs and a
+// timeout bounding each run.
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.xyz/envsubst/internal/ttlcache"
+)
+
+// Provider resolves each of its variables from the standard output of
+// a command, with the trailing line breaks removed. Each command is run
+// at most once, its output being cached. It is safe for concurrent use.
+type Provider struct {
+	// Context is used for the runs, context.Background() if nil. The
+	// commands still running when it is done are killed.
+	Context context.Context
+
+	commands map[string][]string
+	timeout  time.Duration
+	cache    ttlcache.Cache
+	// serializes the runs of each command
+	locks map[string]*sync.Mutex
+}
+
+// New returns a provider resolving the variables named by the keys of
+// commands by running the corresponding command, e.g.
+//
+//	command.New(map[string][]string{
+//		"DB_PASSWORD": {"pass", "show", "db/password"},
+//	}, []string{"pass"}, 5*time.Second)
+//
+// The first element of each command is the program, which must be one
+// of allow, and the others its arguments. No shell is involved. Each
+// run is killed after timeout, which must be positive. Other variables
+// are undefined.
+func New(commands map[string][]string, allow []string, timeout time.Duration) (*Provider, error) {
+	if timeout <= 0 {
+		return nil, errors.New("command: timeout must be positive")
+	}
+	allowed := make(map[string]bool, len(allow))
+	for _, name := range allow {
+		allowed[name] = true
+	}
+	p := &Provider{
+		commands: make(map[string][]string, len(commands)),
+		timeout:  timeout,
+		locks:    make(map[string]*sync.Mutex, len(commands)),
+	}
+	for key, args := range commands {
+		if len(args) == 0 || args[0] == "" {
+			return nil, fmt.Errorf("command: empty command for %s", key)
+		}
+		if !allowed[args[0]] {
+			return nil, fmt.Errorf("command: %s is not allowed for %s", args[0], key)
+		}
+		p.commands[key] = append([]string(nil), args...)
+		p.locks[key] = new(sync.Mutex)
+	}
+	return p, nil
+}
+
+// Lookup runs the command of the named variable, unless its output is
+// cached. Concurrent lookups of a variable wait for a single run. A
+// command that fails or times out is an error, including the start of
+// its standard error, and is run again by the next lookup.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	args, ok := p.commands[key]
+	if !ok {
+		return "", false, nil
+	}
+	mu := p.locks[key]
+	mu.Lock()
+	defer mu.Unlock()
+	if v, ok, cached := p.cache.Get(key); cached {
+		return v, ok, nil
+	}
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		if msg != "" {
+			return "", false, fmt.Errorf("command: %s for %s: %v: %s", args[0], key, err, msg)
+		}
+		return "", false, fmt.Errorf("command: %s for %s: %v", args[0], key, err)
+	}
+	v := strings.TrimRight(stdout.String(), "\r\n")
+	p.cache.Set(key, v, true, 0)
+	return v, true, nil
+}
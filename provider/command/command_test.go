@@ -0,0 +1,112 @@
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gomodules.xyz/envsubst"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		commands map[string][]string
+		allow    []string
+		timeout  time.Duration
+	}{
+		{map[string][]string{"A": {"echo", "a"}}, []string{"echo"}, 0},
+		{map[string][]string{"A": {"echo", "a"}}, nil, time.Second},
+		{map[string][]string{"A": {"/bin/echo", "a"}}, []string{"echo"}, time.Second},
+		{map[string][]string{"A": {}}, []string{"echo"}, time.Second},
+	}
+	for _, test := range tests {
+		if _, err := New(test.commands, test.allow, test.timeout); err == nil {
+			t.Errorf("Want error for %v allowing %v with timeout %v", test.commands, test.allow, test.timeout)
+		}
+	}
+}
+
+func TestProvider(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	p, err := New(map[string][]string{
+		"USER":     {"echo", "admin"},
+		"PASSWORD": {"sh", "-c", "printf 's3cr3t\\n\\n'"},
+		"FAIL":     {"sh", "-c", "echo denied >&2; exit 1"},
+		"SLOW":     {"sleep", "5"},
+	}, []string{"echo", "sh", "sleep"}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := envsubst.EvalProvider("${USER}:${PASSWORD} ${HOST:-localhost}", p)
+	if want := "admin:s3cr3t localhost"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if _, _, err := p.Lookup("FAIL"); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Want error with standard error, got %v", err)
+	}
+	start := time.Now()
+	if _, _, err := p.Lookup("SLOW"); err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("Want timeout error, got %v after %v", err, time.Since(start))
+	}
+}
+
+// TestConcurrentLookups is meant to be run with -race.
+func TestConcurrentLookups(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	dir, err := ioutil.TempDir("", "command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "runs")
+	p, err := New(map[string][]string{
+		"TOKEN": {"sh", "-c", "echo run >> '" + log + "'; sleep 0.1; echo t0k3n"},
+	}, []string{"sh"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Context = context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, ok, err := p.Lookup("TOKEN"); v != "t0k3n" || !ok || err != nil {
+				t.Errorf("Want t0k3n, got %q, %v, %v", v, ok, err)
+			}
+		}()
+	}
+	wg.Wait()
+	runs, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Errorf("Want the command run once, got %d runs", n)
+	}
+}
+
+func TestContext(t *testing.T) {
+	p, err := New(map[string][]string{"A": {"sleep", "5"}}, []string{"sleep"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Context = ctx
+	if _, _, err := p.Lookup("A"); err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("Want %v, got %v", context.Canceled, err)
+	}
+}
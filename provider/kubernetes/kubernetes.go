@@ -0,0 +1,200 @@
+// Package kubernetes resolves variables from the keys of a ConfigMap or
+// a Secret, so that renderers running in a cluster read their settings
+// directly rather than from an environment exported by an init
+// container. The package is a separate module, built on client-go.
+//
+// A Provider reads its object through the Client interface, implemented
+// over a clientset by NewClient. InCluster creates one authenticated as
+// the service account of the pod:
+//
+//	client, namespace, err := kubernetes.InCluster()
+//	if err != nil {
+//		return err
+//	}
+//	p := &kubernetes.Provider{
+//		Client:    client,
+//		Kind:      kubernetes.Secret,
+//		Namespace: namespace,
+//		Name:      "app",
+//		Refresh:   time.Minute,
+//	}
+//
+// The values of Secrets and the binary data of ConfigMaps are resolved as
+// the text of their bytes.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Kind is the kind of object holding the variables.
+type Kind string
+
+// The kinds of objects, named by their API resource.
+const (
+	ConfigMap Kind = "configmaps"
+	Secret    Kind = "secrets"
+)
+
+// Client is the subset of the Kubernetes API used by Provider.
+type Client interface {
+	// Get returns the data of the named object, with the values of
+	// Secrets decoded. The boolean reports whether the object exists.
+	Get(ctx context.Context, kind Kind, namespace, name string) (map[string]string, bool, error)
+}
+
+// Provider resolves variables from the keys of a ConfigMap or Secret.
+// The object is read on the first lookup and again once Refresh has
+// elapsed. A missing object leaves every variable undefined. It is safe
+// for concurrent use if the client is.
+type Provider struct {
+	Client    Client
+	Kind      Kind
+	Namespace string
+	Name      string
+	// Refresh is how long the object is kept before it is read again.
+	// Zero reads it once.
+	Refresh time.Duration
+	// Context is passed to the client, context.Background() if nil.
+	Context context.Context
+
+	mu   sync.Mutex
+	data map[string]string
+	read time.Time
+}
+
+// Lookup retrieves the value of the named key of the object.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	data, err := p.load()
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := data[key]
+	return v, ok, nil
+}
+
+// Keys returns the sorted keys of the object, nil if it cannot be read.
+func (p *Provider) Keys() []string {
+	data, err := p.load()
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// load returns the data of the object, reading it if it was never read
+// or is due for a refresh.
+func (p *Provider) load() (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.read.IsZero() && (p.Refresh <= 0 || time.Since(p.read) < p.Refresh) {
+		return p.data, nil
+	}
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	data, _, err := p.Client.Get(ctx, p.Kind, p.Namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	p.data, p.read = data, time.Now()
+	return data, nil
+}
+
+// serviceAccount is the directory holding the credentials of the
+// service account mounted in pods.
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// InCluster returns a client authenticated as the service account of the
+// pod it runs in, together with the namespace of the pod.
+func InCluster() (Client, string, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	clientset, err := k8s.NewForConfig(config)
+	if err != nil {
+		return nil, "", err
+	}
+	namespace, err := ioutil.ReadFile(filepath.Join(serviceAccount, "namespace"))
+	if err != nil {
+		return nil, "", err
+	}
+	return NewClient(clientset), strings.TrimSpace(string(namespace)), nil
+}
+
+// NewClient returns a Client reading objects with the clientset.
+func NewClient(clientset k8s.Interface) Client {
+	return client{clientset}
+}
+
+type client struct {
+	clientset k8s.Interface
+}
+
+func (c client) Get(ctx context.Context, kind Kind, namespace, name string) (map[string]string, bool, error) {
+	var data map[string]string
+	var err error
+	switch kind {
+	case ConfigMap:
+		data, err = c.configMap(ctx, namespace, name)
+	case Secret:
+		data, err = c.secret(ctx, namespace, name)
+	default:
+		return nil, false, fmt.Errorf("kubernetes: unknown kind %s", kind)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// configMap returns the data and binary data of the named ConfigMap.
+func (c client) configMap(ctx context.Context, namespace, name string) (map[string]string, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(cm.Data)+len(cm.BinaryData))
+	for k, v := range cm.Data {
+		data[k] = v
+	}
+	for k, v := range cm.BinaryData {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
+// secret returns the data of the named Secret.
+func (c client) secret(ctx context.Context, namespace, name string) (map[string]string, error) {
+	s, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
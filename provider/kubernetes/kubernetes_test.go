@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gomodules.xyz/envsubst"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type objects struct {
+	data  map[string]map[string]string
+	reads int
+}
+
+func (o *objects) Get(ctx context.Context, kind Kind, namespace, name string) (map[string]string, bool, error) {
+	o.reads++
+	data, ok := o.data[string(kind)+"/"+namespace+"/"+name]
+	return data, ok, nil
+}
+
+func TestProvider(t *testing.T) {
+	client := &objects{data: map[string]map[string]string{
+		"configmaps/prod/app": {"host": "db.local", "port": "5432"},
+	}}
+	p := &Provider{Client: client, Kind: ConfigMap, Namespace: "prod", Name: "app"}
+	got, err := envsubst.EvalProvider("${host}:${port} ${user:-admin}", p)
+	if want := "db.local:5432 admin"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if client.reads != 1 {
+		t.Errorf("Want the object read once, got %d reads", client.reads)
+	}
+	if keys := p.Keys(); !reflect.DeepEqual(keys, []string{"host", "port"}) {
+		t.Errorf("Want keys, got %v", keys)
+	}
+
+	p = &Provider{Client: client, Kind: Secret, Namespace: "prod", Name: "app", Refresh: time.Millisecond}
+	if _, ok, err := p.Lookup("host"); ok || err != nil {
+		t.Errorf("Want missing object undefined, got %v, %v", ok, err)
+	}
+	client.data["secrets/prod/app"] = map[string]string{"host": "db2.local"}
+	time.Sleep(2 * time.Millisecond)
+	if v, ok, err := p.Lookup("host"); v != "db2.local" || !ok || err != nil {
+		t.Errorf("Want refreshed value, got %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "app"},
+			Data:       map[string]string{"host": "db.local"},
+			BinaryData: map[string][]byte{"cert": []byte("PEM")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "app"},
+			Data:       map[string][]byte{"password": []byte("s3cr3t")},
+		},
+	)
+	c := NewClient(clientset)
+	ctx := context.Background()
+	data, ok, err := c.Get(ctx, ConfigMap, "prod", "app")
+	if want := map[string]string{"host": "db.local", "cert": "PEM"}; !ok || err != nil || !reflect.DeepEqual(data, want) {
+		t.Errorf("Want %v, got %v, %v, %v", want, data, ok, err)
+	}
+	data, ok, err = c.Get(ctx, Secret, "prod", "app")
+	if want := map[string]string{"password": "s3cr3t"}; !ok || err != nil || !reflect.DeepEqual(data, want) {
+		t.Errorf("Want %v, got %v, %v, %v", want, data, ok, err)
+	}
+	if _, ok, err := c.Get(ctx, Secret, "prod", "missing"); ok || err != nil {
+		t.Errorf("Want missing object, got %v, %v", ok, err)
+	}
+	if _, _, err := c.Get(ctx, Kind("pods"), "prod", "app"); err == nil {
+		t.Errorf("Want error for unknown kind")
+	}
+
+	p := &Provider{Client: c, Kind: Secret, Namespace: "prod", Name: "app"}
+	got, err := envsubst.EvalProvider("${password}", p)
+	if err != nil || got != "s3cr3t" {
+		t.Errorf("Want the secret resolved, got %q, %v", got, err)
+	}
+}
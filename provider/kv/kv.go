@@ -0,0 +1,166 @@
+// Package kv resolves variables from the key-value stores of Consul and
+// etcd, through their HTTP APIs.
+//
+// Keys are formed by prepending a prefix to variable names: with the
+// prefix config/app/, the reference ${db_host} resolves the key
+// config/app/db_host, so that values shared by a cluster can be
+// organised by application or environment.
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gomodules.xyz/envsubst/internal/ttlcache"
+)
+
+// Client is the subset of a key-value store API used by Provider.
+type Client interface {
+	// Get returns the value of the key. The boolean reports whether the
+	// key exists.
+	Get(ctx context.Context, key string) (string, bool, error)
+}
+
+// Provider resolves variables from the keys of a store. It is safe for
+// concurrent use if the client is.
+type Provider struct {
+	Client Client
+	// Prefix is prepended to variable names to form keys.
+	Prefix string
+	// TTL is how long values are cached. Zero caches values for the
+	// lifetime of the provider, and a negative TTL disables caching.
+	TTL time.Duration
+	// Context is passed to the client, context.Background() if nil.
+	Context context.Context
+
+	cache ttlcache.Cache
+}
+
+// Lookup retrieves the value of the named variable, from the cache if
+// possible.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	if v, ok, cached := p.cache.Get(key); cached {
+		return v, ok, nil
+	}
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	v, ok, err := p.Client.Get(ctx, p.Prefix+key)
+	if err != nil {
+		return "", false, err
+	}
+	p.cache.Set(key, v, ok, p.TTL)
+	return v, ok, nil
+}
+
+// Consul is a client of the KV store of Consul.
+type Consul struct {
+	// Address is the URL of the agent, e.g. http://localhost:8500.
+	Address string
+	// Token is the ACL token of the requests, if any.
+	Token string
+	// Datacenter is the datacenter to query, the agent's if empty.
+	Datacenter string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Get returns the raw value of the key.
+func (c *Consul) Get(ctx context.Context, key string) (string, bool, error) {
+	q := url.Values{"raw": {""}}
+	if c.Datacenter != "" {
+		q.Set("dc", c.Datacenter)
+	}
+	u := strings.TrimSuffix(c.Address, "/") + "/v1/kv/" + strings.TrimPrefix(key, "/") + "?" + q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", false, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	body, ok, err := send(ctx, c.Client, req)
+	if !ok || err != nil {
+		return "", false, err
+	}
+	return string(body), true, nil
+}
+
+// Etcd is a client of etcd version 3, through its JSON gateway.
+type Etcd struct {
+	// Address is the URL of a member, e.g. http://localhost:2379.
+	Address string
+	// Token is the authentication token of the requests, if any.
+	Token string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Get returns the value of the key.
+func (e *Etcd) Get(ctx context.Context, key string) (string, bool, error) {
+	b, err := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(key))})
+	if err != nil {
+		return "", false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(e.Address, "/")+"/v3/kv/range", bytes.NewReader(b))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.Token != "" {
+		req.Header.Set("Authorization", e.Token)
+	}
+	body, ok, err := send(ctx, e.Client, req)
+	if !ok || err != nil {
+		return "", false, err
+	}
+	var resp struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+	v, err := base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+	if err != nil {
+		return "", false, err
+	}
+	return string(v), true, nil
+}
+
+// send sends the request and returns the body of the response. The
+// boolean is false for not found responses, which are not errors.
+func send(ctx context.Context, client *http.Client, req *http.Request) ([]byte, bool, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		b, err := ioutil.ReadAll(resp.Body)
+		return b, err == nil, err
+	case http.StatusNotFound:
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, false, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil, false, fmt.Errorf("kv: %s %s: %s", req.Method, req.URL.Path, resp.Status)
+}
@@ -0,0 +1,82 @@
+package kv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gomodules.xyz/envsubst"
+)
+
+func TestConsul(t *testing.T) {
+	var reads int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads++
+		if r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if _, ok := r.URL.Query()["raw"]; !ok || r.URL.Query().Get("dc") != "east" {
+			t.Errorf("Want raw value from dc east, got query %q", r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/v1/kv/config/app/host":
+			w.Write([]byte("db.local"))
+		case "/v1/kv/config/app/port":
+			w.Write([]byte("5432"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	p := &Provider{Client: &Consul{Address: s.URL, Token: "token", Datacenter: "east"}, Prefix: "config/app/"}
+	got, err := envsubst.EvalProvider("${host}:${port}/${name:-app} ${host} ${name:-app}", p)
+	if want := "db.local:5432/app db.local app"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if reads != 3 {
+		t.Errorf("Want values and undefined variables cached, got %d reads", reads)
+	}
+
+	p = &Provider{Client: &Consul{Address: s.URL}, Prefix: "config/app/"}
+	if _, _, err := p.Lookup("host"); err == nil {
+		t.Errorf("Want error for missing token")
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/kv/range" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req struct{ Key string }
+		json.NewDecoder(r.Body).Decode(&req)
+		key, _ := base64.StdEncoding.DecodeString(req.Key)
+		if string(key) == "/config/app/gone" {
+			// as a proxy in front of the gateway may answer
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp := map[string]interface{}{}
+		if string(key) == "/config/app/host" {
+			resp["kvs"] = []map[string]string{{"key": req.Key, "value": base64.StdEncoding.EncodeToString([]byte("db.local"))}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer s.Close()
+
+	p := &Provider{Client: &Etcd{Address: s.URL}, Prefix: "/config/app/", TTL: -1}
+	if v, ok, err := p.Lookup("host"); v != "db.local" || !ok || err != nil {
+		t.Errorf("Want value, got %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := p.Lookup("port"); ok || err != nil {
+		t.Errorf("Want undefined, got %v, %v", ok, err)
+	}
+	if _, ok, err := p.Lookup("gone"); ok || err != nil {
+		t.Errorf("Want undefined for not found, got %v, %v", ok, err)
+	}
+}
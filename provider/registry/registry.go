@@ -0,0 +1,69 @@
+// Package registry resolves variables from the values of a key of the
+// Windows registry, for hosts whose configuration lives there rather
+// than in the environment. The provider is only available on Windows.
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// roots maps the names of the predefined keys, and their abbreviations,
+// to their canonical names.
+var roots = map[string]string{
+	"HKEY_CLASSES_ROOT":   "HKEY_CLASSES_ROOT",
+	"HKCR":                "HKEY_CLASSES_ROOT",
+	"HKEY_CURRENT_USER":   "HKEY_CURRENT_USER",
+	"HKCU":                "HKEY_CURRENT_USER",
+	"HKEY_LOCAL_MACHINE":  "HKEY_LOCAL_MACHINE",
+	"HKLM":                "HKEY_LOCAL_MACHINE",
+	"HKEY_USERS":          "HKEY_USERS",
+	"HKU":                 "HKEY_USERS",
+	"HKEY_CURRENT_CONFIG": "HKEY_CURRENT_CONFIG",
+	"HKCC":                "HKEY_CURRENT_CONFIG",
+}
+
+// splitPath splits a key path such as HKLM\SOFTWARE\MyApp into the
+// canonical name of its predefined key and the path of the subkey.
+func splitPath(path string) (root, subkey string, err error) {
+	path = strings.Replace(path, "/", `\`, -1)
+	i := strings.IndexByte(path, '\\')
+	if i < 0 {
+		i = len(path)
+	}
+	root, ok := roots[strings.ToUpper(path[:i])]
+	if !ok {
+		return "", "", fmt.Errorf("registry: unknown predefined key in %s", path)
+	}
+	return root, strings.Trim(path[i:], `\`), nil
+}
+
+// joinMulti joins the NUL-separated strings of a REG_MULTI_SZ value by
+// line breaks.
+func joinMulti(s string) string {
+	return strings.Replace(s, "\x00", "\n", -1)
+}
+
+// pathError reports a key that cannot be opened.
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return "registry: open " + e.path + ": " + e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+// valueError reports a value of a type that cannot be used as text.
+type valueError struct {
+	name string
+	typ  uint32
+}
+
+func (e *valueError) Error() string {
+	return fmt.Sprintf("registry: value %s has unsupported type %d", e.name, e.typ)
+}
@@ -0,0 +1,31 @@
+package registry
+
+import "testing"
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path, root, subkey string
+	}{
+		{`HKLM\SOFTWARE\MyApp`, "HKEY_LOCAL_MACHINE", `SOFTWARE\MyApp`},
+		{`HKEY_CURRENT_USER\Software\MyApp\`, "HKEY_CURRENT_USER", `Software\MyApp`},
+		{`hkcu/Software/MyApp`, "HKEY_CURRENT_USER", `Software\MyApp`},
+		{`HKU`, "HKEY_USERS", ""},
+	}
+	for _, test := range tests {
+		root, subkey, err := splitPath(test.path)
+		if root != test.root || subkey != test.subkey || err != nil {
+			t.Errorf("Want %q, %q for %q, got %q, %q, %v", test.root, test.subkey, test.path, root, subkey, err)
+		}
+	}
+	for _, path := range []string{"", `SOFTWARE\MyApp`, `HKXX\SOFTWARE`} {
+		if _, _, err := splitPath(path); err == nil {
+			t.Errorf("Want error for %q", path)
+		}
+	}
+}
+
+func TestJoinMulti(t *testing.T) {
+	if got := joinMulti("a\x00b\x00c"); got != "a\nb\nc" {
+		t.Errorf("Want strings joined by line breaks, got %q", got)
+	}
+}
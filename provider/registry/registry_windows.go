@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// handles maps the canonical names of the predefined keys to their
+// handles.
+var handles = map[string]syscall.Handle{
+	"HKEY_CLASSES_ROOT":   syscall.HKEY_CLASSES_ROOT,
+	"HKEY_CURRENT_USER":   syscall.HKEY_CURRENT_USER,
+	"HKEY_LOCAL_MACHINE":  syscall.HKEY_LOCAL_MACHINE,
+	"HKEY_USERS":          syscall.HKEY_USERS,
+	"HKEY_CURRENT_CONFIG": syscall.HKEY_CURRENT_CONFIG,
+}
+
+// Provider resolves each variable from the value of the same name of a
+// registry key. String values are returned as stored, without expanding
+// the environment variables of REG_EXPAND_SZ values, the strings of
+// REG_MULTI_SZ values are joined by line breaks, and REG_DWORD and
+// REG_QWORD values are returned in decimal. Missing values are
+// undefined. It is safe for concurrent use until closed.
+type Provider struct {
+	mu  sync.RWMutex
+	key syscall.Handle
+}
+
+// Open opens the key with the given path for reading, e.g.
+// HKLM\SOFTWARE\MyApp. The predefined key may be abbreviated as HKCR,
+// HKCU, HKLM, HKU or HKCC. The provider must be closed after use.
+func Open(path string) (*Provider, error) {
+	root, subkey, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	name, err := syscall.UTF16PtrFromString(subkey)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Provider)
+	if err := syscall.RegOpenKeyEx(handles[root], name, 0, syscall.KEY_READ, &p.key); err != nil {
+		return nil, &pathError{path: path, err: err}
+	}
+	return p, nil
+}
+
+// Close closes the key.
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.key == 0 {
+		return nil
+	}
+	err := syscall.RegCloseKey(p.key)
+	p.key = 0
+	return err
+}
+
+// Lookup retrieves the value of the same name as the variable.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.key == 0 {
+		return "", false, syscall.EINVAL
+	}
+	name, err := syscall.UTF16PtrFromString(key)
+	if err != nil {
+		return "", false, nil
+	}
+	var typ, n uint32
+	buf := make([]byte, 256)
+	for {
+		n = uint32(len(buf))
+		err = syscall.RegQueryValueEx(p.key, name, nil, &typ, &buf[0], &n)
+		if err != syscall.ERROR_MORE_DATA {
+			break
+		}
+		buf = make([]byte, n)
+	}
+	if err == syscall.ERROR_FILE_NOT_FOUND {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	buf = buf[:n]
+
+	switch typ {
+	case syscall.REG_SZ, syscall.REG_EXPAND_SZ:
+		return decodeUTF16(buf), true, nil
+	case syscall.REG_MULTI_SZ:
+		return joinMulti(decodeUTF16(buf)), true, nil
+	case syscall.REG_DWORD:
+		if len(buf) == 4 {
+			return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(buf)), 10), true, nil
+		}
+	case syscall.REG_QWORD:
+		if len(buf) == 8 {
+			return strconv.FormatUint(binary.LittleEndian.Uint64(buf), 10), true, nil
+		}
+	}
+	return "", false, &valueError{name: key, typ: typ}
+}
+
+// decodeUTF16 decodes the UTF-16 text of a registry value, up to its
+// final terminators.
+func decodeUTF16(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	s := (*[1 << 29]uint16)(unsafe.Pointer(&b[0]))[: len(b)/2 : len(b)/2]
+	for len(s) > 0 && s[len(s)-1] == 0 {
+		s = s[:len(s)-1]
+	}
+	return string(utf16.Decode(s))
+}
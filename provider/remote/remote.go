@@ -0,0 +1,121 @@
+// Package remote resolves variables from an HTTP configuration service.
+//
+// The value of a variable is the body of the response to GET
+// {URL}/vars/{name}. A 404 Not Found response leaves the variable
+// undefined and other responses than 200 OK are errors.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gomodules.xyz/envsubst/internal/ttlcache"
+)
+
+// Provider resolves variables from a configuration service. It is safe
+// for concurrent use.
+type Provider struct {
+	// URL is the base URL of the service, e.g. https://config.internal.
+	URL string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Auth is called on each request before it is sent, to set its
+	// authentication headers, if set.
+	Auth func(req *http.Request) error
+	// Timeout bounds each attempt of a lookup, if positive.
+	Timeout time.Duration
+	// Retries is the number of times a lookup is retried after a
+	// network error or a 5xx response.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each
+	// following one.
+	Backoff time.Duration
+	// TTL is how long values are cached. Zero caches values for the
+	// lifetime of the provider, and a negative TTL disables caching.
+	TTL time.Duration
+	// Context is used for the requests, context.Background() if nil.
+	Context context.Context
+
+	cache ttlcache.Cache
+}
+
+// Bearer returns an Auth function setting a bearer token.
+func Bearer(token string) func(req *http.Request) error {
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// Lookup retrieves the value of the named variable, from the cache if
+// possible.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	if v, ok, cached := p.cache.Get(key); cached {
+		return v, ok, nil
+	}
+	ctx := p.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	delay := p.Backoff
+	for retries := p.Retries; ; retries-- {
+		v, ok, retry, err := p.get(ctx, key)
+		if err == nil {
+			p.cache.Set(key, v, ok, p.TTL)
+			return v, ok, nil
+		}
+		if !retry || retries <= 0 || ctx.Err() != nil {
+			return "", false, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// get requests the value of the named variable once. The third boolean
+// reports whether a failed request may be retried.
+func (p *Provider) get(ctx context.Context, key string) (string, bool, bool, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.URL, "/")+"/vars/"+url.PathEscape(key), nil)
+	if err != nil {
+		return "", false, false, err
+	}
+	req = req.WithContext(ctx)
+	if p.Auth != nil {
+		if err := p.Auth(req); err != nil {
+			return "", false, false, err
+		}
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, true, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err == nil, err != nil, err
+	case http.StatusNotFound:
+		return "", false, false, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return "", false, resp.StatusCode >= 500, fmt.Errorf("remote: GET %s: %s", req.URL.Path, resp.Status)
+}
@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gomodules.xyz/envsubst"
+)
+
+func TestProvider(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/vars/host":
+			w.Write([]byte("db.local"))
+		case "/vars/a%20b":
+			w.Write([]byte("escaped"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	p := &Provider{URL: s.URL + "/", Auth: Bearer("token")}
+	got, err := envsubst.EvalProvider("${host}:${port:-5432} ${host} ${port:-5432}", p)
+	if want := "db.local:5432 db.local 5432"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if requests != 2 {
+		t.Errorf("Want values and undefined variables cached, got %d requests", requests)
+	}
+	if v, ok, err := p.Lookup("a b"); v != "escaped" || !ok || err != nil {
+		t.Errorf("Want escaped name, got %q, %v, %v", v, ok, err)
+	}
+
+	p = &Provider{URL: s.URL, Retries: 3}
+	requests = 0
+	if _, _, err := p.Lookup("host"); err == nil || requests != 1 {
+		t.Errorf("Want client errors not retried, got %d requests, %v", requests, err)
+	}
+}
+
+func TestProviderRetry(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	p := &Provider{URL: s.URL, Retries: 2, Backoff: time.Millisecond}
+	if v, ok, err := p.Lookup("x"); v != "ok" || !ok || err != nil {
+		t.Errorf("Want value after retries, got %q, %v, %v", v, ok, err)
+	}
+
+	requests = 0
+	p = &Provider{URL: s.URL, Retries: 1, Backoff: time.Millisecond}
+	if _, _, err := p.Lookup("x"); err == nil || requests != 2 {
+		t.Errorf("Want error after retries, got %d requests, %v", requests, err)
+	}
+}
+
+func TestProviderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+	defer close(done)
+
+	p := &Provider{URL: s.URL, Timeout: 10 * time.Millisecond}
+	if _, _, err := p.Lookup("x"); err == nil {
+		t.Errorf("Want timeout error")
+	}
+}
@@ -0,0 +1,305 @@
+// Package vault resolves variables from the KV version 2 secrets engine
+// of HashiCorp Vault, through its HTTP API.
+//
+// Each variable is mapped to a field of a secret by the Path function of
+// the provider, e.g. with
+//
+//	Path: vault.Fields("app/prod/db")
+//
+// the reference ${password} resolves the field password of the secret
+// app/prod/db, and with a path template such as
+//
+//	Path: vault.MustPathTemplate("app/prod/${key,,}#value")
+//
+// the reference ${DB_PASSWORD} resolves the field value of the secret
+// app/prod/db_password.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gomodules.xyz/envsubst"
+	"gomodules.xyz/envsubst/internal/ttlcache"
+)
+
+// Provider resolves variables from the fields of KV version 2 secrets.
+// Secrets are read once per provider and their values cached for TTL,
+// or for the lease duration returned by Vault if shorter. It is safe
+// for concurrent use.
+type Provider struct {
+	// Address is the URL of the Vault server, e.g.
+	// https://vault.example.com:8200.
+	Address string
+	// Mount is the mount path of the secrets engine, "secret" if empty.
+	Mount string
+	// Path maps a variable name to the path of the secret holding its
+	// value, relative to the mount, and the name of the field.
+	Path func(key string) (path, field string)
+	// Auth supplies the token of the requests.
+	Auth Auth
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// TTL is how long secrets are cached. Zero caches them for the
+	// lifetime of the provider, unless Vault returns a lease, and a
+	// negative TTL disables caching.
+	TTL time.Duration
+	// Context is used for the requests, context.Background() if nil.
+	Context context.Context
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time // zero if the token does not expire
+	cache   ttlcache.Cache
+}
+
+// Auth supplies the tokens authenticating requests to Vault.
+type Auth interface {
+	// Login returns a token and how long it is valid, zero if it does
+	// not expire.
+	Login(ctx context.Context, p *Provider) (token string, ttl time.Duration, err error)
+}
+
+// Token is a static token.
+type Token string
+
+// Login returns the token, which does not expire.
+func (t Token) Login(ctx context.Context, p *Provider) (string, time.Duration, error) {
+	return string(t), 0, nil
+}
+
+// AppRole logs in with the AppRole auth method.
+type AppRole struct {
+	RoleID   string
+	SecretID string
+	// Mount is the mount path of the auth method, "approle" if empty.
+	Mount string
+}
+
+// Login logs in with the role and secret IDs, returning the client
+// token and its lease duration.
+func (a AppRole) Login(ctx context.Context, p *Provider) (string, time.Duration, error) {
+	mount := a.Mount
+	if mount == "" {
+		mount = "approle"
+	}
+	body, err := json.Marshal(map[string]string{"role_id": a.RoleID, "secret_id": a.SecretID})
+	if err != nil {
+		return "", 0, err
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if _, err := p.do(ctx, http.MethodPost, "auth/"+mount+"/login", "", bytes.NewReader(body), &resp); err != nil {
+		return "", 0, err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", 0, fmt.Errorf("vault: no token in approle login response")
+	}
+	return resp.Auth.ClientToken, time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// Fields returns a Path function mapping each variable to the field of
+// the same name of the secret at path.
+func Fields(path string) func(key string) (string, string) {
+	return func(key string) (string, string) {
+		return path, key
+	}
+}
+
+// PathTemplate returns a Path function expanding the template with the
+// variable name bound to ${key}. The template is split at its last #
+// into the path of the secret and the name of the field, value if there
+// is no #. All the functions of the package envsubst apply, e.g.
+// app/${key,,} maps DB_PASSWORD to the field value of app/db_password.
+func PathTemplate(tmpl string) (func(key string) (string, string), error) {
+	t, err := envsubst.Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return func(key string) (string, string) {
+		s, _ := t.ExecuteProvider(envsubst.ProviderFunc(func(name string) (string, bool, error) {
+			return key, name == "key", nil
+		}))
+		if i := strings.LastIndexByte(s, '#'); i >= 0 {
+			return s[:i], s[i+1:]
+		}
+		return s, "value"
+	}, nil
+}
+
+// MustPathTemplate is like PathTemplate but panics if the template
+// cannot be parsed.
+func MustPathTemplate(tmpl string) func(key string) (string, string) {
+	fn, err := PathTemplate(tmpl)
+	if err != nil {
+		panic(`vault: PathTemplate(` + quote(tmpl) + `): ` + err.Error())
+	}
+	return fn
+}
+
+// Lookup retrieves the value of the named variable from the field of
+// its secret, from the cache if possible. Variables whose secret or
+// field does not exist are undefined.
+func (p *Provider) Lookup(key string) (string, bool, error) {
+	path, field := p.Path(key)
+	// the fields of a secret are cached under path#field, after the
+	// secret itself under path, so that they do not expire before it.
+	if v, ok, cached := p.cache.Get(path + "#" + field); cached {
+		return v, ok, nil
+	}
+	if _, _, cached := p.cache.Get(path); cached {
+		return "", false, nil
+	}
+	fields, err := p.read(path)
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := fields[field]
+	return v, ok, nil
+}
+
+// read reads the fields of the secret at path, nil if it does not
+// exist, and caches them.
+func (p *Provider) read(path string) (map[string]string, error) {
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	var resp struct {
+		LeaseDuration int `json:"lease_duration"`
+		Data          struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	status, err := p.request(background(p.Context), http.MethodGet, mount+"/data/"+strings.TrimPrefix(path, "/"), &resp)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]string
+	if status != http.StatusNotFound {
+		fields = make(map[string]string, len(resp.Data.Data))
+		for k, v := range resp.Data.Data {
+			if s, ok := v.(string); ok {
+				fields[k] = s
+			} else {
+				b, _ := json.Marshal(v)
+				fields[k] = string(b)
+			}
+		}
+	}
+
+	ttl := p.TTL
+	if lease := time.Duration(resp.LeaseDuration) * time.Second; lease > 0 && ttl >= 0 && (ttl == 0 || lease < ttl) {
+		ttl = lease
+	}
+	p.cache.Set(path, "", fields != nil, ttl)
+	for k, v := range fields {
+		p.cache.Set(path+"#"+k, v, true, ttl)
+	}
+	return fields, nil
+}
+
+// request sends an authenticated request, logging in again once if the
+// token is rejected. Not found responses are not errors.
+func (p *Provider) request(ctx context.Context, method, path string, v interface{}) (int, error) {
+	for retry := true; ; retry = false {
+		token, err := p.login(ctx)
+		if err != nil {
+			return 0, err
+		}
+		status, err := p.do(ctx, method, path, token, nil, v)
+		if status == http.StatusForbidden && retry {
+			p.mu.Lock()
+			p.token = ""
+			p.mu.Unlock()
+			continue
+		}
+		if status == http.StatusNotFound {
+			return status, nil
+		}
+		return status, err
+	}
+}
+
+// login returns the current token, logging in if there is none or it
+// expired.
+func (p *Provider) login(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && (p.expires.IsZero() || time.Now().Before(p.expires)) {
+		return p.token, nil
+	}
+	if p.Auth == nil {
+		return "", fmt.Errorf("vault: no auth method")
+	}
+	token, ttl, err := p.Auth.Login(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	p.token, p.expires = token, time.Time{}
+	if ttl > 0 {
+		p.expires = time.Now().Add(ttl)
+	}
+	return token, nil
+}
+
+// do sends a request to the API path with the token, if any, and
+// decodes the JSON response into v. It returns the status code of the
+// response, with an error for codes other than 200.
+func (p *Provider) do(ctx context.Context, method, path, token string, body io.Reader, v interface{}) (int, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(p.Address, "/")+"/v1/"+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, fmt.Errorf("vault: %s %s: %s", method, path, resp.Status)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// background returns ctx, or context.Background() if ctx is nil.
+func background(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// quote returns s quoted for messages, with backquotes if possible, as
+// the panics of envsubst.MustEval do.
+func quote(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
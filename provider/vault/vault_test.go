@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gomodules.xyz/envsubst"
+)
+
+// server fakes the KV version 2 and AppRole APIs of Vault.
+type server struct {
+	*httptest.Server
+	secrets map[string]map[string]interface{}
+	lease   int
+	tokens  map[string]bool
+	reads   int
+	logins  int
+}
+
+func newServer(secrets map[string]map[string]interface{}) *server {
+	s := &server{secrets: secrets, tokens: map[string]bool{"root": true}}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["role_id"] != "role" || req["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.logins++
+		s.tokens["approle"] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "approle", "lease_duration": 3600},
+		})
+		return
+	}
+	if !s.tokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.reads++
+	data, ok := s.secrets[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lease_duration": s.lease,
+		"data":           map[string]interface{}{"data": data},
+	})
+}
+
+func TestProvider(t *testing.T) {
+	s := newServer(map[string]map[string]interface{}{
+		"/v1/secret/data/app/db": {"user": "admin", "password": "s3cr3t", "port": 5432},
+	})
+	defer s.Close()
+	p := &Provider{Address: s.URL, Path: Fields("app/db"), Auth: Token("root")}
+
+	got, err := envsubst.EvalProvider("${user}:${password}@${host:-localhost}:${port}", p)
+	if want := "admin:s3cr3t@localhost:5432"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if s.reads != 1 {
+		t.Errorf("Want the secret read once, got %d reads", s.reads)
+	}
+
+	p = &Provider{Address: s.URL, Path: Fields("app/missing"), Auth: Token("root")}
+	for i := 0; i < 2; i++ {
+		if _, ok, err := p.Lookup("user"); ok || err != nil {
+			t.Errorf("Want missing secret undefined, got %v, %v", ok, err)
+		}
+	}
+	if s.reads != 2 {
+		t.Errorf("Want missing secret cached, got %d reads", s.reads)
+	}
+
+	p = &Provider{Address: s.URL, Path: Fields("app/db"), Auth: Token("invalid")}
+	if _, _, err := p.Lookup("user"); err == nil {
+		t.Errorf("Want error for rejected token")
+	}
+}
+
+func TestProviderTTL(t *testing.T) {
+	s := newServer(map[string]map[string]interface{}{
+		"/v1/kv/data/app": {"value": "1"},
+	})
+	defer s.Close()
+
+	p := &Provider{Address: s.URL, Mount: "kv", Path: Fields("app"), Auth: Token("root"), TTL: -1}
+	p.Lookup("value")
+	p.Lookup("value")
+	if s.reads != 2 {
+		t.Errorf("Want caching disabled, got %d reads", s.reads)
+	}
+
+	s.reads, s.lease = 0, 1
+	p = &Provider{Address: s.URL, Mount: "kv", Path: Fields("app"), Auth: Token("root"), TTL: time.Hour}
+	p.Lookup("value")
+	p.Lookup("value")
+	time.Sleep(1100 * time.Millisecond)
+	if v, ok, err := p.Lookup("value"); v != "1" || !ok || err != nil {
+		t.Errorf("Want value, got %q, %v, %v", v, ok, err)
+	}
+	if s.reads != 2 {
+		t.Errorf("Want secret cached for its lease, got %d reads", s.reads)
+	}
+}
+
+func TestAppRole(t *testing.T) {
+	s := newServer(map[string]map[string]interface{}{
+		"/v1/secret/data/app/db_password": {"value": "s3cr3t"},
+		"/v1/secret/data/app/db_user":     {"value": "admin"},
+	})
+	defer s.Close()
+	p := &Provider{
+		Address: s.URL,
+		Path:    MustPathTemplate("app/${key,,}"),
+		Auth:    AppRole{RoleID: "role", SecretID: "secret"},
+	}
+	if v, ok, err := p.Lookup("DB_PASSWORD"); v != "s3cr3t" || !ok || err != nil {
+		t.Errorf("Want value, got %q, %v, %v", v, ok, err)
+	}
+
+	// a revoked token is replaced by logging in again.
+	s.tokens["approle"] = false
+	if v, ok, err := p.Lookup("DB_USER"); v != "admin" || !ok || err != nil {
+		t.Errorf("Want value, got %q, %v, %v", v, ok, err)
+	}
+	if s.logins != 2 {
+		t.Errorf("Want 2 logins, got %d", s.logins)
+	}
+
+	p.Auth = AppRole{RoleID: "role", SecretID: "wrong"}
+	p.token = ""
+	if _, _, err := p.Lookup("OTHER"); err == nil {
+		t.Errorf("Want login error")
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl, key   string
+		path, field string
+	}{
+		{"app/${key}", "db", "app/db", "value"},
+		{"app/${key,,}#password", "DB", "app/db", "password"},
+		{"app/${key%%_*}#${key#*_}", "DB_PASSWORD", "app/DB", "PASSWORD"},
+	}
+	for _, test := range tests {
+		fn, err := PathTemplate(test.tmpl)
+		if err != nil {
+			t.Errorf("Want no error for %q, got %v", test.tmpl, err)
+			continue
+		}
+		path, field := fn(test.key)
+		if path != test.path || field != test.field {
+			t.Errorf("Want %q, %q for %q, got %q, %q", test.path, test.field, test.tmpl, path, field)
+		}
+	}
+	if _, err := PathTemplate("app/${key"); err == nil {
+		t.Errorf("Want error for invalid template")
+	}
+
+	defer func() {
+		msg, _ := recover().(string)
+		if want := "vault: PathTemplate(\"app/${key`\"): "; !strings.HasPrefix(msg, want) {
+			t.Errorf("Want MustPathTemplate to panic with %s..., got %q", want, msg)
+		}
+	}()
+	MustPathTemplate("app/${key`")
+}
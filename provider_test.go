@@ -0,0 +1,248 @@
+package envsubst
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChain(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	p := Chain(
+		mapProvider{"a": "first", "empty": ""},
+		ProviderFunc(func(key string) (string, bool, error) {
+			if key == "bad" {
+				return "", false, errLookup
+			}
+			return "", false, nil
+		}),
+		mapProvider{"a": "second", "b": "second", "empty": "second"},
+	)
+
+	var tests = []struct {
+		key   string
+		value string
+		ok    bool
+		err   error
+	}{
+		{"a", "first", true, nil},
+		{"b", "second", true, nil},
+		{"empty", "", true, nil},
+		{"c", "", false, nil},
+		{"bad", "", false, errLookup},
+	}
+	for _, test := range tests {
+		v, ok, err := p.Lookup(test.key)
+		if v != test.value || ok != test.ok || err != test.err {
+			t.Errorf("Want %s resolved to %q, %v, %v, got %q, %v, %v", test.key, test.value, test.ok, test.err, v, ok, err)
+		}
+	}
+
+	if got, want := p.(KeyLister).Keys(), []string{"a", "b", "empty"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+	if got, err := EvalProvider("${a}-${b}-${c:-none}", p); err != nil || got != "first-second-none" {
+		t.Errorf("Want chained evaluation, got %q, %v", got, err)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	defaults := map[string]string{"REGION": "eu-west-1", "LOG_LEVEL": "info", "EMPTY": "default"}
+	p := WithDefaults(mapProvider{"LOG_LEVEL": "debug", "EMPTY": ""}, defaults)
+	defaults["REGION"] = "changed"
+
+	got, err := EvalProvider("${REGION} ${LOG_LEVEL} [${EMPTY}] ${OTHER:-none}", p)
+	if want := "eu-west-1 debug [] none"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if got, want := p.(KeyLister).Keys(), []string{"EMPTY", "LOG_LEVEL", "REGION"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+}
+
+func TestFileVars(t *testing.T) {
+	f, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("s3cr3t\n")
+	f.Close()
+
+	p := FileVars(mapProvider{
+		"PASSWORD_FILE": f.Name(),
+		"USER":          "admin",
+		"USER_FILE":     "/does/not/matter",
+		"TOKEN_FILE":    f.Name() + ".missing",
+	})
+	var tests = []struct {
+		key   string
+		value string
+		ok    bool
+		err   bool
+	}{
+		{"PASSWORD", "s3cr3t", true, false},
+		{"USER", "admin", true, false},
+		{"OTHER", "", false, false},
+		{"TOKEN", "", false, true},
+	}
+	for _, test := range tests {
+		v, ok, err := p.Lookup(test.key)
+		if v != test.value || ok != test.ok || (err != nil) != test.err {
+			t.Errorf("Want %s resolved to %q, %v, got %q, %v, %v", test.key, test.value, test.ok, v, ok, err)
+		}
+	}
+	want := []string{"PASSWORD", "PASSWORD_FILE", "TOKEN", "TOKEN_FILE", "USER", "USER_FILE"}
+	if got := p.(KeyLister).Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	p := Router([]Route{
+		{Prefix: "SECRET_", Provider: mapProvider{"TOKEN": "vault", "SECRET_TOKEN": "unstripped"}, Strip: true},
+		{Prefix: "CFG_", Provider: mapProvider{"CFG_PORT": "8080"}},
+		{Prefix: "CFG_DB_", Provider: mapProvider{"CFG_DB_HOST": "db"}},
+	}, mapProvider{"HOME": "/root", "CFG_DB_HOST": "fallback"})
+
+	var tests = []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"SECRET_TOKEN", "vault", true},
+		{"CFG_PORT", "8080", true},
+		{"CFG_DB_HOST", "db", true},
+		{"CFG_OTHER", "", false},
+		{"HOME", "/root", true},
+		{"OTHER", "", false},
+	}
+	for _, test := range tests {
+		v, ok, err := p.Lookup(test.key)
+		if v != test.value || ok != test.ok || err != nil {
+			t.Errorf("Want %s resolved to %q, %v, got %q, %v, %v", test.key, test.value, test.ok, v, ok, err)
+		}
+	}
+	if _, ok, _ := Router(nil, nil).Lookup("HOME"); ok {
+		t.Errorf("Want undefined variable without fallback")
+	}
+}
+
+func TestPrefixEnv(t *testing.T) {
+	os.Setenv("ENVSUBST_TEST_PORT", "8080")
+	os.Setenv("ENVSUBST_OTHER", "hidden")
+	defer os.Unsetenv("ENVSUBST_TEST_PORT")
+	defer os.Unsetenv("ENVSUBST_OTHER")
+
+	var tests = []struct {
+		strip bool
+		key   string
+		value string
+		ok    bool
+	}{
+		{false, "ENVSUBST_TEST_PORT", "8080", true},
+		{false, "ENVSUBST_OTHER", "", false},
+		{false, "PORT", "", false},
+		{true, "PORT", "8080", true},
+		{true, "ENVSUBST_TEST_PORT", "", false},
+	}
+	for _, test := range tests {
+		p := PrefixEnv("ENVSUBST_TEST_", test.strip)
+		v, ok, err := p.Lookup(test.key)
+		if v != test.value || ok != test.ok || err != nil {
+			t.Errorf("Want %s resolved to %q, %v, got %q, %v, %v", test.key, test.value, test.ok, v, ok, err)
+		}
+	}
+	if got, want := PrefixEnv("ENVSUBST_TEST_", true).(KeyLister).Keys(), []string{"PORT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	p := Normalize(mapProvider{"MY_SERVICE_PORT": "8080"})
+	for _, key := range []string{"my.service.port", "my-service-port", " My_Service.Port ", "MY_SERVICE_PORT"} {
+		if v, ok, err := p.Lookup(key); v != "8080" || !ok || err != nil {
+			t.Errorf("Want %q resolved, got %q, %v, %v", key, v, ok, err)
+		}
+	}
+	got, err := EvalProvider("port=${my.service.port}", p, DottedNames())
+	if want := "port=8080"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	p = Normalize(mapProvider{"MY_SERVICE_PORT": "8080", "my-service-host": "db"})
+	if got, want := p.(KeyLister).Keys(), []string{"MY_SERVICE_HOST", "MY_SERVICE_PORT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Want keys %v, got %v", want, got)
+	}
+	_, err = EvalProvider("${MY_SERVICE_PROT}", p, NoUnset())
+	var merr *MissingVarError
+	if !errors.As(err, &merr) || !reflect.DeepEqual(merr.Refs[0].Suggestions, []string{"MY_SERVICE_PORT"}) {
+		t.Errorf("Want MY_SERVICE_PORT suggested, got %v", err)
+	}
+}
+
+func TestPathNames(t *testing.T) {
+	p := mapProvider{"/app/prod/db_password": "hunter2", "/app/prod/db-host": "db"}
+	input := "${/app/prod/db-host}:${/app/prod/db_password} ${/app/prod/port:-5432}"
+	want := "db:hunter2 5432"
+	got, err := EvalProvider(input, p, PathNames())
+	if err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	var b bytes.Buffer
+	if _, _, err := EvalCopy(&b, iotest.OneByteReader(strings.NewReader(input)), func(key string) string { return p[key] }, PathNames()); err != nil || b.String() != want {
+		t.Errorf("Want %q streamed, got %q, %v", want, b.String(), err)
+	}
+	if _, err := EvalProvider(input, p); err == nil {
+		t.Errorf("Want path names rejected without the option")
+	}
+}
+
+func TestSnapshotEnv(t *testing.T) {
+	os.Setenv("ENVSUBST_SNAPSHOT", "before")
+	defer os.Unsetenv("ENVSUBST_SNAPSHOT")
+	defer os.Unsetenv("ENVSUBST_SNAPSHOT_NEW")
+
+	p := SnapshotEnv()
+	os.Setenv("ENVSUBST_SNAPSHOT", "after")
+	os.Setenv("ENVSUBST_SNAPSHOT_NEW", "new")
+
+	got, err := EvalProvider("${ENVSUBST_SNAPSHOT} ${ENVSUBST_SNAPSHOT_NEW:-unset}", p)
+	if want := "before unset"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	keys := p.(KeyLister).Keys()
+	if i := sort.SearchStrings(keys, "ENVSUBST_SNAPSHOT"); i == len(keys) || keys[i] != "ENVSUBST_SNAPSHOT" {
+		t.Errorf("Want snapshot keys to include ENVSUBST_SNAPSHOT, got %v", keys)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	values := map[string]string{"Path": "a", "path": "b", "HOME": "c", "home": "d"}
+	var tests = []struct {
+		provider Provider
+		key      string
+		value    string
+		ok       bool
+	}{
+		{CaseInsensitive(mapProvider(values)), "PATH", "a", true},
+		{CaseInsensitive(mapProvider(values)), "path", "b", true},
+		{CaseInsensitive(mapProvider(values)), "Home", "c", true},
+		{CaseInsensitive(mapProvider(values)), "other", "", false},
+		{CaseInsensitive(ProviderFunc(mapProvider(values).Lookup)), "Home", "c", true},
+		{CaseInsensitive(ProviderFunc(mapProvider(values).Lookup)), "pATH", "b", true},
+		{CaseInsensitive(ProviderFunc(mapProvider(values).Lookup)), "hoMe", "c", true},
+	}
+	for _, test := range tests {
+		v, ok, err := test.provider.Lookup(test.key)
+		if v != test.value || ok != test.ok || err != nil {
+			t.Errorf("Want %s resolved to %q, %v, got %q, %v, %v", test.key, test.value, test.ok, v, ok, err)
+		}
+	}
+}
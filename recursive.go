@@ -0,0 +1,140 @@
+package envsubst
+
+import (
+	"fmt"
+	"strings"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+type cycleError struct {
+	keys []string
+}
+
+func (e *cycleError) Error() string {
+	return fmt.Sprintf("reference cycle %s", strings.Join(e.keys, " -> "))
+}
+
+type depthError struct {
+	depth int
+	keys  []string
+}
+
+func (e *depthError) Error() string {
+	return fmt.Sprintf("recursive expansion exceeds depth %d: %s", e.depth, strings.Join(e.keys, " -> "))
+}
+
+// recursiveProvider wraps a provider to expand the ${var} references
+// in the values it returns.
+type recursiveProvider struct {
+	provider Provider
+	options  *options
+	depth    int
+
+	// variables being expanded, outermost first
+	stack []string
+}
+
+func newRecursiveProvider(p Provider, o *options, subs *int) *recursiveProvider {
+	// the values are expanded with the same options, except for the
+	// lookup hooks and recursion which are already applied by the
+	// wrapped provider and this one, and warnings whose positions
+	// would not refer to the input.
+	inner := *o
+	inner.before = nil
+	inner.after = nil
+	inner.depth = 0
+	inner.frontmatter = false
+	inner.warn = nil
+	inner.promote = nil
+	inner.promoteAll = false
+	inner.subs = subs
+	return &recursiveProvider{provider: p, options: &inner, depth: o.depth}
+}
+
+func (r *recursiveProvider) Lookup(key string) (string, bool, error) {
+	v, ok, err := r.provider.Lookup(key)
+	if err != nil || !ok || !strings.Contains(v, "${") {
+		return v, ok, err
+	}
+
+	chain := append(r.stack[:len(r.stack):len(r.stack)], key)
+	if contains(r.stack, key) {
+		return "", false, &cycleError{keys: chain}
+	}
+	if len(r.stack) == r.depth {
+		return "", false, &depthError{depth: r.depth, keys: chain}
+	}
+
+	r.stack = chain
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+	t, err := parseTemplate(v, r.options)
+	if err != nil {
+		return "", false, err
+	}
+	v, err = t.execute(r, r.options)
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// ExpandUntilStable evaluates the string repeatedly, feeding the output
+// of each pass to the next, until no ${var} references remain or a pass
+// leaves the string unchanged, for at most passes passes. References
+// that cannot be resolved are kept between passes and reported in a
+// value not found error. Note that escaped references, like $${var},
+// are unescaped by one pass and expanded by the next.
+func ExpandUntilStable(s string, p Provider, passes int, opts ...Option) (string, error) {
+	o := newOptions(append(opts[:len(opts):len(opts)], KeepUnresolved()))
+	o.subs = new(int) // counted over all passes
+	for i := 0; ; i++ {
+		t, err := parseTemplate(s, o)
+		if err != nil {
+			return s, err
+		}
+		keys := references(t.tree.Root, nil)
+		if len(keys) == 0 {
+			return s, nil
+		}
+		if i == passes {
+			return s, fmt.Errorf("expansion not stable after %d passes, unresolved %s", passes, strings.Join(keys, ", "))
+		}
+		out, err := t.execute(p, o)
+		if err != nil {
+			return s, err
+		}
+		if out == s {
+			refs := make([]VarRef, len(keys))
+			for i, key := range keys {
+				refs[i] = VarRef{Name: key, Offset: -1}
+			}
+			if l, ok := p.(KeyLister); ok {
+				suggestAll(refs, l.Keys())
+			}
+			return s, newMissingVarError(refs)
+		}
+		s = out
+	}
+}
+
+// references appends the names of the variables referenced by the node
+// to keys, skipping duplicates.
+func references(node parse.Node, keys []string) []string {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, n := range node.Nodes {
+			keys = references(n, keys)
+		}
+	case *parse.FuncNode:
+		if !contains(keys, node.Param) {
+			keys = append(keys, node.Param)
+		}
+		for _, n := range node.Args {
+			keys = references(n, keys)
+		}
+	}
+	return keys
+}
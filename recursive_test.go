@@ -0,0 +1,82 @@
+package envsubst
+
+import "testing"
+
+func TestEvalRecursive(t *testing.T) {
+	params := map[string]string{
+		"HOST":    "localhost",
+		"PORT":    "5432",
+		"ADDR":    "${HOST}:${PORT}",
+		"URL":     "postgres://${ADDR}/${DB:-app}",
+		"CYCLE_A": "${CYCLE_B}",
+		"CYCLE_B": "x${CYCLE_A}",
+		"SELF":    "${SELF}",
+	}
+
+	output, err := EvalMap("${URL}", params, Recursive(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://localhost:5432/app"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	output, err = EvalMap("${URL}", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://${ADDR}/${DB:-app}"; output != want {
+		t.Errorf("Expected output without recursion %s but got %s", want, output)
+	}
+
+	_, err = EvalMap("${URL}", params, Recursive(1))
+	if _, ok := err.(*depthError); !ok {
+		t.Errorf("Expected depth error but got %v", err)
+	}
+
+	_, err = EvalMap("${CYCLE_A}", params, Recursive(10))
+	if want := "reference cycle CYCLE_A -> CYCLE_B -> CYCLE_A"; err == nil || err.Error() != want {
+		t.Errorf("Expected error %q but got %v", want, err)
+	}
+	_, err = EvalMap("${SELF}", params, Recursive(10))
+	if _, ok := err.(*cycleError); !ok {
+		t.Errorf("Expected cycle error but got %v", err)
+	}
+}
+
+func TestExpandUntilStable(t *testing.T) {
+	params := mapProvider{
+		"HOST":  "localhost",
+		"ADDR":  "${HOST}:${PORT:-5432}",
+		"URL":   "postgres://${ADDR}",
+		"LOOP":  "${LOOP}x",
+		"TYPO":  "${HSOT}",
+		"LAYER": "${URL}",
+	}
+
+	output, err := ExpandUntilStable("${LAYER}", params, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "postgres://localhost:5432"; output != want {
+		t.Errorf("Expected output %s but got %s", want, output)
+	}
+
+	output, err = ExpandUntilStable("${TYPO} ${URL}", params, 5)
+	if !IsValueNotFoundError(err) {
+		t.Errorf("Expected valueNotFoundError but got %v", err)
+	}
+	if want := "${HSOT} postgres://localhost:5432"; output != want {
+		t.Errorf("Expected partial output %s but got %s", want, output)
+	}
+
+	_, err = ExpandUntilStable("${LAYER}", params, 2)
+	if err == nil || IsValueNotFoundError(err) {
+		t.Errorf("Expected error for too few passes but got %v", err)
+	}
+
+	_, err = ExpandUntilStable("${LOOP}", params, 5)
+	if err == nil {
+		t.Errorf("Expected error for unstable expansion")
+	}
+}
@@ -0,0 +1,68 @@
+package envsubst
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces the values of secret variables in reports and
+// error messages.
+const RedactedValue = "[REDACTED]"
+
+// addSecret records the value of the variable if it is secret.
+func (s *state) addSecret(key, value string) {
+	if value != "" && s.options.isSecret(key) && !contains(s.secrets, value) {
+		s.secrets = append(s.secrets, value)
+	}
+}
+
+// redactedError is an error whose message had secret values redacted.
+type redactedError struct {
+	err     error
+	msg     string
+	secrets []string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error wrapped by the original error, with the
+// secret values redacted in turn, so that the secrets cannot be reached
+// through the chain.
+func (e *redactedError) Unwrap() error {
+	next := errors.Unwrap(e.err)
+	if next == nil {
+		return nil
+	}
+	return redact(next, e.secrets)
+}
+
+// Is reports whether the original error matches target, so that the
+// sentinel errors such as ErrMissingVar remain recognized.
+func (e *redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// redact returns err with the secret values replaced in its message. It
+// returns err itself if the message contains no secret value.
+func redact(err error, secrets []string) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	// replace longer values first, in case one contains another.
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	msg := err.Error()
+	redacted := msg
+	for _, v := range sorted {
+		redacted = strings.Replace(redacted, v, RedactedValue, -1)
+	}
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{err: err, msg: redacted, secrets: secrets}
+}
@@ -0,0 +1,66 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	params := map[string]string{"user": "admin", "password": "hunter2", "token": "abc123"}
+	errDecode := errors.New("bad input")
+	funcs := Funcs(FuncMap{
+		"fail": func(v string) (string, error) {
+			return "", fmt.Errorf("cannot decode %q", v)
+		},
+		"wrap": func(v string) (string, error) {
+			return "", fmt.Errorf("cannot parse %q: %w", v, fmt.Errorf("value %q: %w", v, errDecode))
+		},
+	})
+
+	tmpl, err := Parse("${user}:${password^^}@${token:-none}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isToken := SecretFunc(func(key string) bool { return strings.HasSuffix(key, "token") })
+	output, report, err := tmpl.ExecuteReport(mapProvider(params), Secrets("password"), isToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "admin:HUNTER2@abc123"; output != want {
+		t.Errorf("Want output not redacted %q, got %q", want, output)
+	}
+	var values []string
+	for _, sub := range report {
+		values = append(values, sub.Value)
+	}
+	if got, want := strings.Join(values, " "), "admin [REDACTED] [REDACTED]"; got != want {
+		t.Errorf("Want report values %q, got %q", want, got)
+	}
+
+	_, err = EvalMap("${fail(password)}", params, funcs, Secrets("password"))
+	if want := `cannot decode "[REDACTED]"`; err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+
+	_, err = EvalMap("${wrap(password)}", params, funcs, Secrets("password"))
+	if !errors.Is(err, errDecode) {
+		t.Errorf("Want the redacted error to match the wrapped error, got %v", err)
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if strings.Contains(e.Error(), "hunter2") || strings.Contains(fmt.Sprintf("%+v", e), "hunter2") {
+			t.Errorf("Want the secret redacted through the chain, got %v", e)
+		}
+	}
+
+	_, err = EvalMap("${password} hunter2 ${missing}", params, Secrets("password"))
+	if !errors.Is(err, ErrMissingVar) || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Want the secret redacted from the missing variable error, got %v", err)
+	}
+
+	_, err = EvalMap("${fail(user)}", params, funcs, Secrets("password"))
+	if want := `cannot decode "admin"`; err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+}
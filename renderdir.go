@@ -0,0 +1,163 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileResult records the rendering of a single file by RenderDir.
+type FileResult struct {
+	// Path is the slash-separated path of the file, relative to the
+	// root of the source tree and to the destination directory.
+	Path string
+	// Mode is the permission bits of the file, copied from the source.
+	Mode fs.FileMode
+	// Size is the number of bytes written to the destination.
+	Size int64
+	// Substitutions is the number of substitutions performed in the
+	// file.
+	Substitutions int
+	// Copied reports whether the file was copied unchanged, being left
+	// out by the Include and Exclude options or, with SkipBinary,
+	// holding binary data.
+	Copied bool
+	// Err is the error rendering the file, if any.
+	Err error
+}
+
+// RenderDir renders every regular file of srcFS to the same path under
+// dstDir, replacing ${var} based on the mapping function, as EvalCopy
+// does. Directories are created as needed and files keep the permission
+// bits of their source. Files are rendered concurrently by a bounded
+// pool of workers, see Workers. The mapping function must be safe for
+// concurrent use.
+//
+// Only the files selected by the Include and Exclude options are
+// rendered, the others being copied unchanged, as are binary files with
+// SkipBinary.
+//
+// The results are returned in lexical order of path. If any file fails
+// to render, its partial output is removed and the error is a
+// BatchError indexed by result. Once ctx is canceled, the files not yet
+// rendered fail with the context's error.
+func RenderDir(ctx context.Context, srcFS fs.FS, dstDir string, mapping func(string) string, opts ...Option) ([]FileResult, error) {
+	var results []FileResult
+	err := fs.WalkDir(srcFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dstDir, filepath.FromSlash(path)), info.Mode().Perm()|0700)
+		}
+		if d.Type().IsRegular() {
+			results = append(results, FileResult{Path: path, Mode: info.Mode().Perm()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	opts = append(opts[:len(opts):len(opts)], Context(ctx))
+	err = renderAll(ctx, results, o.workers, func(_ int, r *FileResult) {
+		r.Err = renderFile(srcFS, filepath.Join(dstDir, filepath.FromSlash(r.Path)), r, o.renders(r.Path), o.skipBinary, mapping, opts)
+	})
+	return results, err
+}
+
+// renderAll calls render with each result and its index from a pool of
+// workers, unless ctx is canceled, and returns the errors recorded in the results as a
+// BatchError.
+func renderAll(ctx context.Context, results []FileResult, workers int, render func(i int, r *FileResult)) error {
+	if workers > len(results) {
+		workers = len(results)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := &results[i]
+				if r.Err = ctx.Err(); r.Err == nil {
+					render(i, r)
+				}
+			}
+		}()
+	}
+	for i := range results {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var batch BatchError
+	for i, r := range results {
+		if r.Err != nil {
+			batch = append(batch, &InputError{Index: i, Err: r.Err})
+		}
+	}
+	if len(batch) != 0 {
+		return batch
+	}
+	return nil
+}
+
+// renderFile renders the file r.Path of fsys to the file dst, created
+// with the permission bits r.Mode, or copies it unchanged unless render
+// is set, recording the outcome in r. With skipBinary, a file starting
+// with binary data is copied unchanged. It removes dst on failure.
+func renderFile(fsys fs.FS, dst string, r *FileResult, render, skipBinary bool, mapping func(string) string, opts []Option) error {
+	f, err := fsys.Open(r.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	src := bufio.NewReaderSize(f, sniffLen)
+	if render && skipBinary && startsBinary(src) {
+		render = false
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, r.Mode)
+	if err != nil {
+		return err
+	}
+	var n int64
+	var summary *Summary
+	if render {
+		n, summary, err = EvalCopy(out, src, mapping, opts...)
+	} else {
+		n, err = io.Copy(out, src)
+	}
+	if err == nil {
+		// the mode given to OpenFile is subject to the umask.
+		err = out.Chmod(r.Mode)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	r.Size = n
+	r.Copied = !render
+	if summary != nil {
+		r.Substitutions = summary.Substitutions
+	}
+	return nil
+}
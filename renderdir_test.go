@@ -0,0 +1,134 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderDir(t *testing.T) {
+	src := fstest.MapFS{
+		"app.conf":         {Data: []byte("name=${NAME}\n"), Mode: 0644},
+		"bin/run.sh":       {Data: []byte("#!/bin/sh\necho ${NAME}\n"), Mode: 0755},
+		"etc/deep/missing": {Data: []byte("${UNDEFINED}"), Mode: 0600},
+	}
+	dst := t.TempDir()
+	mapping := func(key string) string {
+		if key == "NAME" {
+			return "envsubst"
+		}
+		return ""
+	}
+	results, err := RenderDir(context.Background(), src, dst, mapping, NoUnset(), Workers(2))
+
+	var batch BatchError
+	if !errors.As(err, &batch) || len(batch) != 1 || batch[0].Index != 2 || !errors.Is(batch[0], ErrMissingVar) {
+		t.Fatalf("Want the missing file to fail, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Want 3 results, got %d", len(results))
+	}
+	var tests = []struct {
+		path, data string
+		mode       os.FileMode
+	}{
+		{"app.conf", "name=envsubst\n", 0644},
+		{"bin/run.sh", "#!/bin/sh\necho envsubst\n", 0755},
+	}
+	for i, test := range tests {
+		if r := results[i]; r.Path != test.path || r.Mode != test.mode || r.Size != int64(len(test.data)) || r.Err != nil {
+			t.Errorf("Want result %d for %s, got %+v", i, test.path, r)
+		}
+		name := filepath.Join(dst, filepath.FromSlash(test.path))
+		b, err := ioutil.ReadFile(name)
+		if err != nil || string(b) != test.data {
+			t.Errorf("Want %s rendered as %q, got %q, %v", test.path, test.data, b, err)
+		}
+		if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != test.mode {
+			t.Errorf("Want %s with mode %v, got %v", test.path, test.mode, fi.Mode())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "etc", "deep", "missing")); !os.IsNotExist(err) {
+		t.Errorf("Want failed file removed, got %v", err)
+	}
+}
+
+func TestRenderDirCanceled(t *testing.T) {
+	src := fstest.MapFS{
+		"a": {Data: []byte("${A}")},
+		"b": {Data: []byte("${B}")},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := RenderDir(ctx, src, t.TempDir(), func(string) string { return "" })
+	if batch, ok := err.(BatchError); !ok || len(batch) != 2 || !errors.Is(batch[1], context.Canceled) || len(results) != 2 {
+		t.Errorf("Want files canceled, got %v", err)
+	}
+}
+
+func TestRenderDirSelect(t *testing.T) {
+	src := fstest.MapFS{
+		"app.yaml":          {Data: []byte("name: ${NAME}\n")},
+		"conf/db.yaml":      {Data: []byte("${NAME}/${NAME}")},
+		"conf/logo.yaml":    {Data: []byte("\x00${NAME}")},
+		"conf/readme.txt":   {Data: []byte("${NAME}")},
+		"vendor/x.yaml":     {Data: []byte("${NAME}")},
+		"vendor/lib/y.yaml": {Data: []byte("${NAME}")},
+	}
+	dst := t.TempDir()
+	mapping := func(string) string { return "envsubst" }
+	results, err := RenderDir(context.Background(), src, dst, mapping, Include("*.yaml"), Exclude("vendor/**"), SkipBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		path   string
+		subs   int
+		copied bool
+		data   string
+	}{
+		{"app.yaml", 1, false, "name: envsubst\n"},
+		{"conf/db.yaml", 2, false, "envsubst/envsubst"},
+		{"conf/logo.yaml", 0, true, "\x00${NAME}"},
+		{"conf/readme.txt", 0, true, "${NAME}"},
+		{"vendor/lib/y.yaml", 0, true, "${NAME}"},
+		{"vendor/x.yaml", 0, true, "${NAME}"},
+	}
+	for i, test := range tests {
+		if r := results[i]; r.Path != test.path || r.Substitutions != test.subs || r.Copied != test.copied {
+			t.Errorf("Want %d substitutions and copied %v for %s, got %+v", test.subs, test.copied, test.path, r)
+		}
+		if b, _ := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(test.path))); string(b) != test.data {
+			t.Errorf("Want %q for %s, got %q", test.data, test.path, b)
+		}
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	var tests = []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.yaml", "conf/db.yaml", true},
+		{"conf/*.yaml", "conf/db.yaml", true},
+		{"conf/*.yaml", "conf/x/db.yaml", false},
+		{"conf/**/*.yaml", "conf/db.yaml", true},
+		{"conf/**/*.yaml", "conf/x/y/db.yaml", true},
+		{"vendor/**", "vendor/a/b", true},
+		{"vendor/**", "src/vendor/a", false},
+		{"**/vendor/**", "src/vendor/a", true},
+		{"**", "a/b", true},
+	}
+	for _, test := range tests {
+		if got := matchAny([]string{test.pattern}, test.name); got != test.want {
+			t.Errorf("Want %v for %q against %q, got %v", test.want, test.name, test.pattern, got)
+		}
+	}
+}
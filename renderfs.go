@@ -0,0 +1,200 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RenderFS renders every regular file of src to an in-memory file
+// system, replacing ${var} based on the mapping function as RenderDir
+// does: only the files selected by the Include and Exclude options are
+// rendered, the others being copied unchanged, and files are rendered
+// concurrently, see Workers. The returned file system holds the
+// directories of src and the files that did not fail, with their
+// permission bits and modification times.
+//
+// The results are returned in lexical order of path. If any file fails
+// to render, the error is a BatchError indexed by result. Once the
+// context given with the Context option is canceled, the files not yet
+// rendered fail with the context's error.
+func RenderFS(src fs.FS, mapping func(string) string, opts ...Option) (fs.FS, []FileResult, error) {
+	mfs := memFS{".": {mode: fs.ModeDir | 0755, dir: true}}
+	var results []FileResult
+	var infos []fs.FileInfo
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			mfs[name] = &memEntry{mode: info.Mode(), modTime: info.ModTime(), dir: true}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			results = append(results, FileResult{Path: name, Mode: info.Mode().Perm()})
+			infos = append(infos, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := newOptions(opts)
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	data := make([][]byte, len(results))
+	err = renderAll(ctx, results, o.workers, func(i int, r *FileResult) {
+		data[i], r.Err = renderBytes(src, r.Path, o.renders(r.Path), mapping, opts)
+		r.Size = int64(len(data[i]))
+	})
+	for i, r := range results {
+		if r.Err == nil {
+			mfs[r.Path] = &memEntry{data: data[i], mode: r.Mode, modTime: infos[i].ModTime()}
+		}
+	}
+	return mfs, results, err
+}
+
+// renderBytes returns the content of the file at name in fsys, rendered
+// if render is set.
+func renderBytes(fsys fs.FS, name string, render bool, mapping func(string) string, opts []Option) ([]byte, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil || !render {
+		return b, err
+	}
+	var buf bytes.Buffer
+	if _, _, err := EvalCopy(&buf, bytes.NewReader(b), mapping, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// memFS is a read-only file system held in memory, keyed by the
+// slash-separated path of each file and directory.
+type memFS map[string]*memEntry
+
+// memEntry is a file or directory of a memFS.
+type memEntry struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	dir     bool
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := &memInfo{name: path.Base(name), entry: e}
+	if e.dir {
+		return &memDir{info: info, entries: m.list(name)}, nil
+	}
+	return &memFile{info: info, Reader: bytes.NewReader(e.data)}, nil
+}
+
+// ReadFile returns a copy of the content of the named file.
+func (m memFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m[name]
+	if !ok || e.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), e.data...), nil
+}
+
+// list returns the entries of the named directory, sorted by name.
+func (m memFS) list(dir string) []fs.DirEntry {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	var entries []fs.DirEntry
+	for name, e := range m {
+		if name == "." || !strings.HasPrefix(name, prefix) || strings.Contains(name[len(prefix):], "/") {
+			continue
+		}
+		entries = append(entries, &memInfo{name: name[len(prefix):], entry: e})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// memInfo describes a memEntry, as both an fs.FileInfo and an
+// fs.DirEntry.
+type memInfo struct {
+	name  string
+	entry *memEntry
+}
+
+func (i *memInfo) Name() string               { return i.name }
+func (i *memInfo) Size() int64                { return int64(len(i.entry.data)) }
+func (i *memInfo) Mode() fs.FileMode          { return i.entry.mode }
+func (i *memInfo) ModTime() time.Time         { return i.entry.modTime }
+func (i *memInfo) IsDir() bool                { return i.entry.dir }
+func (i *memInfo) Sys() interface{}           { return nil }
+func (i *memInfo) Type() fs.FileMode          { return i.entry.mode.Type() }
+func (i *memInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// memFile is an open file of a memFS.
+type memFile struct {
+	info *memInfo
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memDir is an open directory of a memFS.
+type memDir struct {
+	info    *memInfo
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of the directory, or all the
+// remaining ones if n <= 0, as fs.ReadDirFile specifies.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,62 @@
+//go:build go1.16
+// +build go1.16
+
+package envsubst
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderFS(t *testing.T) {
+	src := fstest.MapFS{
+		"app.conf":        {Data: []byte("name=${NAME}\n"), Mode: 0644},
+		"bin/run.sh":      {Data: []byte("#!/bin/sh\necho ${NAME}\n"), Mode: 0755},
+		"static/logo.svg": {Data: []byte("<svg>${NAME}</svg>"), Mode: 0644},
+		"etc/missing.tpl": {Data: []byte("${UNDEFINED}"), Mode: 0600},
+	}
+	mapping := func(key string) string {
+		if key == "NAME" {
+			return "envsubst"
+		}
+		return ""
+	}
+	out, results, err := RenderFS(src, mapping, NoUnset(), Exclude("static/*"))
+
+	var batch BatchError
+	if !errors.As(err, &batch) || len(batch) != 1 || results[batch[0].Index].Path != "etc/missing.tpl" {
+		t.Fatalf("Want the missing file to fail, got %v", err)
+	}
+	tests := []struct {
+		path, data string
+	}{
+		{"app.conf", "name=envsubst\n"},
+		{"bin/run.sh", "#!/bin/sh\necho envsubst\n"},
+		{"static/logo.svg", "<svg>${NAME}</svg>"},
+	}
+	for _, test := range tests {
+		b, err := fs.ReadFile(out, test.path)
+		if err != nil || string(b) != test.data {
+			t.Errorf("Want %s rendered as %q, got %q, %v", test.path, test.data, b, err)
+		}
+	}
+	if _, err := fs.Stat(out, "etc/missing.tpl"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Want failed file absent, got %v", err)
+	}
+	if err := fstest.TestFS(out, "app.conf", "bin/run.sh", "static/logo.svg"); err != nil {
+		t.Error(err)
+	}
+
+	out, _, err = RenderFS(src, mapping, Include("*.conf", "bin/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.ReadFile(out, "etc/missing.tpl"); string(b) != "${UNDEFINED}" {
+		t.Errorf("Want file not included copied unchanged, got %q", b)
+	}
+	if b, _ := fs.ReadFile(out, "bin/run.sh"); string(b) != "#!/bin/sh\necho envsubst\n" {
+		t.Errorf("Want included file rendered, got %q", b)
+	}
+}
@@ -0,0 +1,90 @@
+package envsubst
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SchemeError reports a reference to a scheme that is not registered.
+type SchemeError struct {
+	Scheme string
+	Key    string
+}
+
+func (e *SchemeError) Error() string {
+	return fmt.Sprintf("%s: unknown scheme %s", e.Key, e.Scheme)
+}
+
+// Schemes returns a provider dispatching each variable named
+// scheme:reference, see the SchemeReferences option, to the provider
+// registered for the scheme, which is given the reference, e.g.
+//
+//	Schemes(map[string]Provider{
+//		"env":    Env(),
+//		"file":   Files(),
+//		"secret": NewSecretsDir("/run/secrets"),
+//	}, nil)
+//
+// resolves ${env:HOME}, ${file:/etc/hostname} and ${secret:db-password}.
+// A reference to a scheme that is not registered fails with a
+// SchemeError. Names without a scheme are resolved by fallback, or are
+// undefined if fallback is nil.
+func Schemes(schemes map[string]Provider, fallback Provider) Provider {
+	s := schemeProvider{schemes: make(map[string]Provider, len(schemes)), fallback: fallback}
+	for name, p := range schemes {
+		s.schemes[name] = p
+	}
+	return s
+}
+
+type schemeProvider struct {
+	schemes  map[string]Provider
+	fallback Provider
+}
+
+func (s schemeProvider) Lookup(key string) (string, bool, error) {
+	i := strings.IndexByte(key, ':')
+	if i < 0 {
+		if s.fallback == nil {
+			return "", false, nil
+		}
+		return s.fallback.Lookup(key)
+	}
+	p, ok := s.schemes[key[:i]]
+	if !ok {
+		return "", false, &SchemeError{Scheme: key[:i], Key: key}
+	}
+	return p.Lookup(key[i+1:])
+}
+
+// Env returns a provider resolving variables from the environment of
+// the current process.
+func Env() Provider {
+	return envProvider{}
+}
+
+// Files returns a provider resolving each variable name as the path of
+// a file whose contents, without trailing line breaks, are the value,
+// for use with Schemes as in ${file:/etc/hostname}. Variables naming
+// files that do not exist are undefined.
+func Files() Provider {
+	return filesProvider{}
+}
+
+type filesProvider struct{}
+
+func (filesProvider) Lookup(key string) (string, bool, error) {
+	if key == "" {
+		return "", false, nil
+	}
+	b, err := ioutil.ReadFile(key)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
@@ -0,0 +1,46 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hostname"), []byte("web1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "db-password"), []byte("s3cr3t"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ENVSUBST_SCHEME", "env")
+	defer os.Unsetenv("ENVSUBST_SCHEME")
+
+	p := Schemes(map[string]Provider{
+		"env":    Env(),
+		"file":   Files(),
+		"secret": NewSecretsDir(dir),
+	}, mapProvider{"plain": "fallback"})
+
+	tmpl := "${env:ENVSUBST_SCHEME} ${file:" + filepath.Join(dir, "hostname") + "} ${secret:db-password} ${plain} ${env:ENVSUBST_UNSET:-none}"
+	got, err := EvalProvider(tmpl, p, SchemeReferences())
+	if want := "env web1 s3cr3t fallback none"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	_, err = EvalProvider("${vault:db}", p, SchemeReferences())
+	var serr *SchemeError
+	if !errors.As(err, &serr) || serr.Scheme != "vault" {
+		t.Errorf("Want SchemeError for unknown scheme, got %v", err)
+	}
+	if _, ok, err := Schemes(nil, nil).Lookup("plain"); ok || err != nil {
+		t.Errorf("Want names without scheme undefined without fallback, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,93 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SecretsDir is a provider resolving each variable from the file of the
+// same name in a directory, such as a Docker or Kubernetes secrets
+// mount. Trailing line breaks are removed from the values. Variables
+// without a file are undefined. It is safe for concurrent use.
+type SecretsDir struct {
+	// Dir is the directory holding the files.
+	Dir string
+	// Name maps variable names to file names, if set, e.g. the
+	// function returned by SecretName.
+	Name func(key string) string
+	// Cache keeps the values read, including undefined variables, so
+	// that each file is read once.
+	Cache bool
+
+	mu     sync.Mutex
+	values map[string]internedValue
+}
+
+// NewSecretsDir returns a provider resolving variables from the files
+// in dir, with the default settings.
+func NewSecretsDir(dir string) *SecretsDir {
+	return &SecretsDir{Dir: dir}
+}
+
+// SecretName returns a function mapping variable names to file names,
+// converting them to lower case if lower is set and underscores to
+// dashes if dashes is set, e.g. DB_PASSWORD to db-password.
+func SecretName(lower, dashes bool) func(key string) string {
+	return func(key string) string {
+		if lower {
+			key = strings.ToLower(key)
+		}
+		if dashes {
+			key = strings.Replace(key, "_", "-", -1)
+		}
+		return key
+	}
+}
+
+// Lookup retrieves the value of the named variable from its file. Names
+// that are not plain file names, or start with a dot, are undefined.
+func (d *SecretsDir) Lookup(key string) (string, bool, error) {
+	if d.Cache {
+		d.mu.Lock()
+		v, ok := d.values[key]
+		d.mu.Unlock()
+		if ok {
+			return v.value, v.ok, nil
+		}
+	}
+	v, ok, err := d.read(key)
+	if err != nil {
+		return "", false, err
+	}
+	if d.Cache {
+		d.mu.Lock()
+		if d.values == nil {
+			d.values = make(map[string]internedValue)
+		}
+		d.values[key] = internedValue{value: v, ok: ok}
+		d.mu.Unlock()
+	}
+	return v, ok, nil
+}
+
+// read reads the value of the named variable from its file.
+func (d *SecretsDir) read(key string) (string, bool, error) {
+	name := key
+	if d.Name != nil {
+		name = d.Name(key)
+	}
+	if name == "" || name[0] == '.' || strings.ContainsAny(name, `/\`) {
+		return "", false, nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(d.Dir, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
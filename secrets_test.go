@@ -0,0 +1,60 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("DB_PASSWORD", "s3cr3t\n")
+	write("db-password", "mangled\r\n")
+	write(".hidden", "hidden")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		provider *SecretsDir
+		key      string
+		value    string
+		ok       bool
+		err      bool
+	}{
+		{NewSecretsDir(dir), "DB_PASSWORD", "s3cr3t", true, false},
+		{NewSecretsDir(dir), "MISSING", "", false, false},
+		{NewSecretsDir(dir), ".hidden", "", false, false},
+		{NewSecretsDir(dir), "../secrets", "", false, false},
+		{NewSecretsDir(dir), "sub", "", false, true},
+		{&SecretsDir{Dir: dir, Name: SecretName(true, true)}, "DB_PASSWORD", "mangled", true, false},
+	}
+	for _, test := range tests {
+		v, ok, err := test.provider.Lookup(test.key)
+		if v != test.value || ok != test.ok || (err != nil) != test.err {
+			t.Errorf("Want %s resolved to %q, %v, got %q, %v, %v", test.key, test.value, test.ok, v, ok, err)
+		}
+	}
+
+	cached := &SecretsDir{Dir: dir, Cache: true}
+	cached.Lookup("DB_PASSWORD")
+	cached.Lookup("LATER")
+	write("DB_PASSWORD", "changed")
+	write("LATER", "created")
+	if v, _, _ := cached.Lookup("DB_PASSWORD"); v != "s3cr3t" {
+		t.Errorf("Want cached value, got %q", v)
+	}
+	if _, ok, _ := cached.Lookup("LATER"); ok {
+		t.Errorf("Want cached undefined variable")
+	}
+}
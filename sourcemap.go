@@ -0,0 +1,123 @@
+package envsubst
+
+import (
+	"sort"
+	"strings"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// Segment maps a range of the output to the range of the template
+// input that produced it. Offsets are in bytes, ends being exclusive.
+type Segment struct {
+	Out, OutEnd int
+	In, InEnd   int
+
+	// Literal reports whether the segment was copied from the input
+	// byte for byte, as opposed to produced by a substitution.
+	Literal bool
+}
+
+// SourceMap maps output offsets back to template input offsets. The
+// segments are ordered and cover the output without gaps.
+type SourceMap []Segment
+
+// ExecuteSourceMap is like ExecuteProvider but also returns a mapping
+// from the output back to the template input.
+func (t *Template) ExecuteSourceMap(p Provider, opts ...Option) (string, SourceMap, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+	s := t.newState(b, p, t.options(opts))
+	s.trackSourceMap = true
+	if err := t.run(s); err != nil {
+		return "", nil, err
+	}
+	return b.String(), s.sourceMap, nil
+}
+
+// Input returns the input offset corresponding to the output offset.
+// Offsets within a substitution map to the start of its ${...}
+// expression. Offsets at or beyond the end of the output map to the
+// end of the input.
+func (m SourceMap) Input(out int) int {
+	i := sort.Search(len(m), func(i int) bool {
+		return m[i].OutEnd > out
+	})
+	if i == len(m) {
+		if i == 0 {
+			return 0
+		}
+		return m[i-1].InEnd
+	}
+	seg := m[i]
+	if !seg.Literal {
+		return seg.In
+	}
+	return seg.In + out - seg.Out
+}
+
+// InputLine returns the line of the input corresponding to the given
+// line of the output. Lines are numbered from 1.
+func (m SourceMap) InputLine(input, output string, line int) int {
+	off := 0
+	for n := 1; n < line; n++ {
+		i := strings.IndexByte(output[off:], '\n')
+		if i < 0 {
+			break
+		}
+		off += i + 1
+	}
+	in := m.Input(off)
+	if in > len(input) {
+		in = len(input)
+	}
+	return strings.Count(input[:in], "\n") + 1
+}
+
+// mapText records the segments for a text node spanning in. Escape
+// characters removed by the parser break the text into several
+// literal segments.
+func (s *state) mapText(in string, node *parse.TextNode) {
+	out := node.Value
+	pos := int(node.Pos)
+	i, j := 0, 0
+	for j < len(out) {
+		// extend the run of bytes copied verbatim.
+		start, outStart := i, j
+		for i < len(in) && j < len(out) && in[i] == out[j] {
+			i++
+			j++
+		}
+		if j > outStart {
+			s.addSegment(Segment{
+				Out:     s.written + outStart,
+				OutEnd:  s.written + j,
+				In:      pos + start,
+				InEnd:   pos + i,
+				Literal: true,
+			})
+		}
+		// skip the escape character.
+		i++
+	}
+	s.written += len(out)
+}
+
+// mapFunc records the segment for the substitution of a function node
+// by value v.
+func (s *state) mapFunc(v string, node *parse.FuncNode) {
+	s.addSegment(Segment{
+		Out:    s.written,
+		OutEnd: s.written + len(v),
+		In:     int(node.Pos),
+		InEnd:  int(node.End),
+	})
+	s.written += len(v)
+}
+
+func (s *state) addSegment(seg Segment) {
+	if seg.Out == seg.OutEnd {
+		return
+	}
+	s.sourceMap = append(s.sourceMap, seg)
+}
@@ -0,0 +1,44 @@
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExecuteSourceMap(t *testing.T) {
+	input := "a: $${x}\nb: ${b}\n${empty}c: ${c}\n"
+	params := map[string]string{"b": "one\ntwo", "c": "3", "empty": ""}
+
+	tmpl, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, m, err := tmpl.ExecuteSourceMap(mapProvider(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a: ${x}\nb: one\ntwo\nc: 3\n"; output != want {
+		t.Fatalf("Want template executed to %q, got %q", want, output)
+	}
+
+	want := SourceMap{
+		{Out: 0, OutEnd: 4, In: 0, InEnd: 4, Literal: true},
+		{Out: 4, OutEnd: 11, In: 5, InEnd: 12, Literal: true},
+		{Out: 11, OutEnd: 18, In: 12, InEnd: 16},
+		{Out: 18, OutEnd: 19, In: 16, InEnd: 17, Literal: true},
+		{Out: 19, OutEnd: 22, In: 25, InEnd: 28, Literal: true},
+		{Out: 22, OutEnd: 23, In: 28, InEnd: 32},
+		{Out: 23, OutEnd: 24, In: 32, InEnd: 33, Literal: true},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Want source map %+v, got %+v", want, m)
+	}
+
+	// output line 3 ("two") was produced by ${b} on input line 2.
+	lines := []int{1, 2, 2, 3, 4}
+	for i, want := range lines {
+		if got := m.InputLine(input, output, i+1); got != want {
+			t.Errorf("Want output line %d mapped to input line %d, got %d", i+1, want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package envsubst
+
+import "sync"
+
+// Store is a mutable set of variables that is safe for concurrent use.
+// It implements Provider, and its Get method may be used as a mapping
+// function, so variables can be updated between executions.
+type Store struct {
+	mu   sync.RWMutex
+	vars map[string]string
+}
+
+// NewStore returns a store holding a copy of the variables in m.
+func NewStore(m map[string]string) *Store {
+	s := &Store{vars: make(map[string]string, len(m))}
+	for k, v := range m {
+		s.vars[k] = v
+	}
+	return s
+}
+
+// Get returns the value of the named variable, or the empty string if it
+// is not set.
+func (s *Store) Get(key string) string {
+	v, _, _ := s.Lookup(key)
+	return v
+}
+
+// Lookup retrieves the value of the named variable. The boolean reports
+// whether the variable is set.
+func (s *Store) Lookup(key string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.vars[key]
+	return v, ok, nil
+}
+
+// Set sets the value of the named variable.
+func (s *Store) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vars == nil {
+		s.vars = make(map[string]string)
+	}
+	s.vars[key] = value
+}
+
+// Unset removes the named variable.
+func (s *Store) Unset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.vars, key)
+}
+
+// Keys returns the names of the variables in the store, sorted.
+func (s *Store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedKeys(s.vars)
+}
+
+// Snapshot returns a copy of the variables in the store.
+func (s *Store) Snapshot() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[string]string, len(s.vars))
+	for k, v := range s.vars {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,62 @@
+package envsubst
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(map[string]string{"name": "world"})
+	s.Set("greeting", "hello")
+	s.Set("empty", "")
+
+	got, err := EvalProvider("${greeting} ${name}${empty=!}", s)
+	if want := "hello world"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	s.Unset("empty")
+	got, err = EvalProvider("${greeting} ${name}${empty=!}", s)
+	if want := "hello world!"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	got, err = Eval("${greeting}", s.Get)
+	if want := "hello"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	snap := s.Snapshot()
+	s.Set("name", "gopher")
+	if want := map[string]string{"greeting": "hello", "name": "world"}; !reflect.DeepEqual(snap, want) {
+		t.Errorf("Want snapshot %v, got %v", want, snap)
+	}
+
+	var zero Store
+	zero.Set("key", "value")
+	if v := zero.Get("key"); v != "value" {
+		t.Errorf("Want zero Store usable, got %q", v)
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	s := NewStore(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Set("key", "value")
+			s.Unset("key")
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := EvalProvider("${key}", s); err != nil {
+				t.Error(err)
+			}
+			s.Snapshot()
+		}()
+	}
+	wg.Wait()
+}
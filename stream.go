@@ -0,0 +1,473 @@
+package envsubst
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// chunkSize is the size of the reads performed by the streaming
+// functions.
+const chunkSize = 32 << 10
+
+// errClosed is returned when writing to a closed writer.
+var errClosed = errors.New("envsubst: write to closed writer")
+
+// streamer expands a stream of input in segments, each holding no
+// partial ${...} expression or escape, so that they can be expanded
+// independently.
+type streamer struct {
+	provider Provider
+	options  *options
+
+	// input not yet expanded, and the offset of its start in the
+	// stream
+	pending []byte
+	offset  int
+
+	// number of lines before the pending input, and the text preceding
+	// it on its line, to report positions from the start of the stream
+	lines int
+	head  []byte
+
+	// substitutions performed, if tracked
+	summary *Summary
+
+	progress progressTracker
+}
+
+func newStreamer(p Provider, o *options) *streamer {
+	// substitutions are counted over the whole stream
+	o.subs = new(int)
+	s := &streamer{provider: p, options: o, progress: progressTracker{options: o}}
+	if fn := o.warn; fn != nil {
+		o.warn = func(w Warning) {
+			s.locateWarning(&w)
+			fn(w)
+		}
+	}
+	return s
+}
+
+// expand expands the longest complete prefix of the pending input, or
+// all of it if final is set, and returns the output.
+func (s *streamer) expand(final bool) (string, error) {
+	if s.options.stripBOM {
+		if !final && len(s.pending) < len(bom) && strings.HasPrefix(bom, string(s.pending)) {
+			return "", nil // wait for the rest of the mark
+		}
+		if strings.HasPrefix(string(s.pending), bom) {
+			s.pending = s.pending[:copy(s.pending, s.pending[len(bom):])]
+			s.offset += len(bom)
+		}
+		// only at the start of the stream
+		s.options.stripBOM = false
+	}
+	if s.options.modeline {
+		if !final && bytes.IndexByte(s.pending, '\n') < 0 {
+			return "", nil // wait for the rest of the first line
+		}
+		if err := applyModeline(string(s.pending), s.options); err != nil {
+			return "", err
+		}
+	}
+	if s.options.frontmatter {
+		if wait, err := s.frontmatter(final); wait || err != nil {
+			return "", err
+		}
+	}
+	n := len(s.pending)
+	if !final {
+		var line int
+		n, line = split(s.pending)
+		if s.options.mode&parse.ParseDirectives != 0 {
+			// directives are recognized on whole lines.
+			n = line
+		}
+	}
+	if n == 0 {
+		if final {
+			s.progress.add(0, 0, true)
+		}
+		return "", nil
+	}
+	t, err := parseTemplate(string(s.pending[:n]), s.options)
+	if err != nil {
+		return "", s.locate(err)
+	}
+	s.options.disabled = t.tree.Disabled
+	var b strings.Builder
+	state := t.newState(&b, s.provider, s.options)
+	state.trackReport = s.summary != nil
+	if err := t.run(state); err != nil {
+		return "", s.locate(err)
+	}
+	if s.summary != nil {
+		s.summary.add(state.report)
+	}
+	s.advance(n)
+	s.progress.add(n, b.Len(), final)
+	return b.String(), nil
+}
+
+// frontmatter parses the frontmatter block at the start of the stream
+// once it is complete, applying its declarations as templates do. It
+// reports whether to wait for more input.
+func (s *streamer) frontmatter(final bool) (bool, error) {
+	if !final {
+		n := frontmatterLen(string(s.pending))
+		if bytes.IndexByte(s.pending, '\n') < 0 || n < 0 || n > 0 && s.pending[n-1] != '\n' {
+			return true, nil // wait for the rest of the block
+		}
+	}
+	s.options.frontmatter = false
+	vars, n, err := parseFrontmatter(string(s.pending))
+	if err != nil {
+		return false, s.locate(err)
+	}
+	p := declare(s.provider, vars)
+	if s.options.noUnset && len(vars) != 0 {
+		if err := checkDeclared(p, s.provider, vars); err != nil {
+			return false, err
+		}
+	}
+	s.provider = p
+	s.advance(n)
+	return false, nil
+}
+
+// advance drops the first n bytes of the pending input, once they are
+// expanded.
+func (s *streamer) advance(n int) {
+	p := s.pending[:n]
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		s.lines += bytes.Count(p, []byte{'\n'})
+		s.head = append(s.head[:0], p[i+1:]...)
+	} else {
+		s.head = append(s.head, p...)
+	}
+	s.pending = s.pending[:copy(s.pending, s.pending[n:])]
+	s.offset += n
+}
+
+// position makes a position in the pending input relative to the start
+// of the stream.
+func (s *streamer) position(offset, line, col *int) {
+	if *line == 1 {
+		*col += utf8.RuneCount(s.head)
+	}
+	*offset += s.offset
+	*line += s.lines
+}
+
+// locate makes the positions reported by err, returned for the pending
+// input, relative to the start of the stream.
+func (s *streamer) locate(err error) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		if perr.Line == 1 {
+			perr.line = string(s.head) + perr.line
+		}
+		s.position(&perr.Offset, &perr.Line, &perr.Column)
+	}
+	var merr *MissingVarError
+	if errors.As(err, &merr) {
+		for i := range merr.Refs {
+			if ref := &merr.Refs[i]; ref.Offset >= 0 {
+				s.position(&ref.Offset, &ref.Line, &ref.Column)
+			}
+		}
+	}
+	var werr *WarningError
+	if errors.As(err, &werr) {
+		s.locateWarning(&werr.Warning)
+	}
+	var lerr *LimitError
+	if errors.As(err, &lerr) {
+		lerr.Pos += parse.Pos(s.offset)
+	}
+	var uerr *parse.UnterminatedError
+	if errors.As(err, &uerr) {
+		uerr.Pos += parse.Pos(s.offset)
+	}
+	var serr *parse.SyntaxError
+	if errors.As(err, &serr) {
+		serr.Pos += parse.Pos(s.offset)
+	}
+	return err
+}
+
+// locateWarning makes the position of a warning for the pending input
+// relative to the start of the stream.
+func (s *streamer) locateWarning(w *Warning) {
+	end := w.End + s.offset
+	s.position(&w.Pos, &w.Line, &w.Column)
+	w.End = end
+}
+
+// room returns the number of bytes of input that can be added to the
+// pending input, at most chunkSize. It returns a LimitError if the
+// pending input reached the MaxBuffer limit, which happens when an
+// expression is longer than the limit.
+func (s *streamer) room() (int, error) {
+	max := s.options.maxBuffer
+	if max <= 0 || max-len(s.pending) >= chunkSize {
+		return chunkSize, nil
+	}
+	if len(s.pending) >= max {
+		return 0, &LimitError{Limit: "buffer", Max: max, Pos: parse.Pos(s.offset)}
+	}
+	return max - len(s.pending), nil
+}
+
+// States of the expressions open while splitting, following the
+// grammar of the parser: the } of a replace pattern is literal, as in
+// ${a/}/-}, and the pattern and replacement have escapes.
+const (
+	splitStart   = iota // the start of the parameter name
+	splitName           // the rest of the parameter name
+	splitPattern        // the pattern of ${name/pattern/string}
+	splitString         // the string of ${name/pattern/string}
+	splitOperand        // any other operand, up to the closing }
+)
+
+// split returns the length of the longest prefix of p that can be
+// expanded independently of the data that follows it: a prefix that
+// ends outside of any ${...} expression, and not within an escape or
+// on a $ that could start one. It also returns the length of the
+// longest such prefix ending with a line break, for the Directives
+// option.
+func split(p []byte) (safe, line int) {
+	var open []int // states of the open expressions
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c == '$' || c == '\\') && i+1 == len(p) {
+			break
+		}
+		state := splitOperand
+		if len(open) != 0 {
+			state = open[len(open)-1]
+		}
+		if state == splitStart {
+			// a name starting with a slash is a path, see PathNames
+			state = splitName
+			if c == '/' {
+				state = splitOperand
+			}
+			open[len(open)-1] = state
+		}
+		escapes := len(open) == 0 || state == splitPattern || state == splitString
+		switch {
+		case c == '$' && p[i+1] == '{':
+			open = append(open, splitStart)
+			i++
+		case c == '$' && p[i+1] == '$' && escapes:
+			i++ // escaped
+		case c == '\\' && (p[i+1] == '\\' || p[i+1] == '/'):
+			i++ // escaped
+		case state == splitName && c == '/':
+			// the operator is one of /, //, /# and /%
+			if i+1 == len(p) {
+				return safe, line
+			}
+			if c := p[i+1]; c == '/' || c == '#' || c == '%' {
+				i++
+			}
+			open[len(open)-1] = splitPattern
+		case state == splitPattern && c == '/':
+			open[len(open)-1] = splitString
+		case state == splitPattern:
+			// a } is part of the pattern
+		case c == '}' && len(open) != 0:
+			open = open[:len(open)-1]
+		case c == '$':
+			// keep the $ with the character that follows
+			continue
+		case state == splitName && !isNameByte(c, false) && c != '.' && c < utf8.RuneSelf:
+			open[len(open)-1] = splitOperand
+		}
+		if len(open) == 0 {
+			safe = i + 1
+			if c == '\n' {
+				line = i + 1
+			}
+		}
+	}
+	return safe, line
+}
+
+// reader expands the data read from r.
+type reader struct {
+	r   io.Reader
+	s   *streamer
+	out string // expanded output not yet returned
+	err error  // error to return once out is consumed
+}
+
+// NewReader returns a reader that replaces ${var} in the data read from
+// r based on the mapping function, as the data is read. References may
+// straddle the reads from r. Only the data following the last complete
+// expression is buffered, up to the limit set by MaxBuffer.
+func NewReader(r io.Reader, mapping func(string) string, opts ...Option) io.Reader {
+	return &reader{r: r, s: newStreamer(funcProvider(mapping), newOptions(opts))}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for r.out == "" && r.err == nil {
+		r.fill()
+	}
+	if r.out != "" {
+		n := copy(p, r.out)
+		r.out = r.out[n:]
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// fill reads the next chunk of input and expands it.
+func (r *reader) fill() {
+	s := r.s
+	if err := s.options.canceled(); err != nil {
+		r.err = err
+		return
+	}
+	room, err := s.room()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if cap(s.pending)-len(s.pending) < room {
+		size := 2*cap(s.pending) + chunkSize
+		if max := s.options.maxBuffer; max > 0 && size > max {
+			size = max
+		}
+		buf := make([]byte, len(s.pending), size)
+		copy(buf, s.pending)
+		s.pending = buf
+	}
+	n, err := r.r.Read(s.pending[len(s.pending) : len(s.pending)+room])
+	s.pending = s.pending[:len(s.pending)+n]
+	if err != nil && err != io.EOF {
+		r.err = err
+		return
+	}
+	out, xerr := s.expand(err == io.EOF)
+	r.out = out
+	switch {
+	case xerr != nil:
+		r.err = xerr
+	case err == io.EOF:
+		r.err = io.EOF
+	}
+}
+
+// writer expands the data written to it into w.
+type writer struct {
+	w   io.Writer
+	s   *streamer
+	err error // sticky error
+}
+
+// NewWriter returns a writer that replaces ${var} in the data written
+// to it based on the mapping function, and writes the result to w.
+// References may straddle writes: only the data following the last
+// complete expression is buffered, up to the limit set by MaxBuffer.
+// Close must be called to expand and
+// write the buffered data; it does not close w.
+func NewWriter(w io.Writer, mapping func(string) string, opts ...Option) io.WriteCloser {
+	return &writer{w: w, s: newStreamer(funcProvider(mapping), newOptions(opts))}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var n int
+	for n < len(p) {
+		if err := w.s.options.canceled(); err != nil {
+			w.err = err
+			return n, err
+		}
+		room, err := w.s.room()
+		if err != nil {
+			w.err = err
+			return n, err
+		}
+		if room > len(p)-n {
+			room = len(p) - n
+		}
+		w.s.pending = append(w.s.pending, p[n:n+room]...)
+		if err := w.flush(false); err != nil {
+			return n, err
+		}
+		n += room
+	}
+	return n, nil
+}
+
+// Close expands the buffered data and writes it to the underlying
+// writer.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+// flush expands the complete part of the buffered data, or all of it if
+// final is set, and writes the output.
+func (w *writer) flush(final bool) error {
+	if err := w.s.options.canceled(); err != nil {
+		w.err = err
+		return err
+	}
+	out, err := w.s.expand(final)
+	if err == nil && out != "" {
+		_, err = io.WriteString(w.w, out)
+	}
+	w.err = err
+	return err
+}
+
+// Summary summarizes the substitutions performed by EvalCopy.
+type Summary struct {
+	// Substitutions is the number of substitutions performed.
+	Substitutions int
+	// Variables lists the distinct variables substituted, in order of
+	// first use.
+	Variables []string
+	// Undefined lists the distinct variables substituted that were not
+	// defined, in order of first use.
+	Undefined []string
+}
+
+func (s *Summary) add(report []Substitution) {
+	for _, sub := range report {
+		s.Substitutions++
+		if !contains(s.Variables, sub.Name) {
+			s.Variables = append(s.Variables, sub.Name)
+		}
+		if !sub.Defined && !contains(s.Undefined, sub.Name) {
+			s.Undefined = append(s.Undefined, sub.Name)
+		}
+	}
+}
+
+// EvalCopy copies src to dst, replacing ${var} based on the mapping
+// function as the data is copied, like NewReader. It returns the number
+// of bytes written to dst and a summary of the substitutions performed,
+// together with the first error encountered.
+func EvalCopy(dst io.Writer, src io.Reader, mapping func(string) string, opts ...Option) (int64, *Summary, error) {
+	s := newStreamer(funcProvider(mapping), newOptions(opts))
+	s.summary = new(Summary)
+	n, err := io.Copy(dst, &reader{r: src, s: s})
+	return n, s.summary, err
+}
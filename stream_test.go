@@ -0,0 +1,354 @@
+package envsubst
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSplit(t *testing.T) {
+	var tests = []struct {
+		input string
+		n     int
+	}{
+		{"abc", 3},
+		{"abc$", 3},
+		{"abc$$", 5},
+		{"abc\\", 3},
+		{"abc\\\\", 5},
+		{"a${b", 1},
+		{"a${b}", 5},
+		{"a${b:-${c}}d", 12},
+		{"a${b:-${c}", 1},
+		{"a$b", 3},
+		{"a$", 1},
+		{"$", 0},
+		{"${a/}/-}b", 9},
+		{"${a/}", 0},
+		{"${a//\\}/x}b", 11},
+		{"${a/\\/}/x}b", 11},
+		{"${a/#}/${b}}c", 13},
+		{"${a/", 0},
+		{"${a:-/}b", 8},
+		{"${/a/}b", 7},
+		{"${/a/", 0},
+	}
+	for _, test := range tests {
+		if n, _ := split([]byte(test.input)); n != test.n {
+			t.Errorf("Want split of %q at %d, got %d", test.input, test.n, n)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	var tests = []struct {
+		input string
+		line  int
+	}{
+		{"a\nb", 2},
+		{"a\n${b:-\nc", 2},
+		{"a\n${b:-\nc}\nd", 11},
+		{"${b:-\n", 0},
+	}
+	for _, test := range tests {
+		if _, line := split([]byte(test.input)); line != test.line {
+			t.Errorf("Want line split of %q at %d, got %d", test.input, test.line, line)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"name": "gopher", "greeting": "hello"}[s]
+	}
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		b.WriteString("${greeting} ${name:-x} $$ \\\\ ${missing:-${name}}\n")
+	}
+	input := b.String()
+	want, err := Eval(input, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, r := range map[string]io.Reader{
+		"bulk":     NewReader(strings.NewReader(input), mapping),
+		"one byte": NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping),
+		"half":     iotest.HalfReader(NewReader(iotest.DataErrReader(strings.NewReader(input)), mapping)),
+	} {
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: Want output of %d bytes matching Eval, got %d bytes", name, len(want), len(got))
+		}
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	mapping := func(string) string { return "" }
+	r := NewReader(strings.NewReader("ok ${a} ${b"), mapping)
+	got, err := ioutil.ReadAll(r)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("Want ParseError for unterminated input, got %v", err)
+	}
+	if !bytes.Equal(got, []byte("ok  ")) {
+		t.Errorf("Want output up to the error, got %q", got)
+	}
+
+	r = NewReader(iotest.TimeoutReader(strings.NewReader("${a}")), mapping)
+	if _, err := ioutil.ReadAll(r); err != iotest.ErrTimeout {
+		t.Errorf("Want read error passed through, got %v", err)
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"name": "gopher"}[s]
+	}
+	input := "hello ${name}, $$ ${missing:-${name}}!$"
+	want, _ := Eval(input, mapping)
+
+	for _, size := range []int{1, 2, 3, 7, len(input)} {
+		var b bytes.Buffer
+		w := NewWriter(&b, mapping)
+		for i := 0; i < len(input); i += size {
+			end := i + size
+			if end > len(input) {
+				end = len(input)
+			}
+			if _, err := io.WriteString(w, input[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != want {
+			t.Errorf("Want %q written in chunks of %d, got %q", want, size, b.String())
+		}
+		if _, err := w.Write([]byte("x")); err == nil {
+			t.Errorf("Want error writing to closed writer")
+		}
+	}
+
+	var b bytes.Buffer
+	w := NewWriter(&b, mapping, NoUnset())
+	if _, err := io.WriteString(w, "${name} ${missing}"); !IsValueNotFoundError(err) {
+		t.Errorf("Want value not found error, got %v", err)
+	}
+	if err := w.Close(); !IsValueNotFoundError(err) {
+		t.Errorf("Want sticky error on Close, got %v", err)
+	}
+}
+
+func TestStreamReplaceBrace(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"a": "a}b", "b": "x}y"}[s]
+	}
+	input := "${a/}/-} ${b//\\}/x} ${a/#a}/z}"
+	want, err := Eval(input, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != "a-b x}y zb" {
+		t.Fatalf("Want the } of the patterns literal, got %q", want)
+	}
+	for _, size := range []int{1, 2, 3, 5} {
+		var b bytes.Buffer
+		w := NewWriter(&b, mapping)
+		for i := 0; i < len(input); i += size {
+			end := i + size
+			if end > len(input) {
+				end = len(input)
+			}
+			if _, err := io.WriteString(w, input[i:end]); err != nil {
+				t.Fatalf("Writing chunks of %d: %v", size, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Writing chunks of %d: %v", size, err)
+		}
+		if b.String() != want {
+			t.Errorf("Want %q written in chunks of %d, got %q", want, size, b.String())
+		}
+	}
+	got, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(input)), mapping))
+	if err != nil || string(got) != want {
+		t.Errorf("Want %q read one byte at a time, got %q, %v", want, got, err)
+	}
+}
+
+func TestStreamPositions(t *testing.T) {
+	mapping := func(string) string { return "" }
+	read := func(s string, opts ...Option) error {
+		_, err := ioutil.ReadAll(NewReader(iotest.OneByteReader(strings.NewReader(s)), mapping, opts...))
+		return err
+	}
+
+	input := "a\nb ${x} ${x:=}\n\u00e9\u00e9 ${y}"
+	var want, got []Warning
+	if _, err := Eval(input, mapping, Warnings(func(w Warning) { want = append(want, w) })); err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 4 || want[3].Line != 3 || want[3].Column != 4 {
+		t.Fatalf("Want 4 warnings ending at 3:4, got %v", want)
+	}
+	if err := read(input, Warnings(func(w Warning) { got = append(got, w) })); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want warnings %v read one byte at a time, got %v", want, got)
+	}
+	var werr *WarningError
+	if err := read(input, WarningsAsErrors()); !errors.As(err, &werr) || werr.Warning != want[0] {
+		t.Errorf("Want warning %v as an error, got %v", want[0], err)
+	}
+
+	input = "a\nb ${x}\n\u00e9\u00e9 ${y} ${bad"
+	_, err := Eval(input, mapping)
+	wantErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Want a ParseError, got %v", err)
+	}
+	err = read(input)
+	gotErr, ok := err.(*ParseError)
+	if !ok || gotErr.Offset != wantErr.Offset || gotErr.Line != wantErr.Line || gotErr.Column != wantErr.Column || gotErr.Excerpt() != wantErr.Excerpt() {
+		t.Errorf("Want error %v\n%s\nread one byte at a time, got %v", wantErr, wantErr.Excerpt(), err)
+	}
+}
+
+func TestEvalCopy(t *testing.T) {
+	mapping := func(s string) string {
+		return map[string]string{"name": "gopher", "greeting": "hello"}[s]
+	}
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		b.WriteString("${greeting} ${name}${missing}\n")
+	}
+	var dst bytes.Buffer
+	n, summary, err := EvalCopy(&dst, strings.NewReader(b.String()), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(dst.Len()) || dst.Len() != 1000*len("hello gopher\n") {
+		t.Errorf("Want %d bytes written, got %d", dst.Len(), n)
+	}
+	if summary.Substitutions != 3000 {
+		t.Errorf("Want 3000 substitutions, got %d", summary.Substitutions)
+	}
+	if want := []string{"greeting", "name", "missing"}; !reflect.DeepEqual(summary.Variables, want) {
+		t.Errorf("Want variables %q, got %q", want, summary.Variables)
+	}
+	if want := []string{"missing"}; !reflect.DeepEqual(summary.Undefined, want) {
+		t.Errorf("Want undefined %q, got %q", want, summary.Undefined)
+	}
+}
+
+func TestMaxBuffer(t *testing.T) {
+	mapping := func(s string) string { return "v" }
+	input := strings.Repeat("a ${x} ", 10000) + "${x:-" + strings.Repeat("d", 100) + "} end"
+	want, _ := Eval(input, mapping)
+
+	for _, max := range []int{0, 110, chunkSize + 1} {
+		got, err := ioutil.ReadAll(NewReader(strings.NewReader(input), mapping, MaxBuffer(max)))
+		if err != nil || string(got) != want {
+			t.Errorf("Want input read within buffer of %d, got %v", max, err)
+		}
+		var b bytes.Buffer
+		w := NewWriter(&b, mapping, MaxBuffer(max))
+		if _, err := io.WriteString(w, input); err != nil {
+			t.Errorf("Want input written within buffer of %d, got %v", max, err)
+		}
+		if err := w.Close(); err != nil || b.String() != want {
+			t.Errorf("Want input written within buffer of %d, got %v", max, err)
+		}
+	}
+
+	_, err := ioutil.ReadAll(NewReader(strings.NewReader(input), mapping, MaxBuffer(100)))
+	if err, ok := err.(*LimitError); !ok || err.Limit != "buffer" || int(err.Pos) != 70000 {
+		t.Errorf("Want buffer LimitError at 70000, got %v", err)
+	}
+	w := NewWriter(ioutil.Discard, mapping, MaxBuffer(100))
+	if _, err := io.WriteString(w, input); err == nil {
+		t.Errorf("Want buffer LimitError writing")
+	}
+	_, err = ioutil.ReadAll(NewReader(strings.NewReader("${"+strings.Repeat("x", 2<<20)), mapping))
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("Want default limit for unterminated ${, got %v", err)
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+	mapping := func(s string) string { return "v" }
+	input := strings.Repeat("${x}\n", 100000)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := NewReader(strings.NewReader(input), mapping, Context(ctx))
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(r); err != context.Canceled {
+		t.Errorf("Want reader canceled, got %v", err)
+	}
+
+	w := NewWriter(ioutil.Discard, mapping, Context(ctx))
+	if _, err := io.WriteString(w, input); err != context.Canceled {
+		t.Errorf("Want writer canceled, got %v", err)
+	}
+	if _, _, err := EvalCopy(ioutil.Discard, strings.NewReader(input), mapping, Context(ctx)); err != context.Canceled {
+		t.Errorf("Want copy canceled, got %v", err)
+	}
+	err := EvalLines(strings.NewReader(input), mapping, func(int, string, string) error { return nil }, Context(ctx))
+	if err != context.Canceled {
+		t.Errorf("Want lines canceled, got %v", err)
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	mapping := func(s string) string { return "value" }
+	input := strings.Repeat("${x}\n", 50000)
+	var reports []Progress
+	collect := ReportProgress(func(p Progress) {
+		reports = append(reports, p)
+	})
+
+	check := func(name string) {
+		if len(reports) < 2 {
+			t.Errorf("%s: Want periodic progress, got %d reports", name, len(reports))
+			return
+		}
+		last := reports[len(reports)-1]
+		want := Progress{BytesIn: int64(len(input)), BytesOut: 50000 * 6, Substitutions: 50000, Done: true}
+		if last != want {
+			t.Errorf("%s: Want final progress %+v, got %+v", name, want, last)
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].BytesIn < reports[i-1].BytesIn || reports[i-1].Done {
+				t.Errorf("%s: Want increasing progress, got %+v", name, reports)
+				break
+			}
+		}
+		reports = nil
+	}
+
+	if _, _, err := EvalCopy(ioutil.Discard, strings.NewReader(input), mapping, collect); err != nil {
+		t.Fatal(err)
+	}
+	check("EvalCopy")
+	w := NewWriter(ioutil.Discard, mapping, collect)
+	io.WriteString(w, input)
+	w.Close()
+	check("NewWriter")
+	EvalLines(strings.NewReader(input), mapping, func(int, string, string) error { return nil }, collect)
+	check("EvalLines")
+}
@@ -0,0 +1,145 @@
+package envsubst
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ExpandStruct replaces ${var} in the exported string fields of the
+// struct pointed to by v based on the mapping function. Nested structs,
+// pointers, interfaces, slices, arrays and map values are expanded
+// recursively. Fields tagged with `envsubst:"-"` are skipped.
+//
+// Map keys are left unchanged unless the ExpandKeys option is given.
+func ExpandStruct(v interface{}, mapping func(string) string, opts ...Option) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("envsubst: ExpandStruct requires a non-nil pointer")
+	}
+	return newStructExpander(mapping, newOptions(opts)).expand(rv)
+}
+
+// structExpander walks a value using reflection, expanding every
+// settable string it reaches.
+type structExpander struct {
+	mapping func(string) string
+	options *options
+
+	// pointers already visited, to guard against cycles.
+	seen map[uintptr]bool
+}
+
+func newStructExpander(mapping func(string) string, o *options) *structExpander {
+	return &structExpander{
+		mapping: mapping,
+		options: o,
+		seen:    make(map[uintptr]bool),
+	}
+}
+
+func (e *structExpander) expand(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		s, err := evalWith(v.String(), funcProvider(e.mapping), e.options)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Ptr:
+		if v.IsNil() || e.seen[v.Pointer()] {
+			return nil
+		}
+		e.seen[v.Pointer()] = true
+		return e.expand(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+		c := copyValue(v.Elem())
+		if err := e.expand(c); err != nil {
+			return err
+		}
+		v.Set(c)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue // unexported
+			}
+			if f.Tag.Get("envsubst") == "-" {
+				continue
+			}
+			if err := e.expand(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.expand(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return e.expandMap(v)
+	}
+	return nil
+}
+
+func (e *structExpander) expandMap(v reflect.Value) error {
+	if v.IsNil() {
+		return nil
+	}
+	keys := v.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	renamed := make(map[string]reflect.Value)
+	for _, k := range keys {
+		c := copyValue(v.MapIndex(k))
+		if err := e.expand(c); err != nil {
+			return err
+		}
+		if !e.options.keys || k.Kind() != reflect.String {
+			v.SetMapIndex(k, c)
+			continue
+		}
+		nk, err := evalWith(k.String(), funcProvider(e.mapping), e.options)
+		if err != nil {
+			return err
+		}
+		if nk == k.String() {
+			v.SetMapIndex(k, c)
+			continue
+		}
+		renamed[nk] = c
+		v.SetMapIndex(k, reflect.Value{})
+	}
+	names := make([]string, 0, len(renamed))
+	for nk := range renamed {
+		names = append(names, nk)
+	}
+	sort.Strings(names)
+	for _, nk := range names {
+		c := renamed[nk]
+		k := reflect.New(v.Type().Key()).Elem()
+		k.SetString(nk)
+		if v.MapIndex(k).IsValid() {
+			return fmt.Errorf("expanded key %s collides with an existing key", nk)
+		}
+		v.SetMapIndex(k, c)
+	}
+	return nil
+}
+
+// copyValue returns a settable copy of v.
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
@@ -0,0 +1,66 @@
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandStruct(t *testing.T) {
+	type database struct {
+		Host     string
+		Port     int
+		Password string `envsubst:"-"`
+	}
+	type config struct {
+		Name     string
+		Primary  database
+		Replicas []*database
+		Labels   map[string]string
+		Extra    interface{}
+		Tags     [2]string
+		ignored  string
+	}
+	params := map[string]string{"HOST": "localhost", "ENV": "prod"}
+	mapping := func(s string) string {
+		return params[s]
+	}
+
+	c := &config{
+		Name:     "app-${ENV}",
+		Primary:  database{Host: "${HOST}", Port: 5432, Password: "${HOST}"},
+		Replicas: []*database{{Host: "replica.${HOST}"}, nil},
+		Labels:   map[string]string{"${ENV}": "${ENV}"},
+		Extra:    "${ENV}",
+		Tags:     [2]string{"${ENV}", "static"},
+		ignored:  "${ENV}",
+	}
+	c.Replicas[1] = c.Replicas[0] // shared pointers are expanded once
+
+	if err := ExpandStruct(c, mapping); err != nil {
+		t.Fatal(err)
+	}
+	want := &config{
+		Name:     "app-prod",
+		Primary:  database{Host: "localhost", Port: 5432, Password: "${HOST}"},
+		Replicas: []*database{{Host: "replica.localhost"}, nil},
+		Labels:   map[string]string{"${ENV}": "prod"},
+		Extra:    "prod",
+		Tags:     [2]string{"prod", "static"},
+		ignored:  "${ENV}",
+	}
+	want.Replicas[1] = want.Replicas[0]
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Want struct expanded to %+v, got %+v", want, c)
+	}
+
+	if err := ExpandStruct(c, mapping, ExpandKeys()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Labels["prod"] != "prod" {
+		t.Errorf("Expect map keys expanded with ExpandKeys, got %v", c.Labels)
+	}
+
+	if err := ExpandStruct(*c, mapping); err == nil {
+		t.Errorf("Expect error when passing a non-pointer")
+	}
+}
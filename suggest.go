@@ -0,0 +1,82 @@
+package envsubst
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxEdits bounds the distance of suggestions for long names.
+const maxEdits = 3
+
+// suggestAll sets the suggestions of the references from the keys.
+func suggestAll(refs []VarRef, keys []string) {
+	for i := range refs {
+		refs[i].Suggestions = suggest(refs[i].Name, keys)
+	}
+}
+
+// suggest returns the keys closest to the name, differing only by case
+// or by a few edits relative to the length of the name, at most
+// maxEdits.
+func suggest(name string, keys []string) []string {
+	max := len([]rune(name)) / 3
+	if max > maxEdits {
+		max = maxEdits
+	}
+	best := max + 1
+	var matches []string
+	for _, key := range keys {
+		d := distance(name, key)
+		if strings.EqualFold(name, key) {
+			d = 0
+		}
+		switch {
+		case key == name || d > max || d > best:
+			continue
+		case d < best:
+			best = d
+			matches = matches[:0]
+		}
+		matches = append(matches, key)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// distance returns the optimal string alignment distance between a and
+// b: the number of insertions, deletions, substitutions and adjacent
+// transpositions of characters needed to turn a into b.
+func distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,46 @@
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	keys := []string{"DB_HOST", "DB_PORT", "DB_USER", "HOME", "db_host"}
+	var tests = []struct {
+		name string
+		want []string
+	}{
+		{"DB_HSOT", []string{"DB_HOST"}},
+		{"DB_HOTS", []string{"DB_HOST"}},
+		{"Db_Host", []string{"DB_HOST", "db_host"}},
+		{"DB_PROT", []string{"DB_PORT"}},
+		{"HOM", []string{"HOME"}},
+		{"HO", nil},
+		{"PATH", nil},
+		{"DB_HOST_NAME_PRIMARY", nil},
+		{"DB_HOST", []string{"db_host"}},
+	}
+	for _, test := range tests {
+		if got := suggest(test.name, keys); !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want suggestions %q for %s, got %q", test.want, test.name, got)
+		}
+	}
+}
+
+func TestSuggestError(t *testing.T) {
+	params := map[string]string{"DB_HOST": "db", "DB_PORT": "5432"}
+	_, err := EvalMap("${DB_HSOT}", params)
+	want := "input/default value not found for key DB_HSOT at line 1, column 1 near `${DB_HSOT}`; did you mean DB_HOST?"
+	if err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+
+	store := NewStore(params)
+	_, err = EvalProvider("${DB_HSOT} ${DB_PROT} ${OTHER}", store, NoUnset())
+	want = "input/default value not found for keys DB_HSOT (line 1, column 1; did you mean DB_HOST?), " +
+		"DB_PROT (line 1, column 12; did you mean DB_PORT?), OTHER (line 1, column 23)"
+	if err == nil || err.Error() != want {
+		t.Errorf("Want error %q, got %v", want, err)
+	}
+}
@@ -1,31 +1,25 @@
 package envsubst
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
 
 	"gomodules.xyz/envsubst/parse"
 )
 
-type valueNotFoundError struct {
-	key string
-}
-
-var _ error = &valueNotFoundError{}
-
-func (e *valueNotFoundError) Error() string {
-	return fmt.Sprintf("input/default value not found for key %s", e.key)
-}
+// bom is the UTF-8 encoding of the byte order mark.
+const bom = "\ufeff"
 
-func IsValueNotFoundError(v interface{}) bool {
-	switch v.(type) {
-	case *valueNotFoundError:
-		return true
-	}
-	return false
-}
+// LimitError is returned when a template exceeds one of the limits set
+// by the MaxDepth, MaxExpressions, MaxOperandLength or MaxSubstitutions
+// options.
+type LimitError = parse.LimitError
 
 // state represents the state of template execution. It is not part of the
 // template so that multiple executions can run in parallel.
@@ -33,43 +27,183 @@ type state struct {
 	template *Template
 	writer   io.Writer
 	node     parse.Node // current node
+	options  *options
 
 	// maps variable names to values with additional behaviours
 	// returns value, args and error
 	mapper func(node string, key string, args []string) (string, []string, error)
+
+	// resolves variable names when no mapper is set
+	provider Provider
+	// provider given to the execution, before any wrapping
+	lister Provider
+
+	// first references to undefined variables without a default value
+	missing []VarRef
+	// first references to variables substituted by an empty value
+	empty []VarRef
+
+	// defined variables used during execution, if tracked
+	trackResolved bool
+	resolved      []string
+
+	// substitutions performed during execution, if tracked
+	trackReport bool
+	report      []Substitution
+
+	// output to input mapping, if tracked
+	trackSourceMap bool
+	sourceMap      SourceMap
+	written        int // bytes written to the output
+
+	depth int  // nesting level of function arguments
+	subs  *int // substitutions performed, shared with nested executions
+
+	// values of secret variables, redacted from errors
+	secrets []string
+
+	// scans the output for references, if set
+	unexpanded *unexpandedWriter
+
+	// receives the output as a sequence of events, if set.
+	// Execution stops when it returns false.
+	emit func(Event) bool
 }
 
 // Template is the representation of a parsed shell format string.
 type Template struct {
 	tree *parse.Tree
+	text string
+
+	// trimming functions of the function nodes with a constant
+	// pattern, compiled at parse time.
+	trims map[*parse.FuncNode]trim
+
+	// variables declared by the frontmatter of the template.
+	vars []VarDecl
+
+	// options given to Parse, applied before those given to
+	// each execution.
+	opts []Option
 }
 
 // Parse creates a new shell format template and parses the template
-// definition from string s.
-func Parse(s string) (t *Template, err error) {
+// definition from string s. The options are retained and apply to
+// every execution of the template.
+func Parse(s string, opts ...Option) (t *Template, err error) {
+	t, err = parseTemplate(s, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	t.opts = opts
+	return t, nil
+}
+
+// parseTemplate parses the template definition from string s with
+// the given options.
+func parseTemplate(s string, o *options) (t *Template, err error) {
+	if o.stripBOM {
+		s = strings.TrimPrefix(s, bom)
+	}
+	if o.skipBinary {
+		s = escapeBinary(s)
+	}
 	t = new(Template)
-	t.tree, err = parse.Parse(s)
+	t.text = s
+	tree := parse.New()
+	tree.Mode = o.mode
+	tree.Limits = o.limits
+	tree.Disabled = o.disabled
+	if o.frontmatter {
+		t.vars, tree.Offset, err = parseFrontmatter(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.tree, err = tree.Parse(s)
+	if err == parse.ErrBadSubstitution {
+		return nil, newParseError(s, int(tree.Pos()), err)
+	}
+	switch perr := err.(type) {
+	case *parse.UnterminatedError:
+		return nil, newParseError(s, int(perr.Pos), err)
+	case *parse.SyntaxError:
+		return nil, newParseError(s, int(perr.Pos), err)
+	}
 	if err != nil {
 		return nil, err
 	}
+	t.compile(t.tree.Root)
 	return t, nil
 }
 
+// Release returns the parse tree of the template to pools, from which
+// later calls to Parse allocate, reducing the garbage of workloads that
+// parse many short-lived templates. The template must not be used after.
+func (t *Template) Release() {
+	t.tree.Release()
+	t.tree = nil
+	t.trims = nil
+}
+
+// trim is a trimming function compiled for its pattern argument.
+type trim struct {
+	arg string
+	fn  func(string) string
+}
+
+// compile compiles the constant patterns of the trimming functions in
+// the node.
+func (t *Template) compile(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, n := range node.Nodes {
+			t.compile(n)
+		}
+	case *parse.FuncNode:
+		if len(node.Args) != 0 {
+			if arg, ok := node.Args[0].(*parse.TextNode); ok {
+				if fn := compileTrim(node.Name, arg.Value); fn != nil {
+					if t.trims == nil {
+						t.trims = make(map[*parse.FuncNode]trim)
+					}
+					t.trims[node] = trim{arg: arg.Value, fn: fn}
+				}
+			}
+		}
+		for _, n := range node.Args {
+			t.compile(n)
+		}
+	}
+}
+
+// apply applies the string function of the function node to value v,
+// with the pattern compiled at parse time if the arguments match it.
+func (t *Template) apply(node *parse.FuncNode, v string, args []string) string {
+	if tr, ok := t.trims[node]; ok && len(args) != 0 && args[0] == tr.arg {
+		return tr.fn(v)
+	}
+	return lookupFunc(node.Name, len(args))(v, args...)
+}
+
 // ParseFile creates a new shell format template and parses the template
 // definition from the named file.
-func ParseFile(path string) (*Template, error) {
+func ParseFile(path string, opts ...Option) (*Template, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return Parse(string(b))
+	return Parse(string(b), opts...)
 }
 
 // Execute applies a parsed template to the specified data mapping.
 func (t *Template) Execute(mapping func(node string, key string, args []string) (string, []string, error)) (str string, err error) {
-	b := new(bytes.Buffer)
+	b := getBuffer()
+	defer putBuffer(b)
 	s := new(state)
+	s.template = t
 	s.node = t.tree.Root
+	s.options = newOptions(t.opts)
 	s.mapper = mapping
 	s.writer = b
 	err = t.eval(s)
@@ -79,6 +213,206 @@ func (t *Template) Execute(mapping func(node string, key string, args []string)
 	return b.String(), nil
 }
 
+// ExecuteProvider applies a parsed template, resolving variables with
+// the provider. The options are applied after those given to Parse.
+func (t *Template) ExecuteProvider(p Provider, opts ...Option) (string, error) {
+	return t.execute(p, t.options(opts))
+}
+
+// ExecuteResolved is like ExecuteProvider but also returns the names of
+// the variables that were defined by the provider and used during
+// execution, in order of first use. Variables only referenced by
+// default values that were not needed are not included.
+func (t *Template) ExecuteResolved(p Provider, opts ...Option) (string, []string, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+	s := t.newState(b, p, t.options(opts))
+	s.trackResolved = true
+	if err := t.run(s); err != nil {
+		return "", nil, err
+	}
+	return b.String(), s.resolved, nil
+}
+
+// Substitution records a substitution performed during execution.
+type Substitution struct {
+	// Name is the name of the variable.
+	Name string
+	// Op is the substitution function, such as ":-" or "//". It is
+	// empty for a plain ${var} reference.
+	Op string
+	// Value is the substituted value, after applying the function.
+	Value string
+	// Defined reports whether the provider defined the variable.
+	Defined bool
+	// Pos and End are the byte offsets of the ${...} expression in
+	// the template input, End being exclusive.
+	Pos, End int
+}
+
+// ExecuteReport is like ExecuteProvider but also returns a record of
+// every substitution performed, ordered by position in the input.
+// Substitutions nested in the arguments of a function are recorded
+// after the enclosing function. References
+// left verbatim by an UnresolvedPolicy are not recorded.
+func (t *Template) ExecuteReport(p Provider, opts ...Option) (string, []Substitution, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+	s := t.newState(b, p, t.options(opts))
+	s.trackReport = true
+	if err := t.run(s); err != nil {
+		return "", nil, err
+	}
+	sortSubstitutions(s.report)
+	return b.String(), s.report, nil
+}
+
+// DryRun walks the template resolving variables as ExecuteReport does,
+// but discards the output. It returns the substitutions that would be
+// performed together with any error, so that the report is available
+// even when execution fails, e.g. for undefined variables.
+func (t *Template) DryRun(p Provider, opts ...Option) ([]Substitution, error) {
+	s := t.newState(ioutil.Discard, p, t.options(opts))
+	s.trackReport = true
+	err := t.run(s)
+	sortSubstitutions(s.report)
+	return s.report, err
+}
+
+// ExecuteWriter is like ExecuteProvider but writes the output to w
+// instead of returning it, through a buffer taken from a pool so that
+// large outputs are not held in memory. On error, part of the output may
+// already have been written.
+func (t *Template) ExecuteWriter(w io.Writer, p Provider, opts ...Option) error {
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+	if err := t.run(t.newState(bw, p, t.options(opts))); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writerPool holds the buffers used by ExecuteWriter.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriter(nil)
+	},
+}
+
+// bufferPool holds the output buffers of the functions returning the
+// output as a string, which is copied out of the buffer.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBuffer is the largest buffer returned to bufferPool, so that
+// a few large outputs do not keep their memory alive.
+const maxPooledBuffer = 64 << 10
+
+// getBuffer returns an empty buffer from bufferPool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns the buffer to bufferPool.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// options returns the template options followed by opts.
+func (t *Template) options(opts []Option) *options {
+	return newOptions(append(t.opts[:len(t.opts):len(t.opts)], opts...))
+}
+
+// execute applies a parsed template, resolving variables with the
+// provider according to the options.
+func (t *Template) execute(p Provider, o *options) (string, error) {
+	b := getBuffer()
+	defer putBuffer(b)
+	if err := t.run(t.newState(b, p, o)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// newState returns the state for an execution writing to w.
+func (t *Template) newState(w io.Writer, p Provider, o *options) *state {
+	s := new(state)
+	s.template = t
+	s.node = t.tree.Root
+	s.options = o
+	s.provider = declare(p, t.vars)
+	s.lister = p
+	s.writer = w
+	if len(o.before) != 0 || len(o.after) != 0 {
+		s.provider = &hookProvider{provider: s.provider, before: o.before, after: o.after}
+	}
+	s.subs = o.subs
+	if s.subs == nil {
+		s.subs = new(int)
+	}
+	if o.depth > 0 {
+		s.provider = newRecursiveProvider(s.provider, o, s.subs)
+	}
+	if o.intern {
+		s.provider = &internProvider{provider: s.provider, values: make(map[string]internedValue)}
+	}
+	if o.noUnexpanded {
+		s.unexpanded = &unexpandedWriter{w: w}
+		s.writer = s.unexpanded
+	}
+	return s
+}
+
+// run executes the template from the state's root node and reports
+// any undefined or empty variables collected along the way. The values
+// of secret variables are redacted from any error returned.
+func (t *Template) run(s *state) error {
+	return redact(t.runState(s), s.secrets)
+}
+
+// runState executes the template as run does, without redacting the
+// error.
+func (t *Template) runState(s *state) error {
+	if s.options.noUnset && len(t.vars) != 0 {
+		if err := checkDeclared(s.provider, s.lister, t.vars); err != nil {
+			return err
+		}
+	}
+	if err := t.eval(s); err != nil {
+		return err
+	}
+	if len(s.missing) != 0 {
+		sortRefs(s.missing)
+		if l, ok := s.lister.(KeyLister); ok {
+			suggestAll(s.missing, l.Keys())
+		}
+		return newMissingVarError(s.missing)
+	}
+	if len(s.empty) != 0 {
+		sortRefs(s.empty)
+		keys := make([]string, len(s.empty))
+		for i, ref := range s.empty {
+			keys[i] = ref.Name
+		}
+		return &valueEmptyError{keys: keys}
+	}
+	if s.unexpanded != nil && len(s.unexpanded.refs) != 0 {
+		return &UnexpandedError{Refs: s.unexpanded.refs}
+	}
+	return nil
+}
+
 func (t *Template) eval(s *state) (err error) {
 	switch node := s.node.(type) {
 	case *parse.TextNode:
@@ -92,6 +426,19 @@ func (t *Template) eval(s *state) (err error) {
 }
 
 func (t *Template) evalText(s *state, node *parse.TextNode) error {
+	if s.options.warns() {
+		if err := s.warnText(node); err != nil {
+			return err
+		}
+	}
+	if s.depth == 0 {
+		if s.trackSourceMap {
+			s.mapText(t.text[node.Pos:node.End], node)
+		}
+		if s.emit != nil && node.Value != "" && !s.emit(Event{Text: node.Value}) {
+			return errStopped
+		}
+	}
 	_, err := io.WriteString(s.writer, node.Value)
 	return err
 }
@@ -108,16 +455,83 @@ func (t *Template) evalList(s *state, node *parse.ListNode) (err error) {
 }
 
 func (t *Template) evalFunc(s *state, node *parse.FuncNode) error {
+	var r result
+	var err error
+	if s.subs != nil {
+		*s.subs++
+		if max := s.options.maxSubs; max > 0 && *s.subs > max {
+			return &LimitError{Limit: "substitution", Max: max, Pos: node.Pos}
+		}
+	}
+	if node.Name == ":=" && s.options.warns() {
+		err = s.warn(WarnDeprecated, node.Param, int(node.Pos), int(node.End), "${%s:=...} is deprecated, it does not assign %s, use ${%s:-...}", node.Param, node.Param, node.Param)
+		if err != nil {
+			return err
+		}
+	}
+	if s.mapper != nil {
+		r, err = t.evalMapper(s, node)
+	} else {
+		r, err = t.evalProvider(s, node)
+	}
+	if err != nil {
+		return err
+	}
+	s.addSecret(node.Param, r.value)
+	if !r.kept {
+		if r.value == "" && s.options.noEmpty {
+			s.empty = addRef(s.empty, s.template.text, node)
+		}
+		if r.value == "" && s.options.warns() && !s.isMissing(node.Param) {
+			err = s.warn(WarnEmptyValue, node.Param, int(node.Pos), int(node.End), "substituted value empty for key %s", node.Param)
+			if err != nil {
+				return err
+			}
+		}
+		if s.trackReport {
+			s.report = append(s.report, s.substitution(node, r))
+		}
+	}
+	if s.depth == 0 {
+		if s.trackSourceMap {
+			s.mapFunc(r.value, node)
+		}
+		if s.emit != nil {
+			ev := Event{Text: r.value}
+			if !r.kept {
+				sub := s.substitution(node, r)
+				ev.Substitution = &sub
+			}
+			if !s.emit(ev) {
+				return errStopped
+			}
+		}
+	}
+	_, err = io.WriteString(s.writer, r.value)
+	return err
+}
+
+// result is the outcome of resolving a function node.
+type result struct {
+	value   string
+	defined bool // the variable was defined
+	kept    bool // the reference was left verbatim
+}
+
+// evalArgs evaluates the arguments of the function node.
+func (t *Template) evalArgs(s *state, node *parse.FuncNode) ([]string, error) {
 	var w = s.writer
-	var buf bytes.Buffer
+	var buf = getBuffer()
+	defer putBuffer(buf)
 	var args []string
+	s.depth++
 	for _, n := range node.Args {
 		buf.Reset()
-		s.writer = &buf
+		s.writer = buf
 		s.node = n
 		err := t.eval(s)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		args = append(args, buf.String())
 	}
@@ -125,16 +539,137 @@ func (t *Template) evalFunc(s *state, node *parse.FuncNode) error {
 	// restore the origin writer
 	s.writer = w
 	s.node = node
+	s.depth--
+	return args, nil
+}
+
+// evalMapper resolves the function node with the mapper given to
+// Execute.
+func (t *Template) evalMapper(s *state, node *parse.FuncNode) (result, error) {
+	args, err := t.evalArgs(s, node)
+	if err != nil {
+		return result{}, err
+	}
 
 	v, args, err := s.mapper(node.Name, node.Param, args)
 	if err != nil {
-		return err
+		return result{}, err
+	}
+	v, err = s.call(node, v)
+	if err != nil {
+		return result{}, err
 	}
 
-	fn := lookupFunc(node.Name, len(args))
+	return result{value: t.apply(node, v, args), defined: true}, nil
+}
 
-	_, err = io.WriteString(s.writer, fn(v, args...))
-	return err
+// evalProvider resolves the function node with the state's provider.
+// As in bash, the default value is used when the variable is undefined
+// or, for the colon forms, empty, and it is only evaluated when used, as
+// is the message of ${var:?message}.
+func (t *Template) evalProvider(s *state, node *parse.FuncNode) (result, error) {
+	v, ok, err := s.provider.Lookup(node.Param)
+	if err != nil {
+		return result{}, err
+	}
+	if ok {
+		s.addSecret(node.Param, v)
+	}
+	if ok && s.trackResolved && !contains(s.resolved, node.Param) {
+		s.resolved = append(s.resolved, node.Param)
+	}
+
+	if node.Name == ":?" {
+		if !ok || v == "" {
+			args, err := t.evalArgs(s, node)
+			if err != nil {
+				return result{}, err
+			}
+			return result{}, &RequiredVarError{Name: node.Param, Message: toDefault("", args...)}
+		}
+		return result{value: v, defined: true}, nil
+	}
+
+	if isDefault(node.Name) {
+		if !ok || (v == "" && isColon(node.Name) && !s.options.keepEmpty) {
+			args, err := t.evalArgs(s, node)
+			if err != nil {
+				return result{}, err
+			}
+			v = toDefault("", args...)
+		}
+		return result{value: v, defined: ok}, nil
+	}
+
+	if !ok {
+		switch s.options.policy(node.Param) {
+		case PolicyError:
+			s.addMissing(node)
+		case PolicyKeep:
+			return result{value: t.text[node.Pos:node.End], kept: true}, nil
+		}
+	}
+
+	v, err = s.call(node, v)
+	if err != nil {
+		return result{}, err
+	}
+
+	args, err := t.evalArgs(s, node)
+	if err != nil {
+		return result{}, err
+	}
+	return result{value: t.apply(node, v, args), defined: ok}, nil
+}
+
+// addMissing records the reference of the function node to an
+// undefined variable.
+func (s *state) addMissing(node *parse.FuncNode) {
+	s.missing = addRef(s.missing, s.template.text, node)
+}
+
+// isMissing reports whether the variable is recorded as undefined.
+func (s *state) isMissing(key string) bool {
+	for _, ref := range s.missing {
+		if ref.Name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// call applies the registered functions called by the function node
+// to value v.
+func (s *state) call(node *parse.FuncNode, v string) (string, error) {
+	for _, name := range node.Funcs {
+		fn, ok := s.options.funcs[name]
+		if !ok {
+			return "", fmt.Errorf("function %s not defined", name)
+		}
+		var err error
+		v, err = fn(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	return v, nil
+}
+
+// substitution returns the record of the substitution of the function
+// node, with the value redacted if the variable is secret.
+func (s *state) substitution(node *parse.FuncNode, r result) Substitution {
+	sub := Substitution{
+		Name:    node.Param,
+		Op:      node.Name,
+		Value:   r.value,
+		Defined: r.defined,
+		Pos:     int(node.Pos),
+		End:     int(node.End),
+	}
+	if s.options.isSecret(node.Param) {
+		sub.Value = RedactedValue
+	}
+	return sub
 }
 
 // lookupFunc returns the parameters substitution function by name. If the
@@ -170,11 +705,22 @@ func lookupFunc(name string, args int) substituteFunc {
 		return replaceFirst
 	case "//":
 		return replaceAll
-	case "=", ":=", ":-":
+	case "=", ":=", ":-", ":?":
 		return toDefault
-	case ":?", ":+", "-", "+":
+	case ":+", "-", "+":
 		return toDefault
 	default:
 		return toDefault
 	}
 }
+
+// sortSubstitutions sorts the substitutions by position in the input,
+// enclosing functions before the substitutions nested in them.
+func sortSubstitutions(subs []Substitution) {
+	sort.SliceStable(subs, func(i, j int) bool {
+		if subs[i].Pos != subs[j].Pos {
+			return subs[i].Pos < subs[j].Pos
+		}
+		return subs[i].End > subs[j].End
+	})
+}
@@ -0,0 +1,219 @@
+package envsubst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvalTOML replaces ${var} in a TOML document, resolving variables with
+// the provider, escaping the substituted values for the string they land
+// in so that the document stays valid:
+//
+//   - in basic strings, quotes, backslashes and control characters are
+//     escaped.
+//   - in multi-line basic strings, line breaks are kept and quotes,
+//     backslashes and other control characters escaped.
+//   - literal strings cannot hold escapes, so a value containing a
+//     single quote, a line break or a control character is an error, as
+//     is a value containing three single quotes in a multi-line literal
+//     string.
+//   - in comments, line breaks continue the comment.
+//
+// Values substituted outside strings, such as port = ${PORT}, are
+// inserted as is.
+func EvalTOML(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	o := newOptions(opts)
+	var b strings.Builder
+	for _, seg := range splitTOML(s) {
+		if isPlain(seg.text) {
+			b.WriteString(seg.text)
+			continue
+		}
+		var v string
+		var err error
+		switch seg.ctx {
+		case tomlBasic:
+			v, err = evalEscaped(seg.text, p, o, tomlEscape(false))
+		case tomlMultiBasic:
+			v, err = evalEscaped(seg.text, p, o, tomlEscape(true))
+		case tomlLiteral, tomlMultiLiteral:
+			multi := seg.ctx == tomlMultiLiteral
+			v, err = evalEscapedErr(seg.text, p, o, func(name, v string) (string, error) {
+				if !tomlLiteralValid(v, multi) {
+					return "", fmt.Errorf("value of %s cannot appear in a TOML literal string", name)
+				}
+				return v, nil
+			})
+		case tomlComment:
+			v, err = evalEscaped(seg.text, p, o, func(v string) string {
+				return strings.Replace(v, "\n", "\n# ", -1)
+			})
+		default:
+			v, err = evalWith(keepBackslashes(seg.text), p, o)
+		}
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+// tomlContext is the syntactic context of a part of a TOML document.
+type tomlContext int
+
+const (
+	tomlRaw          tomlContext = iota // outside strings
+	tomlBasic                           // the inside of "..."
+	tomlMultiBasic                      // the inside of """..."""
+	tomlLiteral                         // the inside of '...'
+	tomlMultiLiteral                    // the inside of '''...'''
+	tomlComment                         // a comment
+)
+
+type tomlSegment struct {
+	text string
+	ctx  tomlContext
+}
+
+// splitTOML splits a TOML document into segments. Delimiters of strings
+// are part of the raw segments around them.
+func splitTOML(s string) []tomlSegment {
+	var segs []tomlSegment
+	start := 0
+	add := func(end int, ctx tomlContext) {
+		if start < end {
+			segs = append(segs, tomlSegment{s[start:end], ctx})
+		}
+		start = end
+	}
+	for i := 0; i < len(s); {
+		var delim string
+		var ctx tomlContext
+		switch {
+		case strings.HasPrefix(s[i:], `"""`):
+			delim, ctx = `"""`, tomlMultiBasic
+		case s[i] == '"':
+			delim, ctx = `"`, tomlBasic
+		case strings.HasPrefix(s[i:], `'''`):
+			delim, ctx = `'''`, tomlMultiLiteral
+		case s[i] == '\'':
+			delim, ctx = `'`, tomlLiteral
+		case s[i] == '#':
+			add(i, tomlRaw)
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			i += end
+			if i > 0 && s[i-1] == '\r' {
+				i--
+			}
+			add(i, tomlComment)
+			continue
+		case s[i] == '$' && strings.HasPrefix(s[i:], "${"):
+			i = skipReference(s, i)
+			continue
+		case s[i] == '$' && strings.HasPrefix(s[i:], "$$"):
+			i += 2
+			continue
+		default:
+			i++
+			continue
+		}
+
+		add(i+len(delim), tomlRaw)
+		end := tomlStringEnd(s, start, delim)
+		if end < 0 {
+			// unterminated, substitute the rest as is.
+			add(len(s), tomlRaw)
+			break
+		}
+		add(end, ctx)
+		i = end + len(delim)
+		// quotes adjacent to the closing delimiter of multi-line
+		// strings belong to the string.
+		for len(delim) == 3 && i < len(s) && s[i] == delim[0] {
+			i++
+		}
+		add(i, tomlRaw)
+	}
+	add(len(s), tomlRaw)
+	return segs
+}
+
+// tomlStringEnd returns the position of the closing delimiter of the
+// string whose content starts at i, or -1 if it is not closed.
+func tomlStringEnd(s string, i int, delim string) int {
+	basic := delim[0] == '"'
+	for j := i; j < len(s); {
+		switch {
+		case s[j] == '$' && strings.HasPrefix(s[j:], "${"):
+			j = skipReference(s, j)
+		case basic && s[j] == '\\':
+			j += 2
+		case strings.HasPrefix(s[j:], delim):
+			return j
+		case len(delim) == 1 && s[j] == '\n':
+			return -1
+		default:
+			j++
+		}
+	}
+	return -1
+}
+
+// tomlEscape returns a function escaping values for basic strings, or
+// multi-line basic strings if multi is set.
+func tomlEscape(multi bool) func(string) string {
+	return func(v string) string {
+		var b strings.Builder
+		for _, r := range v {
+			switch {
+			case r == '"':
+				b.WriteString(`\"`)
+			case r == '\\':
+				b.WriteString(`\\`)
+			case r == '\n' && multi:
+				b.WriteByte('\n')
+			case r == '\n':
+				b.WriteString(`\n`)
+			case r == '\t':
+				b.WriteString(`\t`)
+			case r == '\r':
+				b.WriteString(`\r`)
+			case r < ' ' || r == 0x7f:
+				b.WriteString(`\u`)
+				s := strconv.FormatInt(int64(r), 16)
+				b.WriteString(strings.Repeat("0", 4-len(s)))
+				b.WriteString(s)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		return b.String()
+	}
+}
+
+// tomlLiteralValid reports whether v can appear in a literal string, or
+// a multi-line literal string if multi is set.
+func tomlLiteralValid(v string, multi bool) bool {
+	if multi && strings.Contains(v, "'''") {
+		return false
+	}
+	for _, r := range v {
+		switch {
+		case r == '\t':
+		case (r == '\n' || r == '\r') && multi:
+		case r == '\'' && !multi:
+			return false
+		case r < ' ' || r == 0x7f:
+			return false
+		}
+	}
+	return true
+}
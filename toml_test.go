@@ -0,0 +1,44 @@
+package envsubst
+
+import "testing"
+
+func TestEvalTOML(t *testing.T) {
+	values := mapProvider{
+		"NAME":   "web",
+		"PORT":   "8080",
+		"QUOTE":  "say \"hi\"\\now\t\x01",
+		"LINES":  "one\ntwo",
+		"APOS":   "it's",
+		"TRIPLE": "a'''b",
+	}
+	tests := []struct {
+		input, output string
+	}{
+		{"name = \"${NAME}\"\nport = ${PORT}\n", "name = \"web\"\nport = 8080\n"},
+		{`msg = "${QUOTE}"`, `msg = "say \"hi\"\\now\t\u0001"`},
+		{`msg = "${LINES}"`, `msg = "one\ntwo"`},
+		{`msg = "a\"${NAME}"`, `msg = "a\"web"`},
+		{"msg = \"\"\"\n${LINES} \"${NAME}\"\"\"\"", "msg = \"\"\"\none\ntwo \"web\"\"\"\""},
+		{"path = '${NAME}'", "path = 'web'"},
+		{"text = '''\n${LINES}\n${APOS}'''", "text = '''\none\ntwo\nit's'''"},
+		{"[${NAME}]\nkey = 1 # ${LINES}\r\n", "[web]\nkey = 1 # one\n# two\r\n"},
+		{`lit = "$${NAME}"`, `lit = "${NAME}"`},
+		{`path = "C:\\${NAME}\\x"`, `path = "C:\\web\\x"`},
+	}
+	for _, test := range tests {
+		got, err := EvalTOML(test.input, values)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("Want %q for %q, got %q", test.output, test.input, got)
+		}
+	}
+
+	for _, input := range []string{"s = '${APOS}'", "s = '${LINES}'", "s = '''${TRIPLE}'''"} {
+		if _, err := EvalTOML(input, values); err == nil {
+			t.Errorf("Want error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package envsubst
+
+import "io"
+
+// maxRefLen bounds the length of the ${...} references collected by
+// unexpandedWriter, so that a stray ${ does not buffer the output.
+const maxRefLen = 256
+
+// unexpandedWriter passes writes through to w, collecting the ${...}
+// references in the data written, even when split across writes.
+type unexpandedWriter struct {
+	w    io.Writer
+	refs []string
+
+	dollar bool   // the last byte written was $
+	ref    []byte // reference being collected, nil if none
+}
+
+func (u *unexpandedWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		switch {
+		case u.ref != nil:
+			u.ref = append(u.ref, c)
+			if c == '}' {
+				if !contains(u.refs, string(u.ref)) {
+					u.refs = append(u.refs, string(u.ref))
+				}
+				u.ref = nil
+			} else if len(u.ref) > maxRefLen {
+				u.ref = nil
+			}
+		case u.dollar && c == '{':
+			u.ref = []byte("${")
+		}
+		u.dollar = c == '$'
+	}
+	return u.w.Write(p)
+}
@@ -0,0 +1,51 @@
+package envsubst
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestNoUnexpanded(t *testing.T) {
+	params := map[string]string{"DB_HOST": "db", "NESTED": "${INNER}"}
+
+	var tests = []struct {
+		input   string
+		options []Option
+		refs    []string
+	}{
+		{input: "host=${DB_HOST}", options: []Option{NoUnexpanded()}},
+		{input: "host=${DB_HSOT}", options: []Option{NoUnexpanded(), KeepUnresolved()}, refs: []string{"${DB_HSOT}"}},
+		{input: "$${a} ${NESTED} $${a}", options: []Option{NoUnexpanded()}, refs: []string{"${a}", "${INNER}"}},
+		{input: "${DB_HSOT}", options: []Option{KeepUnresolved()}},
+	}
+
+	for _, test := range tests {
+		_, err := EvalProvider(test.input, mapProvider(params), test.options...)
+		if test.refs == nil {
+			if err != nil {
+				t.Errorf("Want %q expanded, got %v", test.input, err)
+			}
+			continue
+		}
+		var uerr *UnexpandedError
+		if !errors.As(err, &uerr) || !errors.Is(err, ErrUnexpanded) {
+			t.Errorf("Want UnexpandedError for %q, got %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(uerr.Refs, test.refs) {
+			t.Errorf("Want references %q for %q, got %q", test.refs, test.input, uerr.Refs)
+		}
+	}
+}
+
+func TestUnexpandedWriterSplit(t *testing.T) {
+	u := &unexpandedWriter{w: ioutil.Discard}
+	for _, chunk := range []string{"a $", "{b", "} $$ ${", "c}"} {
+		u.Write([]byte(chunk))
+	}
+	if want := []string{"${b}", "${c}"}; !reflect.DeepEqual(u.refs, want) {
+		t.Errorf("Want references %q, got %q", want, u.refs)
+	}
+}
@@ -0,0 +1,185 @@
+package envsubst
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// valuesProvider serves the values of a nested document by dotted path.
+type valuesProvider struct {
+	doc interface{}
+}
+
+// Values returns a provider resolving dotted variable names by walking
+// the document doc, as produced by yaml.Unmarshal or json.Unmarshal, in
+// the manner of Helm values files: ${database.primary.host} is the
+// value of the key host of the map under primary under database, and
+// ${servers.0.port} the key port of the first element of servers. Names
+// containing dots must be enabled with the DottedNames option.
+//
+// Strings, numbers and booleans are returned as text, and maps and
+// slices as JSON. Missing keys and null values are undefined. Keys that
+// contain dots themselves are matched before shorter keys.
+func Values(doc interface{}) Provider {
+	return &valuesProvider{doc: doc}
+}
+
+// LoadValues reads the named values file with the unmarshal function,
+// such as yaml.Unmarshal, and returns a provider serving its values, see
+// Values. A nil unmarshal decodes JSON, keeping numbers as written.
+func LoadValues(name string, unmarshal func([]byte, interface{}) error) (Provider, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if unmarshal == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	} else {
+		err = unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return Values(doc), nil
+}
+
+// Lookup retrieves the value at the dotted path key.
+func (p *valuesProvider) Lookup(key string) (string, bool, error) {
+	v, ok := walkValues(p.doc, key)
+	if !ok || v == nil {
+		return "", false, nil
+	}
+	s, err := formatValue(v)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %v", key, err)
+	}
+	return s, true, nil
+}
+
+// Keys returns the sorted dotted paths of the non-null scalar values of
+// the document.
+func (p *valuesProvider) Keys() []string {
+	var keys []string
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		join := func(k string) string {
+			if prefix == "" {
+				return k
+			}
+			return prefix + "." + k
+		}
+		switch v := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			for k, e := range v {
+				walk(join(k), e)
+			}
+		case map[interface{}]interface{}:
+			for k, e := range v {
+				walk(join(fmt.Sprint(k)), e)
+			}
+		case []interface{}:
+			for i, e := range v {
+				walk(join(strconv.Itoa(i)), e)
+			}
+		default:
+			if prefix != "" {
+				keys = append(keys, prefix)
+			}
+		}
+	}
+	walk("", p.doc)
+	sort.Strings(keys)
+	return keys
+}
+
+// walkValues returns the value at the dotted path in v.
+func walkValues(v interface{}, path string) (interface{}, bool) {
+	// try the longest key first, so that keys holding dots match.
+	for end := len(path); end > 0; end = strings.LastIndexByte(path[:end], '.') {
+		e, ok := childValue(v, path[:end])
+		if !ok {
+			continue
+		}
+		if end == len(path) {
+			return e, true
+		}
+		if e, ok := walkValues(e, path[end+1:]); ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// childValue returns the element of the map or slice v named key.
+func childValue(v interface{}, key string) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		e, ok := v[key]
+		return e, ok
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			if fmt.Sprint(k) == key {
+				return e, true
+			}
+		}
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 && i < len(v) {
+			return v[i], true
+		}
+	}
+	return nil, false
+}
+
+// formatValue returns the text of a scalar value, or the JSON encoding
+// of a map or slice.
+func formatValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case map[interface{}]interface{}, []interface{}, map[string]interface{}:
+		b, err := json.Marshal(jsonValue(v))
+		return string(b), err
+	}
+	return fmt.Sprint(v), nil
+}
+
+// jsonValue converts the maps with interface{} keys of v, as produced by
+// some YAML decoders, to maps with string keys that can be encoded as
+// JSON.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = jsonValue(e)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestValues(t *testing.T) {
+	doc := map[string]interface{}{
+		"database": map[string]interface{}{
+			"primary": map[string]interface{}{"host": "db1", "port": float64(5432)},
+		},
+		"servers": []interface{}{
+			map[interface{}]interface{}{"name": "a", "tls": true},
+		},
+		"app.kubernetes.io": map[string]interface{}{"name": "web"},
+		"empty":             nil,
+	}
+	p := Values(doc)
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{"database.primary.host", "db1", true},
+		{"database.primary.port", "5432", true},
+		{"servers.0.name", "a", true},
+		{"servers.0.tls", "true", true},
+		{"servers.1.name", "", false},
+		{"app.kubernetes.io.name", "web", true},
+		{"database.primary", `{"host":"db1","port":5432}`, true},
+		{"servers", `[{"name":"a","tls":true}]`, true},
+		{"empty", "", false},
+		{"database.replica.host", "", false},
+	}
+	for _, test := range tests {
+		v, ok, err := p.Lookup(test.key)
+		if v != test.value || ok != test.ok || err != nil {
+			t.Errorf("Want %q, %v for %s, got %q, %v, %v", test.value, test.ok, test.key, v, ok, err)
+		}
+	}
+
+	want := []string{"app.kubernetes.io.name", "database.primary.host", "database.primary.port", "servers.0.name", "servers.0.tls"}
+	if keys := p.(KeyLister).Keys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Want keys %v, got %v", want, keys)
+	}
+
+	got, err := EvalProvider("${database.primary.host}:${database.primary.port} ${database.replica.host:-none}", p, DottedNames())
+	if want := "db1:5432 none"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+	if _, err := EvalProvider("${database.primary.host}", p); err == nil {
+		t.Errorf("Want dotted names rejected without the DottedNames option")
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "values.json")
+	if err := ioutil.WriteFile(name, []byte(`{"image": {"tag": "1.2.3", "pullPolicy": "Always"}, "replicas": 3, "big": 12345678901234567890}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadValues(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EvalProvider("image: app:${image.tag} ${image.pullPolicy} x${replicas} ${big}", p, DottedNames())
+	if want := "image: app:1.2.3 Always x3 12345678901234567890"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte(`{"image":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadValues(name, nil); err == nil {
+		t.Errorf("Want error for malformed file")
+	}
+
+	name = filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(name, []byte("image:\n  tag: 1.2.3\n  ports: [80, 443]\nreplicas: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = LoadValues(name, yaml.Unmarshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = EvalProvider("app:${image.tag} ${image.ports.1} ${image.ports} x${replicas}", p, DottedNames())
+	if want := "app:1.2.3 443 [80,443] x3"; err != nil || got != want {
+		t.Errorf("Want %q, got %q, %v", want, got, err)
+	}
+}
@@ -0,0 +1,104 @@
+package envsubst
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"gomodules.xyz/envsubst/parse"
+)
+
+// Warning codes identify the kind of a Warning.
+const (
+	// WarnEmptyValue reports a substitution that resulted in an empty
+	// value.
+	WarnEmptyValue = "empty-value"
+	// WarnBareDollar reports a $ followed by a name outside of braces,
+	// as in $HOME, which is not expanded and is left in the output.
+	WarnBareDollar = "bare-dollar"
+	// WarnDeprecated reports deprecated syntax: ${var:=default}, which
+	// does not assign the variable and behaves as ${var:-default}.
+	WarnDeprecated = "deprecated-syntax"
+)
+
+// Warning describes a suspicious construct found during execution,
+// which does not prevent the template from being executed.
+type Warning struct {
+	// Code identifies the kind of warning, such as WarnEmptyValue.
+	Code string
+	// Message describes the warning.
+	Message string
+	// Name is the variable concerned, if any.
+	Name string
+	// Pos and End are the byte offsets in the input of the construct.
+	Pos, End int
+	// Line and Column are the 1-based line and column, counted in
+	// characters, corresponding to Pos.
+	Line, Column int
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Message)
+}
+
+// WarningError is returned when a warning is promoted to an error by
+// the WarningsAsErrors option.
+type WarningError struct {
+	Warning Warning
+}
+
+func (e *WarningError) Error() string {
+	return e.Warning.String()
+}
+
+// warn reports a warning for the input between pos and end. It returns
+// a WarningError if the warning is promoted to an error.
+func (s *state) warn(code, name string, pos, end int, format string, args ...interface{}) error {
+	line, col, _ := position(s.template.text, pos)
+	w := Warning{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Name:    name,
+		Pos:     pos,
+		End:     end,
+		Line:    line,
+		Column:  col,
+	}
+	if s.options.warn != nil {
+		s.options.warn(w)
+	}
+	if s.options.promotes(code) {
+		return &WarningError{Warning: w}
+	}
+	return nil
+}
+
+// warnText reports the unbraced references in the text node.
+func (s *state) warnText(node *parse.TextNode) error {
+	text := s.template.text
+	for i := int(node.Pos); i < int(node.End); i++ {
+		if text[i] != '$' || i+1 >= int(node.End) {
+			continue
+		}
+		if text[i+1] == '$' {
+			i++ // escaped
+			continue
+		}
+		j := i + 1
+		for j < int(node.End) {
+			r, w := utf8.DecodeRuneInString(text[j:])
+			if !(unicode.IsLetter(r) || r == '_' || j > i+1 && unicode.IsDigit(r)) {
+				break
+			}
+			j += w
+		}
+		if j > i+1 {
+			name := text[i+1 : j]
+			err := s.warn(WarnBareDollar, name, i, j, "unbraced reference $%s is not expanded, use ${%s}", name, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package envsubst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	var got []Warning
+	collect := Warnings(func(w Warning) {
+		got = append(got, w)
+	})
+	params := map[string]string{"empty": "", "name": "gopher"}
+
+	input := "$$HOME ${name}\n${empty} $HOME ${missing:-$PATH}"
+	output, err := EvalProvider(input, mapProvider(params), collect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$HOME gopher\n $HOME $PATH"; output != want {
+		t.Errorf("Want output %q, got %q", want, output)
+	}
+
+	want := []Warning{
+		{Code: WarnEmptyValue, Message: "substituted value empty for key empty", Name: "empty", Pos: 15, End: 23, Line: 2, Column: 1},
+		{Code: WarnBareDollar, Message: "unbraced reference $HOME is not expanded, use ${HOME}", Name: "HOME", Pos: 24, End: 29, Line: 2, Column: 10},
+		{Code: WarnBareDollar, Message: "unbraced reference $PATH is not expanded, use ${PATH}", Name: "PATH", Pos: 41, End: 46, Line: 2, Column: 27},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want warnings\n%+v\ngot\n%+v", want, got)
+	}
+	if s := want[1].String(); s != "2:10: unbraced reference $HOME is not expanded, use ${HOME}" {
+		t.Errorf("Unexpected warning string %q", s)
+	}
+}
+
+func TestWarnDeprecated(t *testing.T) {
+	var got []Warning
+	collect := Warnings(func(w Warning) {
+		got = append(got, w)
+	})
+	output, err := EvalProvider("port=${port:=5432}", mapProvider{}, collect)
+	if err != nil || output != "port=5432" {
+		t.Fatalf("Want %q, got %q, %v", "port=5432", output, err)
+	}
+	want := []Warning{
+		{Code: WarnDeprecated, Message: "${port:=...} is deprecated, it does not assign port, use ${port:-...}", Name: "port", Pos: 5, End: 18, Line: 1, Column: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want warnings\n%+v\ngot\n%+v", want, got)
+	}
+	if _, err := EvalProvider("${port:=5432}", mapProvider{}, WarningsAsErrors(WarnDeprecated)); err == nil {
+		t.Errorf("Want the deprecated syntax promoted to an error")
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	params := map[string]string{"empty": "", "name": "gopher"}
+	input := "${name} $HOME ${empty}"
+
+	var tests = []struct {
+		options []Option
+		code    string // code of the promoted warning, if any
+	}{
+		{options: nil},
+		{options: []Option{WarningsAsErrors()}, code: WarnBareDollar},
+		{options: []Option{WarningsAsErrors(WarnEmptyValue)}, code: WarnEmptyValue},
+		{options: []Option{WarningsAsErrors("other")}},
+	}
+	for _, test := range tests {
+		_, err := EvalProvider(input, mapProvider(params), test.options...)
+		if test.code == "" {
+			if err != nil {
+				t.Errorf("Want no error with %d options, got %v", len(test.options), err)
+			}
+			continue
+		}
+		werr, ok := err.(*WarningError)
+		if !ok || werr.Warning.Code != test.code {
+			t.Errorf("Want %s promoted to error, got %v", test.code, err)
+		}
+	}
+
+	diags := Lint(input, mapProvider(params), WarningsAsErrors(WarnBareDollar))
+	if len(diags) != 1 || diags[0].Severity != SeverityError {
+		t.Errorf("Want promoted warning linted as error, got %+v", diags)
+	}
+}
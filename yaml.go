@@ -0,0 +1,421 @@
+package envsubst
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EvalYAML replaces ${var} in a YAML document, resolving variables with
+// the provider, so that the substituted values keep the document valid
+// whatever they contain:
+//
+//   - in double-quoted scalars, quotes, backslashes and control
+//     characters are escaped.
+//   - in single-quoted scalars, quotes are doubled and line breaks
+//     folded.
+//   - plain scalars, including mapping keys, are double-quoted if their
+//     value would otherwise be misread, e.g. if it contains ": " or " #",
+//     a line break or surrounding blanks, or starts with an indicator
+//     such as - or *. Values that read as numbers or booleans are left
+//     plain, so that port: ${PORT} remains an integer.
+//   - in flow collections, values that need it are quoted likewise.
+//   - in literal and folded block scalars, line breaks are followed by
+//     the indentation of the line.
+//   - in comments, line breaks continue the comment.
+//
+// The template is only scanned line by line, so multi-line quoted and
+// plain scalars are not recognised as such.
+func EvalYAML(s string, p Provider, opts ...Option) (string, error) {
+	if isPlain(s) {
+		return s, nil
+	}
+	o := newOptions(opts)
+	var b strings.Builder
+	block := -1 // indentation of the line opening a block scalar
+	for len(s) > 0 {
+		line, eol := s, ""
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line, eol, s = s[:i], "\n", s[i+1:]
+		} else {
+			s = ""
+		}
+		if strings.HasSuffix(line, "\r") {
+			line, eol = line[:len(line)-1], "\r"+eol
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		var segments []yamlSegment
+		if block >= 0 && (indent > block || strings.TrimSpace(line) == "") {
+			segments = []yamlSegment{{line, yamlBlock}}
+		} else {
+			block = -1
+			var opens bool
+			segments, opens = splitYAML(line)
+			if opens {
+				block = indent
+			}
+		}
+
+		prefix := line[:indent]
+		for _, seg := range segments {
+			v, err := evalYAMLSegment(seg, prefix, p, o)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+		}
+		b.WriteString(eol)
+	}
+	return b.String(), nil
+}
+
+// yamlContext is the syntactic context of a part of a YAML line.
+type yamlContext int
+
+const (
+	yamlRaw     yamlContext = iota // structure, substituted as is
+	yamlPlain                      // a plain scalar
+	yamlFlow                       // a flow collection
+	yamlDouble                     // the inside of a double-quoted scalar
+	yamlSingle                     // the inside of a single-quoted scalar
+	yamlBlock                      // a line of a block scalar
+	yamlComment                    // a comment
+)
+
+// yamlSegment is a part of a YAML line.
+type yamlSegment struct {
+	text string
+	ctx  yamlContext
+}
+
+// evalYAMLSegment evaluates the segment of a line indented by prefix.
+func evalYAMLSegment(seg yamlSegment, prefix string, p Provider, o *options) (string, error) {
+	if seg.text == "" || isPlain(seg.text) {
+		return seg.text, nil
+	}
+	switch seg.ctx {
+	case yamlPlain:
+		v, err := evalWith(keepBackslashes(seg.text), p, o)
+		if err != nil {
+			return "", err
+		}
+		if yamlNeedsQuote(v, false) {
+			return yamlQuote(v), nil
+		}
+		return v, nil
+	case yamlFlow:
+		return evalEscaped(seg.text, p, o, func(v string) string {
+			if yamlNeedsQuote(v, true) {
+				return yamlQuote(v)
+			}
+			return v
+		})
+	case yamlDouble:
+		return evalEscaped(seg.text, p, o, yamlEscape)
+	case yamlSingle:
+		return evalEscaped(seg.text, p, o, func(v string) string {
+			v = strings.Replace(v, "'", "''", -1)
+			return strings.Replace(v, "\n", "\n\n"+prefix+"  ", -1)
+		})
+	case yamlBlock:
+		return evalEscaped(seg.text, p, o, func(v string) string {
+			return strings.Replace(v, "\n", "\n"+prefix, -1)
+		})
+	case yamlComment:
+		return evalEscaped(seg.text, p, o, func(v string) string {
+			return strings.Replace(v, "\n", "\n"+prefix+"# ", -1)
+		})
+	}
+	return evalWith(keepBackslashes(seg.text), p, o)
+}
+
+// evalEscaped replaces ${var} in the string, passing the substituted
+// values, but not the literal text, through escape.
+func evalEscaped(s string, p Provider, o *options, escape func(string) string) (string, error) {
+	return evalEscapedErr(s, p, o, func(name, v string) (string, error) {
+		return escape(v), nil
+	})
+}
+
+// evalEscapedErr is like evalEscaped for escape functions that fail for
+// values that cannot be represented, given the name of the variable.
+func evalEscapedErr(s string, p Provider, o *options, escape func(name, v string) (string, error)) (string, error) {
+	t, err := parseTemplate(keepBackslashes(s), o)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	var eerr error
+	st := t.newState(ioutil.Discard, p, o)
+	st.emit = func(ev Event) bool {
+		if ev.Substitution == nil {
+			b.WriteString(ev.Text)
+			return true
+		}
+		v, err := escape(ev.Substitution.Name, ev.Text)
+		if err != nil {
+			eerr = err
+			return false
+		}
+		b.WriteString(v)
+		return true
+	}
+	if err := t.run(st); err != nil {
+		if err == errStopped {
+			err = eerr
+		}
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// keepBackslashes doubles the backslashes outside references, so that
+// the backslash escapes of the document are copied unchanged rather than
+// read as escapes of the template.
+func keepBackslashes(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '$' && strings.HasPrefix(s[i:], "${"):
+			j := skipReference(s, i)
+			b.WriteString(s[i:j])
+			i = j
+		case s[i] == '\\':
+			b.WriteString(`\\`)
+			i++
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// splitYAML splits a line of a YAML document, outside block scalars,
+// into segments. The boolean reports whether the line opens a block
+// scalar.
+func splitYAML(line string) ([]yamlSegment, bool) {
+	var segs []yamlSegment
+	raw := func(i, j int) {
+		if i < j {
+			segs = append(segs, yamlSegment{line[i:j], yamlRaw})
+		}
+	}
+	i := len(line) - len(strings.TrimLeft(line, " \t"))
+	raw(0, i)
+	rest := line[i:]
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		return append(segs, yamlSegment{rest, yamlComment}), false
+	case strings.HasPrefix(rest, "---"), strings.HasPrefix(rest, "..."), strings.HasPrefix(rest, "%"):
+		return append(segs, yamlSegment{rest, yamlRaw}), false
+	}
+
+	// sequence entries
+	for i < len(line) && line[i] == '-' && (i+1 == len(line) || line[i+1] == ' ') {
+		j := i + 1
+		for j < len(line) && line[j] == ' ' {
+			j++
+		}
+		raw(i, j)
+		i = j
+	}
+
+	// a key, or the value of a sequence entry
+	opens := false
+	for k := 0; k < 2 && i < len(line); k++ {
+		var end int
+		switch line[i] {
+		case '"', '\'':
+			q := line[i]
+			end = yamlQuoted(line, i)
+			if end < 0 {
+				raw(i, len(line))
+				return segs, false
+			}
+			ctx := yamlDouble
+			if q == '\'' {
+				ctx = yamlSingle
+			}
+			raw(i, i+1)
+			segs = append(segs, yamlSegment{line[i+1 : end-1], ctx})
+			raw(end-1, end)
+		case '[', '{':
+			end = yamlCommentStart(line, i)
+			text := strings.TrimRight(line[i:end], " \t")
+			segs = append(segs, yamlSegment{text, yamlFlow})
+			end = i + len(text)
+		case '|', '>':
+			end = yamlCommentStart(line, i)
+			opens = true
+			raw(i, end)
+		case '#':
+			end = i
+		default:
+			end = yamlPlainEnd(line, i, k == 0)
+			text := strings.TrimRight(line[i:end], " \t")
+			segs = append(segs, yamlSegment{text, yamlPlain})
+			end = i + len(text)
+		}
+		i = end
+
+		// the separator of a key and its value
+		if k == 0 && i < len(line) && line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t') {
+			j := i + 1
+			for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+				j++
+			}
+			raw(i, j)
+			i = j
+			continue
+		}
+		break
+	}
+
+	j := i
+	for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+		j++
+	}
+	raw(i, j)
+	if j < len(line) && line[j] == '#' {
+		segs = append(segs, yamlSegment{line[j:], yamlComment})
+	} else {
+		raw(j, len(line))
+	}
+	return segs, opens
+}
+
+// yamlQuoted returns the end of the quoted scalar starting at i, after
+// its closing quote, or -1 if it is not closed on the line.
+func yamlQuoted(line string, i int) int {
+	q := line[i]
+	for j := i + 1; j < len(line); {
+		switch c := line[j]; {
+		case c == '$' && strings.HasPrefix(line[j:], "${"):
+			j = skipReference(line, j)
+		case c == '\\' && q == '"':
+			j += 2
+		case c == q && q == '\'' && j+1 < len(line) && line[j+1] == '\'':
+			j += 2
+		case c == q:
+			return j + 1
+		default:
+			j++
+		}
+	}
+	return -1
+}
+
+// yamlPlainEnd returns the end of the plain scalar starting at i: the
+// start of a comment, or of the separator of a key if key is set.
+func yamlPlainEnd(line string, i int, key bool) int {
+	for j := i; j < len(line); {
+		switch c := line[j]; {
+		case c == '$' && strings.HasPrefix(line[j:], "${"):
+			j = skipReference(line, j)
+		case c == '#' && j > i && (line[j-1] == ' ' || line[j-1] == '\t'):
+			return j
+		case key && c == ':' && (j+1 == len(line) || line[j+1] == ' ' || line[j+1] == '\t'):
+			return j
+		default:
+			j++
+		}
+	}
+	return len(line)
+}
+
+// yamlCommentStart returns the start of the comment following i, or the
+// end of the line.
+func yamlCommentStart(line string, i int) int {
+	return yamlPlainEnd(line, i, false)
+}
+
+// skipReference returns the end of the ${...} expression starting at i,
+// or the end of the line if it is not closed.
+func skipReference(line string, i int) int {
+	depth := 0
+	for j := i; j < len(line); j++ {
+		switch {
+		case line[j] == '$' && j+1 < len(line) && line[j+1] == '{':
+			depth++
+			j++
+		case line[j] == '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(line)
+}
+
+// yamlNeedsQuote reports whether the plain scalar v must be quoted, in
+// a flow collection if flow is set.
+func yamlNeedsQuote(v string, flow bool) bool {
+	if v == "" {
+		return false
+	}
+	if v != strings.TrimSpace(v) {
+		return true
+	}
+	switch v[0] {
+	case '-', '?', ':':
+		if len(v) == 1 || v[1] == ' ' || v[1] == '\t' {
+			return true
+		}
+	case ',', '[', ']', '{', '}', '#', '&', '*', '!', '|', '>', '\'', '"', '%', '@', '`':
+		return true
+	}
+	if strings.HasSuffix(v, ":") || strings.Contains(v, ": ") || strings.Contains(v, " #") {
+		return true
+	}
+	if flow && strings.ContainsAny(v, ",[]{}") {
+		return true
+	}
+	for _, r := range v {
+		if r < ' ' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlQuote returns v as a double-quoted scalar.
+func yamlQuote(v string) string {
+	return `"` + yamlEscape(v) + `"`
+}
+
+// yamlEscape escapes v for the inside of a double-quoted scalar.
+func yamlEscape(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				b.WriteString(`\x`)
+				if r < 0x10 {
+					b.WriteByte('0')
+				}
+				b.WriteString(strconv.FormatInt(int64(r), 16))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
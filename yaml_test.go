@@ -0,0 +1,65 @@
+package envsubst
+
+import "testing"
+
+func TestEvalYAML(t *testing.T) {
+	values := mapProvider{
+		"PORT":     "8080",
+		"NAME":     "web",
+		"COLON":    "a: b",
+		"HASH":     "a #b",
+		"DASH":     "- x",
+		"STAR":     "*ref",
+		"QUOTE":    `say "hi"\now`,
+		"APOS":     "it's",
+		"LINES":    "one\ntwo",
+		"SPACE":    " padded ",
+		"COMMA":    "a,b",
+		"TRUE":     "true",
+		"EMPTY":    "",
+		"KEY":      "key: x",
+		"TEMPLATE": "${NAME}",
+	}
+	tests := []struct {
+		input, output string
+	}{
+		{"port: ${PORT}\n", "port: 8080\n"},
+		{`path: "C:\\${NAME}"` + "\n" + `dir: C:\\${NAME}`, `path: "C:\\web"` + "\n" + `dir: C:\\web`},
+		{"image: repo/${NAME}:1.0\n", "image: repo/web:1.0\n"},
+		{"value: ${COLON}\n", "value: \"a: b\"\n"},
+		{"value: ${HASH} # comment\n", "value: \"a #b\" # comment\n"},
+		{"- ${DASH}\n", "- \"- x\"\n"},
+		{"- name: ${STAR}\n", "- name: \"*ref\"\n"},
+		{"value: ${LINES}\n", "value: \"one\\ntwo\"\n"},
+		{"value: ${SPACE}\n", "value: \" padded \"\n"},
+		{"value: ${TRUE}\n", "value: true\n"},
+		{"value: ${EMPTY}\n", "value: \n"},
+		{"cmd: echo ${COLON}\n", "cmd: \"echo a: b\"\n"},
+		{"${KEY}: ${NAME}\n", "\"key: x\": web\n"},
+		{"value: \"${QUOTE}\"\n", "value: \"say \\\"hi\\\"\\\\now\"\n"},
+		{"value: \"a\\\"${NAME}\"\n", "value: \"a\\\"web\"\n"},
+		{"value: '${APOS}'\n", "value: 'it''s'\n"},
+		{"  value: '${LINES}'\n", "  value: 'one\n\n    two'\n"},
+		{"list: [${NAME}, ${COMMA}]\n", "list: [web, \"a,b\"]\n"},
+		{"script: |\n  echo ${LINES}\n  done\nnext: ${NAME}\n", "script: |\n  echo one\n  two\n  done\nnext: web\n"},
+		{"text: >-\n    ${COLON}\n", "text: >-\n    a: b\n"},
+		{"# ${LINES}\n", "# one\n# two\n"},
+		{"value: ${TEMPLATE}\r\n", "value: ${NAME}\r\n"},
+		{"value: $${NAME}\n", "value: ${NAME}\n"},
+		{"---\nplain: text\n", "---\nplain: text\n"},
+	}
+	for _, test := range tests {
+		got, err := EvalYAML(test.input, values)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got != test.output {
+			t.Errorf("Want %q for %q, got %q", test.output, test.input, got)
+		}
+	}
+
+	if _, err := EvalYAML("value: ${MISSING}\n", values, NoUnset()); err == nil {
+		t.Errorf("Want error for undefined variable with NoUnset")
+	}
+}